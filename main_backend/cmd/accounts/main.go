@@ -0,0 +1,225 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/metering"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+)
+
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func Register(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store, err := auth.GetStore()
+	if err != nil {
+		slog.Error("Failed to get account store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := auth.Register(r.Context(), store, req.Email, req.Password)
+	switch {
+	case errors.Is(err, auth.ErrInvalidEmail), errors.Is(err, auth.ErrPasswordTooShort):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, auth.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		slog.Error("Failed to register user", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Registered user", "userId", user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Login starts a session. SESSION_DURATION overrides how long sessions last.
+func Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store, err := auth.GetStore()
+	if err != nil {
+		slog.Error("Failed to get account store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	duration := utils.GetEnvDuration("SESSION_DURATION", auth.DefaultSessionDuration)
+	token, expiresAt, err := auth.Login(r.Context(), store, req.Email, req.Password, duration)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to log in", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(LoginResponse{Token: token, ExpiresAt: expiresAt})
+}
+
+func Logout(w http.ResponseWriter, r *http.Request) {
+	store, err := auth.GetStore()
+	if err != nil {
+		slog.Error("Failed to get account store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = auth.Logout(r.Context(), store, auth.TokenFromRequest(r))
+	if err != nil {
+		slog.Error("Failed to log out", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type CreateAPIKeyResponse struct {
+	auth.APIKey
+	// Key is only ever returned here.
+	Key string `json:"key"`
+}
+
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store, err := auth.GetStore()
+	if err != nil {
+		slog.Error("Failed to get account store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user := auth.UserFromContext(r.Context())
+	token, key, err := auth.NewAPIKey(r.Context(), store, user.ID, req.Name)
+	if err != nil {
+		slog.Error("Failed to create API key", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Created API key", "userId", user.ID, "keyId", key.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{APIKey: *key, Key: token})
+}
+
+func ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	store, err := auth.GetStore()
+	if err != nil {
+		slog.Error("Failed to get account store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user := auth.UserFromContext(r.Context())
+	keys, err := store.ListAPIKeys(r.Context(), user.ID)
+	if err != nil {
+		slog.Error("Failed to list API keys", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(keys)
+}
+
+func DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	store, err := auth.GetStore()
+	if err != nil {
+		slog.Error("Failed to get account store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user := auth.UserFromContext(r.Context())
+	err = store.DeleteAPIKey(r.Context(), user.ID, r.PathValue("key_id"))
+	if errors.Is(err, auth.ErrAPIKeyNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to delete API key", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(auth.UserFromContext(r.Context()))
+}
+
+// GetUsage reports the current user's usage in the current billing period.
+func GetUsage(w http.ResponseWriter, r *http.Request) {
+	store, err := jobs.GetStore()
+	if err != nil {
+		slog.Error("Failed to get job store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usage, err := metering.GetUsage(r.Context(), store, auth.UserFromContext(r.Context()), time.Now())
+	if err != nil {
+		slog.Error("Failed to get usage", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(usage)
+}
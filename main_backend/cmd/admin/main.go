@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/uploads"
+)
+
+// CollectUploads reclaims the storage of abandoned uploads now, rather than
+// waiting for the next scheduled collection, and reports what was reclaimed.
+func CollectUploads(w http.ResponseWriter, r *http.Request) {
+	janitor, err := uploads.GetJanitor()
+	if err != nil {
+		slog.Error("Failed to get upload janitor", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report, err := janitor.Collect(r.Context())
+	if err != nil {
+		slog.Error("Failed to collect abandoned uploads", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+type SetPlanRequest struct {
+	Email string `json:"email"`
+	Plan  string `json:"plan"`
+}
+
+// SetUserPlan moves a user to another plan, e.g. once they have paid, and
+// responds with the updated user.
+func SetUserPlan(w http.ResponseWriter, r *http.Request) {
+	var req SetPlanRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store, err := auth.GetStore()
+	if err != nil {
+		slog.Error("Failed to get account store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := auth.SetPlan(r.Context(), store, req.Email, req.Plan)
+	switch {
+	case errors.Is(err, auth.ErrInvalidPlan):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, auth.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		slog.Error("Failed to set plan", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Set user plan", "userId", user.ID, "plan", user.Plan)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
@@ -1,12 +1,12 @@
 package download
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
 	"time"
 
-	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/gcloud"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/storage"
 )
 
 const PRESIGNED_URL_DURATION = 15 * time.Minute
@@ -27,7 +27,14 @@ func CreateDownloadURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, err := gcloud.PresignDownloadURL(context.Background(), req.Key, PRESIGNED_URL_DURATION)
+	store, err := storage.GetObjectStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	key := auth.ScopeKey(auth.UserFromContext(r.Context()), req.Key)
+	url, err := store.PresignGet(r.Context(), key, PRESIGNED_URL_DURATION)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
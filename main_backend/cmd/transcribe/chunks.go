@@ -0,0 +1,193 @@
+package transcribe
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/chunking"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/media"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/storage"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/uploads"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+	"github.com/google/uuid"
+)
+
+// background is what chunked transcriptions run under once the request that
+// started them has returned.
+var background = struct {
+	ctx context.Context
+	wg  *sync.WaitGroup
+}{context.Background(), &sync.WaitGroup{}}
+
+// SetBackground makes chunked transcriptions run under ctx and be tracked by
+// wg, so that they are stopped and waited for on shutdown. It must be called
+// before the server starts.
+func SetBackground(ctx context.Context, wg *sync.WaitGroup) {
+	background.ctx = ctx
+	background.wg = wg
+}
+
+// goTranscribeChunks runs transcribeChunks in the background.
+func goTranscribeChunks(store jobs.Store, whisperClient whisper.Transcriber, parent *jobs.Job, info *chunking.WAVInfo, windows []chunking.Window, policy runpod.ExecutionPolicy) {
+	background.wg.Add(1)
+	go func() {
+		defer background.wg.Done()
+		transcribeChunks(background.ctx, store, whisperClient, parent, info, windows, policy)
+	}()
+}
+
+// probeWAV reads the header of the object at key, or returns nil if it is
+// not a WAV recording.
+func probeWAV(ctx context.Context, key string) *chunking.WAVInfo {
+	store, err := storage.GetObjectStore()
+	if err != nil {
+		slog.Error("Failed to get object store", "error", err)
+		return nil
+	}
+
+	info, err := chunking.ProbeWAV(ctx, store, key)
+	if err != nil {
+		slog.Info("Could not read audio as WAV", "key", key, "reason", err)
+		return nil
+	}
+	return info
+}
+
+// uploadedMedia returns the media info recorded when the upload of key was
+// completed, or nil if there is none, e.g. for files uploaded before media
+// was probed.
+func uploadedMedia(ctx context.Context, key string) *media.Info {
+	sessions, err := uploads.GetStore()
+	if err != nil {
+		slog.Error("Failed to get upload session store", "error", err)
+		return nil
+	}
+
+	session, err := sessions.GetCompleted(ctx, key)
+	if errors.Is(err, uploads.ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		slog.Error("Failed to get upload session", "key", key, "error", err)
+		return nil
+	}
+	return session.Media
+}
+
+// planChunks returns the windows to transcribe a WAV recording in, or nil if
+// it should be transcribed in one piece. Recordings longer than
+// TRANSCRIBE_CHUNK_WINDOW are split into windows overlapping by
+// TRANSCRIBE_CHUNK_OVERLAP.
+func planChunks(info *chunking.WAVInfo) []chunking.Window {
+	if info == nil {
+		return nil
+	}
+	window := utils.GetEnvDuration("TRANSCRIBE_CHUNK_WINDOW", chunking.DefaultWindow)
+	overlap := utils.GetEnvDuration("TRANSCRIBE_CHUNK_OVERLAP", chunking.DefaultOverlap)
+
+	windows := chunking.Windows(info.Duration(), window, overlap)
+	if len(windows) < 2 {
+		return nil
+	}
+	slog.Info("Splitting audio", "duration", info.Duration(), "chunks", len(windows))
+	return windows
+}
+
+// transcribeChunks splits the recording of parent into windows and starts a
+// child job for each of them in parallel. If the recording cannot be split,
+// including because ctx was cancelled on shutdown, parent is marked as failed
+// and its diarization is cancelled. The chunk objects are deleted by the
+// upload janitor once parent and its children have finished.
+func transcribeChunks(ctx context.Context, store jobs.Store, whisperClient whisper.Transcriber, parent *jobs.Job, info *chunking.WAVInfo, windows []chunking.Window, policy runpod.ExecutionPolicy) {
+	err := startChunks(ctx, store, whisperClient, parent, info, windows, policy)
+	if err != nil {
+		slog.Error("Failed to start chunked transcription", "jobId", parent.ID, "error", err)
+		ctx := context.WithoutCancel(ctx)
+		_, updateErr := store.UpdateStatus(ctx, parent.ID, jobs.StatusUpdate{Status: jobs.StatusFailed, Error: err.Error()})
+		if updateErr != nil && !errors.Is(updateErr, jobs.ErrJobFinished) {
+			slog.Error("Failed to mark job as failed", "jobId", parent.ID, "error", updateErr)
+		}
+		cancelDiarization(ctx, parent)
+	}
+}
+
+func startChunks(ctx context.Context, store jobs.Store, whisperClient whisper.Transcriber, parent *jobs.Job, info *chunking.WAVInfo, windows []chunking.Window, policy runpod.ExecutionPolicy) error {
+	objectStore, err := storage.GetObjectStore()
+	if err != nil {
+		return err
+	}
+
+	chunks, err := chunking.SplitWAV(ctx, objectStore, parent.UploadKey, parent.ID, info, windows)
+	if err != nil {
+		return err
+	}
+
+	children := make([]*jobs.Job, len(chunks))
+	webhooks := make([]*runpod.WebHook, len(chunks))
+	for i, chunk := range chunks {
+		audioURL, err := objectStore.PresignGet(ctx, chunk.Key, policy.MaxJobDuration())
+		if err != nil {
+			return err
+		}
+
+		child := &jobs.Job{
+			ID:         uuid.New().String(),
+			Owner:      parent.Owner,
+			UploadKey:  chunk.Key,
+			Input:      parent.Input,
+			ParentID:   parent.ID,
+			ChunkStart: chunk.Window.Start.Seconds(),
+			ChunkEnd:   chunk.Window.End.Seconds(),
+			// Chunks count towards RunPod time but not towards quotas, which
+			// are charged to the parent.
+			AudioSeconds: (chunk.Window.End - chunk.Window.Start).Seconds(),
+			Deadline:     time.Now().Add(policy.MaxJobDuration()),
+		}
+		child.Input.AudioURL = audioURL
+
+		webhooks[i], err = newWebhook(child)
+		if err != nil {
+			return err
+		}
+		err = store.Create(ctx, child)
+		if err != nil {
+			return err
+		}
+		children[i] = child
+	}
+
+	// The parent may have been cancelled while the recording was split, in
+	// which case its children are never started.
+	_, err = store.UpdateStatus(ctx, parent.ID, jobs.StatusUpdate{Status: jobs.StatusQueue})
+	if errors.Is(err, jobs.ErrJobFinished) {
+		for _, child := range children {
+			_, err = store.UpdateStatus(ctx, child.ID, jobs.StatusUpdate{Status: jobs.StatusCanceled})
+			if err != nil && !errors.Is(err, jobs.ErrJobFinished) {
+				return err
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// A child that fails to start is marked as failed, which fails the
+	// parent the next time it is refreshed.
+	var wg sync.WaitGroup
+	for i, child := range children {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runJob(ctx, store, whisperClient, child, webhooks[i], policy)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
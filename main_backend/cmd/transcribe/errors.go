@@ -0,0 +1,43 @@
+package transcribe
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+)
+
+// backendErrorStatus returns the status to answer with when a call to the
+// transcription backend fails with err. Failures on RunPod's side are
+// reported as bad gateways, rather than as failures of ours or the client's.
+func backendErrorStatus(err error) int {
+	var apiErr *runpod.APIError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		if apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode == http.StatusServiceUnavailable {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusGatewayTimeout
+	case errors.As(err, &netErr):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeBackendError answers with the status backendErrorStatus gives for
+// err, passing on how long RunPod asked us to wait, if it did.
+func writeBackendError(w http.ResponseWriter, err error) {
+	var apiErr *runpod.APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(apiErr.RetryAfter.Seconds()))))
+	}
+	http.Error(w, err.Error(), backendErrorStatus(err))
+}
@@ -0,0 +1,157 @@
+package transcribe
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+)
+
+const (
+	DEFAULT_STREAM_HEARTBEAT_INTERVAL = 15 * time.Second
+	// DEFAULT_STREAM_RETRY is how long clients wait before reconnecting to a
+	// stream that was closed before the job finished.
+	DEFAULT_STREAM_RETRY = 3 * time.Second
+)
+
+type JobStatusEvent struct {
+	JobId         string    `json:"job_id"`
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	DelayTime     int       `json:"delay_time,omitempty"`
+	ExecutionTime int       `json:"execution_time,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func newJobStatusEvent(job *jobs.Job) JobStatusEvent {
+	return JobStatusEvent{
+		JobId:         job.ID,
+		Status:        job.Status,
+		Error:         job.Error,
+		DelayTime:     job.DelayTime,
+		ExecutionTime: job.ExecutionTime,
+		// Jobs are stored to the millisecond.
+		UpdatedAt: job.UpdatedAt.Truncate(time.Millisecond),
+	}
+}
+
+// sameState reports whether e and other describe the same state of a job,
+// whenever they were recorded. Jobs are recorded each time they are polled,
+// whether or not they changed.
+func (e JobStatusEvent) sameState(other JobStatusEvent) bool {
+	e.UpdatedAt, other.UpdatedAt = time.Time{}, time.Time{}
+	return e == other
+}
+
+// SubscribeJobStatus sends the status of a job as Server-Sent Events, each a
+// status event with a JobStatusEvent, whenever it changes. The first event is
+// the job's current status, and the stream ends after the job finishes.
+//
+// Changes are pushed from the job poller and RunPod webhooks, so subscribers
+// never call RunPod themselves. A comment is sent every
+// STREAM_HEARTBEAT_INTERVAL to keep idle connections open. Events are
+// identified by when the job was last updated: a client that reconnects with
+// Last-Event-ID is not sent the status it already has, and if the job has
+// finished since, it is told not to reconnect with 204 No Content.
+func SubscribeJobStatus(w http.ResponseWriter, r *http.Request) {
+	job, store, ok := loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	// Subscribe before reading the job again so that no change is missed in
+	// between.
+	events, unsubscribe := jobs.GetBroker().Subscribe(job.ID)
+	defer unsubscribe()
+	job, err := store.Get(r.Context(), job.ID)
+	if err != nil {
+		slog.Error("Failed to get job", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	current := newJobStatusEvent(job)
+	seen := r.Header.Get("Last-Event-ID") == eventID(current)
+	if seen && jobs.IsTerminal(current.Status) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	stream := &eventStream{w: w, rc: http.NewResponseController(w)}
+	err = stream.retry(DEFAULT_STREAM_RETRY)
+	if err != nil {
+		slog.Error("Failed to start event stream", "jobId", job.ID, "error", err)
+		return
+	}
+	if !seen {
+		err = stream.sendWithID(eventID(current), "status", current)
+		if err != nil {
+			return
+		}
+	}
+	if jobs.IsTerminal(current.Status) {
+		return
+	}
+
+	heartbeat := time.NewTicker(utils.GetEnvDuration("STREAM_HEARTBEAT_INTERVAL", DEFAULT_STREAM_HEARTBEAT_INTERVAL))
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			err = stream.comment("heartbeat")
+			if err != nil {
+				return
+			}
+		case job, ok := <-events:
+			if !ok {
+				// The server is shutting down. The client reconnects to
+				// another instance.
+				return
+			}
+			event := newJobStatusEvent(job)
+			if event.sameState(current) {
+				continue
+			}
+			current = event
+			err = stream.sendWithID(eventID(current), "status", current)
+			if err != nil {
+				return
+			}
+			if jobs.IsTerminal(current.Status) {
+				return
+			}
+		}
+	}
+}
+
+func eventID(event JobStatusEvent) string {
+	return strconv.FormatInt(event.UpdatedAt.UnixMilli(), 10)
+}
+
+// retry tells the client how long to wait before reconnecting, and sends
+// the headers.
+func (s *eventStream) retry(d time.Duration) error {
+	_, err := fmt.Fprintf(s.w, "retry: %d\n\n", d.Milliseconds())
+	if err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *eventStream) comment(text string) error {
+	_, err := fmt.Fprintf(s.w, ": %s\n\n", text)
+	if err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
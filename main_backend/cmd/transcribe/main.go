@@ -1,30 +1,80 @@
 package transcribe
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/chunking"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/diarize"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/media"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/metering"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/storage"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/transcript"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
 	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+	"github.com/google/uuid"
 )
 
-type StartTranscriptionRequest whisper.WhisperInput
+const (
+	DEFAULT_EXECUTION_TIMEOUT = time.Hour
+	// CHUNK_SPLIT_ALLOWANCE is how long splitting a long recording may take,
+	// which is added to the deadline of jobs that are split into chunks.
+	CHUNK_SPLIT_ALLOWANCE = 30 * time.Minute
+)
+
+// StartTranscriptionRequest is a whisper.WhisperInput whose audio may instead
+// be given as the key of an uploaded object. Only keys are accepted if the
+// transcriber is a whisper.AudioFetcher.
+type StartTranscriptionRequest struct {
+	whisper.WhisperInput
+	Key string `json:"key,omitempty"`
+	// Diarize labels the transcript's segments with speakers.
+	Diarize bool `json:"diarize,omitempty"`
+}
 
 type StartTranscriptionResponse struct {
 	JobId string `json:"job_id"`
 }
 
-func getRunpodWhisperClient() (*whisper.RunpodWhisperClient, error) {
-	return whisper.NewRunpodWhisperClient(os.Getenv("RUNPOD_API_KEY"), os.Getenv("RUNPOD_WHISPER_URL"))
+func getDiarizer() (*diarize.RunpodDiarizer, error) {
+	return diarize.NewRunpodDiarizer(os.Getenv("RUNPOD_API_KEY"), os.Getenv("RUNPOD_DIARIZATION_URL"))
 }
 
+// getExecutionPolicy returns the RunPod execution policy for transcription
+// jobs. TRANSCRIBE_EXECUTION_TIMEOUT overrides the execution timeout.
+var getExecutionPolicy = sync.OnceValue(func() runpod.ExecutionPolicy {
+	timeout := utils.GetEnvDuration("TRANSCRIBE_EXECUTION_TIMEOUT", DEFAULT_EXECUTION_TIMEOUT)
+	return runpod.ExecutionPolicy{
+		Timeout: int(timeout.Milliseconds()),
+	}
+})
+
 func StartTranscription(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Starting transcription")
-	whisperClient, err := getRunpodWhisperClient()
+	whisperClient, err := whisper.GetTranscriber()
+	if err != nil {
+		slog.Error("Failed to get transcriber", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	store, err := jobs.GetStore()
 	if err != nil {
-		slog.Error("Failed to get RunpodWhisperClient", "error", err)
+		slog.Error("Failed to get job store", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -45,20 +95,130 @@ func StartTranscription(w http.ResponseWriter, r *http.Request) {
 	}
 	slog.Info("Unmarshaled request body", "body", reqBody)
 
-	res, err := whisperClient.Run(whisper.WhisperInput(reqBody), nil, nil, nil)
-	if res == nil {
-		slog.Error("Received nil response from WhisperRun")
-		http.Error(w, "Received nil response from WhisperRun", http.StatusInternalServerError)
+	if (reqBody.Key == "") == (reqBody.AudioURL == "") {
+		slog.Error("Exactly one of key and audio is required")
+		http.Error(w, "exactly one of key and audio is required", http.StatusBadRequest)
+		return
+	}
+	// Backends that download the audio themselves would fetch any URL from
+	// inside our network, so they only get the URLs of uploads.
+	if _, ok := whisperClient.(whisper.AudioFetcher); ok && reqBody.AudioURL != "" {
+		slog.Error("Audio URLs are not supported by the transcriber backend")
+		http.Error(w, "audio URLs are not supported by this backend, upload the audio and pass its key", http.StatusBadRequest)
+		return
+	}
+
+	var diarizer *diarize.RunpodDiarizer
+	if reqBody.Diarize {
+		diarizer, err = getDiarizer()
+		if errors.Is(err, diarize.ErrMissingRunpodDiarizationURL) || errors.Is(err, runpod.ErrMissingAPIKey) {
+			slog.Error("Diarization is not configured", "error", err)
+			http.Error(w, "diarization is not configured", http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to get diarizer", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	user := auth.UserFromContext(r.Context())
+	if reqBody.Key != "" {
+		reqBody.Key = auth.ScopeKey(user, reqBody.Key)
+	}
+
+	policy := getExecutionPolicy()
+	job := &jobs.Job{
+		ID:        uuid.New().String(),
+		Owner:     user.ID,
+		UploadKey: reqBody.Key,
+		Input:     reqBody.WhisperInput,
+	}
+
+	if reqBody.Key != "" {
+		audioURL, status, err := presignAudioURL(r.Context(), reqBody.Key, policy.MaxJobDuration())
+		if err != nil {
+			slog.Error("Failed to presign audio URL", "key", reqBody.Key, "error", err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+		job.Input.AudioURL = audioURL
+	}
+
+	var wavInfo *chunking.WAVInfo
+	if reqBody.Key != "" {
+		info := uploadedMedia(r.Context(), reqBody.Key)
+		if info != nil {
+			job.AudioSeconds = info.DurationSeconds
+		}
+		// Only WAV recordings can be split into chunks.
+		if info == nil || info.Format == media.FormatWAV {
+			wavInfo = probeWAV(r.Context(), reqBody.Key)
+		}
+	}
+	if wavInfo != nil {
+		job.AudioSeconds = wavInfo.Duration().Seconds()
+	}
+
+	windows := planChunks(wavInfo)
+	job.Chunks = len(windows)
+	job.Deadline = time.Now().Add(policy.MaxJobDuration())
+	if len(windows) > 0 {
+		job.Deadline = job.Deadline.Add(CHUNK_SPLIT_ALLOWANCE)
+	}
+
+	var webhook *runpod.WebHook
+	if len(windows) == 0 {
+		webhook, err = newWebhook(job)
+		if err != nil {
+			slog.Error("Failed to create webhook", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = metering.Admit(r.Context(), store, user, job, time.Now())
+	if errors.Is(err, metering.ErrModelNotAllowed) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, metering.ErrQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
 		return
 	}
 	if err != nil {
-		slog.Error("Failed to run Whisper", "error", err)
+		slog.Error("Failed to create job", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	slog.Info("Received response from WhisperRun", "response", res)
+
+	// Diarization is started once the job is recorded, so that it is never
+	// left running without a job to cancel it with, and before the job is
+	// submitted, so that the job cannot complete without it.
+	if diarizer != nil {
+		job, err = startDiarization(r.Context(), store, diarizer, job)
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+	}
+
+	if len(windows) > 0 {
+		// Splitting a long recording takes a while, so the chunks are
+		// transcribed in the background and the client polls the parent job.
+		goTranscribeChunks(store, whisperClient, job, wavInfo, windows, policy)
+	} else {
+		err = runJob(r.Context(), store, whisperClient, job, webhook, policy)
+		if err != nil {
+			cancelDiarization(context.WithoutCancel(r.Context()), job)
+			writeBackendError(w, err)
+			return
+		}
+	}
+
 	resBody, err := json.Marshal(StartTranscriptionResponse{
-		JobId: res.JobId,
+		JobId: job.ID,
 	})
 	if err != nil {
 		slog.Error("Failed to marshal response", "error", err)
@@ -72,6 +232,198 @@ func StartTranscription(w http.ResponseWriter, r *http.Request) {
 	w.Write(resBody)
 }
 
+// startDiarization starts diarizing the audio of job and records the
+// diarization on it. If the diarization cannot be started, the job is marked
+// as failed.
+func startDiarization(ctx context.Context, store jobs.Store, diarizer *diarize.RunpodDiarizer, job *jobs.Job) (*jobs.Job, error) {
+	diarizationID, err := diarizer.Start(ctx, job.Input.AudioURL)
+	if err != nil {
+		slog.Error("Failed to start diarization", "jobId", job.ID, "error", err)
+		_, updateErr := store.UpdateStatus(context.WithoutCancel(ctx), job.ID, jobs.StatusUpdate{Status: jobs.StatusFailed, Error: err.Error()})
+		if updateErr != nil && !errors.Is(updateErr, jobs.ErrJobFinished) {
+			slog.Error("Failed to mark job as failed", "jobId", job.ID, "error", updateErr)
+		}
+		return nil, err
+	}
+
+	updated, err := store.UpdateStatus(ctx, job.ID, jobs.StatusUpdate{DiarizationID: diarizationID})
+	if err != nil {
+		slog.Error("Failed to record diarization", "jobId", job.ID, "diarizationId", diarizationID, "error", err)
+		cancelErr := diarizer.Cancel(context.WithoutCancel(ctx), diarizationID)
+		if cancelErr != nil {
+			slog.Error("Failed to cancel diarization", "jobId", job.ID, "diarizationId", diarizationID, "error", cancelErr)
+		}
+		return nil, err
+	}
+	return updated, nil
+}
+
+// cancelDiarization cancels the diarization of a job that failed, if it has
+// one, so that it does not keep running for nothing.
+func cancelDiarization(ctx context.Context, job *jobs.Job) {
+	if job.DiarizationID == "" {
+		return
+	}
+	diarizer, err := getDiarizer()
+	if err == nil {
+		err = diarizer.Cancel(ctx, job.DiarizationID)
+	}
+	if err != nil {
+		slog.Error("Failed to cancel diarization", "jobId", job.ID, "diarizationId", job.DiarizationID, "error", err)
+	}
+}
+
+// runJob submits job to RunPod and records the RunPod job it was given. If
+// the job cannot be submitted, it is marked as failed. If the job finished,
+// e.g. because it was cancelled, while it was being submitted, the RunPod job
+// is cancelled again.
+func runJob(ctx context.Context, store jobs.Store, whisperClient whisper.Transcriber, job *jobs.Job, webhook *runpod.WebHook, policy runpod.ExecutionPolicy) error {
+	res, err := whisperClient.Run(ctx, job.Input, webhook, &policy, nil)
+	if err != nil {
+		slog.Error("Failed to run Whisper", "jobId", job.ID, "error", err)
+		// The job is marked even if it failed because ctx was cancelled.
+		_, updateErr := store.UpdateStatus(context.WithoutCancel(ctx), job.ID, jobs.StatusUpdate{Status: jobs.StatusFailed, Error: err.Error()})
+		if updateErr != nil && !errors.Is(updateErr, jobs.ErrJobFinished) {
+			slog.Error("Failed to mark job as failed", "jobId", job.ID, "error", updateErr)
+		}
+		return err
+	}
+	slog.Info("Received response from WhisperRun", "jobId", job.ID, "response", res)
+
+	_, err = store.UpdateStatus(ctx, job.ID, jobs.StatusUpdate{RunpodID: res.JobId, Status: res.Status})
+	if errors.Is(err, jobs.ErrJobFinished) {
+		slog.Info("Job finished while it was submitted, cancelling RunPod job", "jobId", job.ID, "runpodId", res.JobId)
+		_, err = whisperClient.Cancel(context.WithoutCancel(ctx), res.JobId)
+		if err != nil {
+			slog.Error("Failed to cancel RunPod job", "jobId", job.ID, "runpodId", res.JobId, "error", err)
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		slog.Error("Failed to update job", "jobId", job.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// presignAudioURL checks that the object at key exists and returns a URL
+// RunPod can download it from for the given duration. The returned status is
+// the HTTP status to respond with if err is not nil.
+func presignAudioURL(ctx context.Context, key string, duration time.Duration) (string, int, error) {
+	store, err := storage.GetObjectStore()
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+
+	_, err = store.Stat(ctx, key)
+	if errors.Is(err, objectstore.ErrObjectNotExist) {
+		return "", http.StatusNotFound, err
+	}
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+
+	audioURL, err := store.PresignGet(ctx, key, duration)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	return audioURL, http.StatusOK, nil
+}
+
+// newWebhook registers a RunPod webhook for job if PUBLIC_BASE_URL is set, so
+// that the job is updated as soon as it finishes instead of on the next poll.
+// It must be called before the job is created.
+func newWebhook(job *jobs.Job) (*runpod.WebHook, error) {
+	baseURL := os.Getenv("PUBLIC_BASE_URL")
+	if baseURL == "" {
+		return nil, nil
+	}
+
+	token, err := jobs.NewWebhookToken(job)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := runpod.WebHook(strings.TrimSuffix(baseURL, "/") + "/webhooks/runpod/" + token)
+	return &webhook, nil
+}
+
+// getJob loads the job named in the request path and brings its status up to
+// date with RunPod.
+func getJob(w http.ResponseWriter, r *http.Request) (*jobs.Job, jobs.Store, bool) {
+	job, store, ok := loadJob(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	job, err := syncJob(r.Context(), store, job)
+	if err != nil {
+		slog.Error("Failed to refresh job", "error", err)
+		writeBackendError(w, err)
+		return nil, nil, false
+	}
+
+	return job, store, true
+}
+
+// loadJob loads the job named in the request path as it was last recorded.
+func loadJob(w http.ResponseWriter, r *http.Request) (*jobs.Job, jobs.Store, bool) {
+	jobId := r.PathValue("job_id")
+	if jobId == "" {
+		slog.Error("job_id is required")
+		http.Error(w, "job_id is required", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	store, err := jobs.GetStore()
+	if err != nil {
+		slog.Error("Failed to get job store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	job, err := store.Get(r.Context(), jobId)
+	if err == nil && job.Owner != auth.UserFromContext(r.Context()).ID {
+		// Don't reveal that other users' jobs exist.
+		err = jobs.ErrJobNotFound
+	}
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		slog.Error("Failed to get job", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	return job, store, true
+}
+
+// syncJob brings the status of job up to date with the transcriber and, if
+// it is being diarized, the diarizer.
+func syncJob(ctx context.Context, store jobs.Store, job *jobs.Job) (*jobs.Job, error) {
+	if jobs.IsTerminal(job.Status) {
+		return job, nil
+	}
+
+	whisperClient, err := whisper.GetTranscriber()
+	if err != nil {
+		return nil, err
+	}
+
+	var diarizer diarize.Diarizer
+	if job.DiarizationID != "" {
+		diarizer, err = getDiarizer()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return jobs.Sync(ctx, store, whisperClient, diarizer, job)
+}
+
 type GetTranscriptionStatusResponse struct {
 	Status        string `json:"status"`
 	DelayTime     int    `json:"delay_time,omitempty"`
@@ -79,31 +431,54 @@ type GetTranscriptionStatusResponse struct {
 }
 
 func GetTranscriptionStatus(w http.ResponseWriter, r *http.Request) {
-	whisperClient, err := getRunpodWhisperClient()
-	if err != nil {
-		slog.Error("Failed to get RunpodWhisperClient", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	job, _, ok := getJob(w, r)
+	if !ok {
 		return
 	}
 
-	jobId := r.PathValue("job_id")
-	if jobId == "" {
-		slog.Error("job_id is required")
-		http.Error(w, "job_id is required", http.StatusBadRequest)
+	resBody := GetTranscriptionStatusResponse{
+		Status:        job.Status,
+		DelayTime:     job.DelayTime,
+		ExecutionTime: job.ExecutionTime,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resBody)
+}
+
+// CancelTranscription cancels a job and, if it was chunked, its child jobs,
+// and responds with its status. Jobs that have already finished cannot be
+// cancelled.
+func CancelTranscription(w http.ResponseWriter, r *http.Request) {
+	job, store, ok := loadJob(w, r)
+	if !ok {
 		return
 	}
 
-	status, err := whisperClient.Status(jobId)
+	whisperClient, err := whisper.GetTranscriber()
 	if err != nil {
-		slog.Error("Failed to get status", "error", err)
+		slog.Error("Failed to get transcriber", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	job, err = jobs.Cancel(r.Context(), store, whisperClient, job)
+	if errors.Is(err, jobs.ErrJobFinished) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to cancel job", "error", err)
+		writeBackendError(w, err)
+		return
+	}
+	slog.Info("Cancelled job", "jobId", job.ID)
+
 	resBody := GetTranscriptionStatusResponse{
-		Status:        status.Status,
-		DelayTime:     status.DelayTime,
-		ExecutionTime: status.ExecutionTime,
+		Status:        job.Status,
+		DelayTime:     job.DelayTime,
+		ExecutionTime: job.ExecutionTime,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -115,29 +490,48 @@ type GetTranscriptionResultResponse struct {
 	Output whisper.WhisperOutput `json:"output"`
 }
 
+// GetTranscriptionResult returns the result of a job as JSON, or, if the
+// format query parameter is set, as a transcript file in that format.
 func GetTranscriptionResult(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Getting transcription result")
-	whisperClient, err := getRunpodWhisperClient()
-	if err != nil {
-		slog.Error("Failed to get RunpodWhisperClient", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	job, store, ok := getJob(w, r)
+	if !ok {
 		return
 	}
 
-	jobId := r.PathValue("job_id")
-	if jobId == "" {
-		slog.Error("job_id is required")
-		http.Error(w, "job_id is required", http.StatusBadRequest)
+	switch job.Status {
+	case jobs.StatusComplete:
+		break
+	case jobs.StatusCanceled:
+		err := whisper.ErrJobCancelled
+		slog.Info("Job was cancelled", "jobId", job.ID)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case jobs.StatusFailed, jobs.StatusTimeout:
+		err := &whisper.ErrJobFailed{Status: job.Status}
+		slog.Error("Failed to get result", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	default:
+		err := whisper.JobInProgress
+		slog.Error("Failed to get result", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	result, err := whisperClient.Result(jobId)
+	result, err := store.GetResult(r.Context(), job.ID)
 	if err != nil {
 		slog.Error("Failed to get result", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	format := r.URL.Query().Get("format")
+	if format != "" {
+		writeTranscript(w, job.ID, format, result)
+		return
+	}
+
 	resBody := GetTranscriptionResultResponse{
 		Output: *result,
 	}
@@ -147,3 +541,84 @@ func GetTranscriptionResult(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(resBody)
 }
+
+type RenameSpeakersRequest struct {
+	// Speakers maps current speaker labels to new ones, which must be valid
+	// according to diarize.ValidateName.
+	Speakers map[string]string `json:"speakers"`
+}
+
+// RenameSpeakers relabels the speakers in the result of a completed job.
+func RenameSpeakers(w http.ResponseWriter, r *http.Request) {
+	var req RenameSpeakersRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		slog.Error("Failed to decode request body", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Speakers) == 0 {
+		http.Error(w, "speakers is required", http.StatusBadRequest)
+		return
+	}
+	for _, name := range req.Speakers {
+		err = diarize.ValidateName(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, store, ok := getJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != jobs.StatusComplete {
+		slog.Error("Failed to rename speakers", "jobId", job.ID, "status", job.Status)
+		http.Error(w, "job has not completed", http.StatusConflict)
+		return
+	}
+
+	result, err := store.GetResult(r.Context(), job.ID)
+	if err != nil {
+		slog.Error("Failed to get result", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	diarize.Rename(result.Segments, req.Speakers)
+	err = store.SaveResult(r.Context(), job.ID, result)
+	if err != nil {
+		slog.Error("Failed to save result", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(GetTranscriptionResultResponse{Output: *result})
+}
+
+// writeTranscript renders result as a downloadable transcript file.
+func writeTranscript(w http.ResponseWriter, jobId string, format string, result *whisper.WhisperOutput) {
+	contentType, err := transcript.ContentType(format)
+	if err != nil {
+		slog.Error("Failed to render transcript", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = transcript.Render(&buf, format, result)
+	if err != nil {
+		slog.Error("Failed to render transcript", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Writing transcript to client", "jobId", jobId, "format", format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": jobId + "." + format}))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
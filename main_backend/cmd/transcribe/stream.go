@@ -0,0 +1,162 @@
+package transcribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+const DEFAULT_STREAM_POLL_INTERVAL = time.Second
+
+type StreamStatusEvent struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type StreamErrorEvent struct {
+	Error string `json:"error"`
+}
+
+// eventStream writes Server-Sent Events.
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *eventStream) send(event string, data any) error {
+	return s.sendWithID("", event, data)
+}
+
+// sendWithID sends an event with an id, which the client sends back in
+// Last-Event-ID when it reconnects.
+func (s *eventStream) sendWithID(id string, event string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		_, err = fmt.Fprintf(s.w, "id: %s\n", id)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, body)
+	if err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// StreamTranscription sends the progress of a job as Server-Sent Events:
+//   - status, a StreamStatusEvent, whenever the job's status changes
+//   - segment, a whisper.Segment, for each segment of the transcript in order
+//   - done, a StreamStatusEvent, once the job has finished, ending the stream
+//   - error, a StreamErrorEvent, if the job can no longer be followed
+//
+// Segments are sent as they are transcribed if the transcriber can stream
+// them, and otherwise when the job completes. The result of the job is the
+// final transcript, which need not be split into the same segments as the
+// streamed ones, so on completion only its segments that end after the last
+// streamed segment are sent. Speakers are set only on those.
+//
+// The job's status is kept up to date by the job poller, so only partial
+// segments are requested from the transcriber. STREAM_POLL_INTERVAL overrides
+// how often the job is checked.
+func StreamTranscription(w http.ResponseWriter, r *http.Request) {
+	job, store, ok := loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	stream := &eventStream{w: w, rc: http.NewResponseController(w)}
+	err := stream.rc.Flush()
+	if err != nil {
+		slog.Error("Failed to start event stream", "jobId", job.ID, "error", err)
+		return
+	}
+
+	transcriber, err := whisper.GetTranscriber()
+	if err != nil {
+		slog.Error("Failed to get transcriber", "error", err)
+		stream.send("error", StreamErrorEvent{Error: err.Error()})
+		return
+	}
+	streamer, canStream := transcriber.(whisper.Streamer)
+
+	ticker := time.NewTicker(utils.GetEnvDuration("STREAM_POLL_INTERVAL", DEFAULT_STREAM_POLL_INTERVAL))
+	defer ticker.Stop()
+
+	// streamedEnd is where the last streamed segment ends, in seconds.
+	streamedEnd := 0.0
+	lastStatus := ""
+	for {
+		if job.Status != lastStatus {
+			lastStatus = job.Status
+			err = stream.send("status", StreamStatusEvent{Status: job.Status, Error: job.Error})
+			if err != nil {
+				return
+			}
+		}
+		if jobs.IsTerminal(job.Status) {
+			break
+		}
+
+		// Chunked jobs are transcribed by their child jobs, so they are only
+		// sent on completion.
+		if canStream && job.RunpodID != "" && job.Chunks == 0 {
+			partial, err := streamer.Stream(r.Context(), job.RunpodID)
+			if err != nil {
+				slog.Warn("Failed to stream job", "jobId", job.ID, "error", err)
+			} else {
+				for _, segment := range partial.Segments {
+					err = stream.send("segment", segment)
+					if err != nil {
+						return
+					}
+					streamedEnd = max(streamedEnd, segment.End)
+				}
+			}
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		job, err = store.Get(r.Context(), job.ID)
+		if err != nil {
+			slog.Error("Failed to get job", "error", err)
+			stream.send("error", StreamErrorEvent{Error: err.Error()})
+			return
+		}
+	}
+
+	if job.Status == jobs.StatusComplete {
+		result, err := store.GetResult(r.Context(), job.ID)
+		if err != nil {
+			slog.Error("Failed to get result", "error", err)
+			stream.send("error", StreamErrorEvent{Error: err.Error()})
+			return
+		}
+		for _, segment := range result.Segments {
+			if segment.End <= streamedEnd {
+				continue
+			}
+			err = stream.send("segment", segment)
+			if err != nil {
+				return
+			}
+		}
+	}
+	stream.send("done", StreamStatusEvent{Status: job.Status, Error: job.Error})
+}
@@ -3,23 +3,43 @@ package upload
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
-	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/gcloud"
-	"github.com/google/uuid"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/media"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/storage"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/uploads"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
 )
 
 const PRESIGNED_URL_DURATION = 15 * time.Minute
 
+// getSessionDuration returns how long clients have to finish an upload,
+// which UPLOAD_SESSION_DURATION overrides.
+var getSessionDuration = sync.OnceValue(func() time.Duration {
+	return utils.GetEnvDuration("UPLOAD_SESSION_DURATION", uploads.DefaultSessionDuration)
+})
+
 type StartUploadRequest struct {
 	Filename      string `json:"filename"`
 	FileSizeBytes int    `json:"file_size_bytes"`
 }
 
+// StartUploadResponse tells the client how to split the file: into NumParts
+// parts of PartSizeBytes, the last of which holds the rest of the file.
 type StartUploadResponse struct {
-	UploadID string `json:"upload_id"`
-	NumParts int    `json:"num_parts"`
+	UploadID      string `json:"upload_id"`
+	NumParts      int    `json:"num_parts"`
+	PartSizeBytes int64  `json:"part_size_bytes"`
+	// Key is the key the object will be stored under once the upload is
+	// complete.
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 func StartMultipartUpload(w http.ResponseWriter, r *http.Request) {
@@ -35,12 +55,59 @@ func StartMultipartUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uploadID := uuid.New().String()
-	numParts := calculateNumParts(req.FileSizeBytes)
+	if req.Filename == "" || req.FileSizeBytes <= 0 {
+		http.Error(w, "filename and a positive file_size_bytes are required", http.StatusBadRequest)
+		return
+	}
+
+	store, err := storage.GetObjectStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := uploads.GetStore()
+	if err != nil {
+		slog.Error("Failed to get upload session store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user := auth.UserFromContext(r.Context())
+	key := auth.ScopeKey(user, req.Filename)
+	uploadID, err := objectstore.StartMultipartUpload(r.Context(), store, key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	numParts, partSizeBytes := uploads.PlanParts(int64(req.FileSizeBytes))
+	now := time.Now()
+	session := &uploads.Session{
+		ID:            uploadID,
+		Owner:         user.ID,
+		Key:           key,
+		Filename:      req.Filename,
+		FileSizeBytes: int64(req.FileSizeBytes),
+		NumParts:      numParts,
+		PartSizeBytes: partSizeBytes,
+		Status:        uploads.StatusUploading,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(getSessionDuration()),
+	}
+	err = sessions.Create(r.Context(), session)
+	if err != nil {
+		slog.Error("Failed to create upload session", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	resp := StartUploadResponse{
-		UploadID: uploadID,
-		NumParts: numParts,
+		UploadID:      session.ID,
+		NumParts:      session.NumParts,
+		PartSizeBytes: session.PartSizeBytes,
+		Key:           session.Key,
+		ExpiresAt:     session.ExpiresAt,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -48,25 +115,20 @@ func StartMultipartUpload(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func calculateNumParts(fileSizeBytes int) int {
-	partSize := 64 * 1024 * 1024 // 64 MB
-	numParts := fileSizeBytes / partSize
-	if numParts == 0 {
-		return 1
-	}
-	if numParts > 32 {
-		return 32
-	}
-	return numParts
-}
-
+// CreateUploadURLRequest declares the checksum of the part to be uploaded.
+// Its CRC32C is required, its MD5 optional.
 type CreateUploadURLRequest struct {
-	UploadID   string `json:"upload_id"`
-	PartNumber int    `json:"part_number"`
+	UploadID   string               `json:"upload_id"`
+	PartNumber int                  `json:"part_number"`
+	Checksum   objectstore.Checksum `json:"checksum"`
 }
 
+// CreateUploadURLResponse holds the URL to PUT the part to, and the headers
+// that must be sent with it. The store rejects the part unless it matches the
+// checksum in the headers.
 type CreateUploadURLResponse struct {
-	URL string `json:"url"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
 }
 
 func CreateUploadURL(w http.ResponseWriter, r *http.Request) {
@@ -77,12 +139,50 @@ func CreateUploadURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.UploadID == "" || req.PartNumber < 0 || req.PartNumber >= 32 { // TODO: make this a constant
-		http.Error(w, "Invalid upload_id or part_number", http.StatusBadRequest)
+	session, ok := openSession(w, r, req.UploadID)
+	if !ok {
 		return
 	}
 
-	url, err := gcloud.GetUploadPartURL(context.Background(), req.UploadID, req.PartNumber, PRESIGNED_URL_DURATION)
+	err = session.CheckPart(req.PartNumber)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Checksum.CRC32C == "" {
+		http.Error(w, "checksum.crc32c is required", http.StatusBadRequest)
+		return
+	}
+	err = req.Checksum.Validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store, err := storage.GetObjectStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := uploads.GetStore()
+	if err != nil {
+		slog.Error("Failed to get upload session store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The checksum is recorded before the URL is handed out, so a part can
+	// never be uploaded against a checksum the session does not know about.
+	err = sessions.SetPartChecksum(r.Context(), session.ID, req.PartNumber, req.Checksum)
+	if err != nil {
+		slog.Error("Failed to record part checksum", "uploadID", session.ID, "partNumber", req.PartNumber, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url, headers, err := objectstore.GetUploadPartURLWithChecksum(r.Context(), store, req.UploadID, req.PartNumber, PRESIGNED_URL_DURATION, req.Checksum)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -90,9 +190,65 @@ func CreateUploadURL(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(CreateUploadURLResponse{URL: url})
+	json.NewEncoder(w).Encode(CreateUploadURLResponse{URL: url, Headers: headers})
 }
 
+type ListUploadedPartsResponse struct {
+	UploadID string             `json:"upload_id"`
+	NumParts int                `json:"num_parts"`
+	Parts    []objectstore.Part `json:"parts"`
+	// Missing lists the part numbers that still have to be uploaded.
+	Missing []int `json:"missing"`
+}
+
+// ListUploadedParts reports which parts of an upload are already stored, so
+// an interrupted upload can be resumed by uploading only the missing parts.
+func ListUploadedParts(w http.ResponseWriter, r *http.Request) {
+	session, ok := openSession(w, r, r.PathValue("upload_id"))
+	if !ok {
+		return
+	}
+
+	store, err := storage.GetObjectStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	parts, err := objectstore.ListUploadedParts(r.Context(), store, session.ID)
+	if err != nil {
+		slog.Error("Failed to list uploaded parts", "uploadID", session.ID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := ListUploadedPartsResponse{
+		UploadID: session.ID,
+		NumParts: session.NumParts,
+		Parts:    []objectstore.Part{},
+		Missing:  []int{},
+	}
+	uploaded := make(map[int]bool)
+	for _, part := range parts {
+		if session.CheckPart(part.PartNumber) != nil {
+			continue
+		}
+		uploaded[part.PartNumber] = true
+		resp.Parts = append(resp.Parts, part)
+	}
+	for partNumber := 0; partNumber < session.NumParts; partNumber++ {
+		if !uploaded[partNumber] {
+			resp.Missing = append(resp.Missing, partNumber)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CompleteMultipartUploadRequest identifies an upload by its ID. Key and
+// NumParts are optional, but must match the upload session if given.
 type CompleteMultipartUploadRequest struct {
 	Key      string `json:"key"`
 	UploadID string `json:"upload_id"`
@@ -107,12 +263,177 @@ func CompleteMultipartUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = gcloud.CompleteMultipartUpload(context.Background(), req.Key, req.UploadID, req.NumParts)
+	session, ok := openSession(w, r, req.UploadID)
+	if !ok {
+		return
+	}
+
+	user := auth.UserFromContext(r.Context())
+	if req.Key != "" && auth.ScopeKey(user, req.Key) != session.Key {
+		http.Error(w, "key does not match upload session", http.StatusBadRequest)
+		return
+	}
+	if req.NumParts != 0 && req.NumParts != session.NumParts {
+		http.Error(w, "num_parts does not match upload session", http.StatusBadRequest)
+		return
+	}
+
+	store, err := storage.GetObjectStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := uploads.GetStore()
+	if err != nil {
+		slog.Error("Failed to get upload session store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Claim the session, so that it is only completed once and the janitor
+	// does not abort it meanwhile.
+	err = sessions.TransitionStatus(r.Context(), session.ID, uploads.StatusUploading, uploads.StatusCompleting)
+	if errors.Is(err, uploads.ErrSessionClosed) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to claim upload session", "uploadID", session.ID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Until its parts are composed, the upload can still be retried, so the
+	// session is reopened if completing it fails.
+	reopen := func() {
+		err := sessions.TransitionStatus(context.WithoutCancel(r.Context()), session.ID, uploads.StatusCompleting, uploads.StatusUploading)
+		if err != nil {
+			slog.Error("Failed to reopen upload session", "uploadID", session.ID, "error", err)
+		}
+	}
+
+	declared, err := sessions.ListPartChecksums(r.Context(), session.ID)
+	if err != nil {
+		slog.Error("Failed to list part checksums", "uploadID", session.ID, "error", err)
+		reopen()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	parts, err := objectstore.ListUploadedParts(r.Context(), store, session.ID)
+	if err != nil {
+		slog.Error("Failed to list uploaded parts", "uploadID", session.ID, "error", err)
+		reopen()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Parts that are missing or wrong can still be uploaded again.
+	err = session.VerifyParts(parts, declared)
+	if err != nil {
+		reopen()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = objectstore.CompleteMultipartUpload(r.Context(), store, session.Key, session.ID, session.NumParts)
 	if err != nil {
+		reopen()
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// The parts are gone once they have been composed, so from here on the
+	// session is always closed. An upload of the wrong size or content, one
+	// that cannot be verified, or one we cannot transcribe cannot be fixed
+	// and has to be started over.
+	ctx := context.WithoutCancel(r.Context())
+	verifyStatus := http.StatusBadRequest
+	attrs, verifyErr := store.Stat(ctx, session.Key)
+	if verifyErr != nil {
+		slog.Error("Failed to stat uploaded object", "key", session.Key, "error", verifyErr)
+		verifyStatus = http.StatusInternalServerError
+	} else {
+		verifyErr = session.VerifyObject(attrs, declared)
+	}
+
+	var info *media.Info
+	if verifyErr == nil {
+		info, err = media.ProbeObject(ctx, store, session.Key)
+		switch {
+		case errors.Is(err, media.ErrUnsupported), errors.Is(err, media.ErrCorrupt):
+			verifyErr = err
+			verifyStatus = http.StatusUnsupportedMediaType
+		case err != nil:
+			// The upload is kept without media info, which is probed again
+			// when it is transcribed.
+			slog.Error("Failed to probe uploaded object", "key", session.Key, "error", err)
+		}
+	}
+
+	status := uploads.StatusComplete
+	if verifyErr != nil {
+		status = uploads.StatusAborted
+		err = store.Delete(ctx, session.Key)
+		if err != nil {
+			slog.Error("Failed to delete uploaded object", "key", session.Key, "error", err)
+		}
+	} else if info != nil {
+		err = sessions.SetMedia(ctx, session.ID, info)
+		if err != nil {
+			slog.Error("Failed to store media info", "uploadID", session.ID, "error", err)
+		}
+	}
+
+	err = sessions.TransitionStatus(ctx, session.ID, uploads.StatusCompleting, status)
+	if err != nil {
+		slog.Error("Failed to update upload session", "uploadID", session.ID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if verifyErr != nil {
+		http.Error(w, verifyErr.Error(), verifyStatus)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(struct{}{})
+	json.NewEncoder(w).Encode(CompleteMultipartUploadResponse{Key: session.Key, Media: info})
+}
+
+type CompleteMultipartUploadResponse struct {
+	Key   string      `json:"key"`
+	Media *media.Info `json:"media"`
+}
+
+// openSession returns the upload session for uploadID if the current user may
+// still upload to it, or writes an error response.
+func openSession(w http.ResponseWriter, r *http.Request, uploadID string) (*uploads.Session, bool) {
+	if uploadID == "" {
+		http.Error(w, objectstore.ErrInvalidUploadID.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	sessions, err := uploads.GetStore()
+	if err != nil {
+		slog.Error("Failed to get upload session store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	session, err := uploads.Open(r.Context(), sessions, auth.UserFromContext(r.Context()).ID, uploadID, time.Now())
+	switch {
+	case errors.Is(err, uploads.ErrSessionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	case errors.Is(err, uploads.ErrSessionExpired), errors.Is(err, uploads.ErrSessionClosed):
+		http.Error(w, err.Error(), http.StatusGone)
+		return nil, false
+	case err != nil:
+		slog.Error("Failed to get upload session", "uploadID", uploadID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return session, true
 }
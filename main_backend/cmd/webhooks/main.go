@@ -0,0 +1,98 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+// RunpodWebhook receives RunPod's completion callback for a job. RunPod
+// retries the callback if it does not get a 200, so requests for jobs that
+// have already finished are acknowledged without doing anything.
+func RunpodWebhook(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	jobId, err := jobs.ParseWebhookToken(token)
+	if err != nil {
+		slog.Error("Received webhook with malformed token")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	store, err := jobs.GetStore()
+	if err != nil {
+		slog.Error("Failed to get job store", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	job, err := store.Get(r.Context(), jobId)
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		slog.Error("Received webhook for unknown job", "jobId", jobId)
+		http.Error(w, jobs.ErrInvalidWebhookToken.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to get job", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = jobs.VerifyWebhookToken(job, token)
+	if err != nil {
+		slog.Error("Received webhook with invalid token", "jobId", jobId)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var payload runpod.StatusResponse
+	defer r.Body.Close()
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		slog.Error("Failed to decode webhook payload", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.JobId != job.RunpodID {
+		slog.Error("Webhook payload does not match job", "jobId", jobId, "runpodId", payload.JobId)
+		http.Error(w, "webhook payload does not match job", http.StatusBadRequest)
+		return
+	}
+	slog.Info("Received RunPod webhook", "jobId", jobId, "status", payload.Status)
+
+	status := &whisper.WhisperJobStatus{
+		Status:        payload.Status,
+		Error:         payload.Error,
+		DelayTime:     payload.DelayTime,
+		ExecutionTime: payload.ExecutionTime,
+	}
+
+	var output *whisper.WhisperOutput
+	switch payload.Status {
+	case runpod.StatusComplete:
+		output, err = whisper.DecodeOutput(payload.Output)
+		if err != nil {
+			slog.Error("Failed to decode webhook output", "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case runpod.StatusQueue, runpod.StatusProgress, runpod.StatusFailed, runpod.StatusCanceled, runpod.StatusTimeout:
+	default:
+		slog.Error("Unexpected status in webhook payload", "status", payload.Status)
+		http.Error(w, "unexpected status: "+payload.Status, http.StatusBadRequest)
+		return
+	}
+
+	_, err = jobs.Apply(r.Context(), store, job, status, output)
+	if err != nil {
+		slog.Error("Failed to apply webhook", "jobId", jobId, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
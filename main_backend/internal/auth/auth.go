@@ -0,0 +1,242 @@
+// Package auth manages user accounts and authenticates requests with API keys
+// and session tokens.
+//
+// API keys and session tokens are random bearer tokens. Only their SHA-256
+// hashes are stored, so a leaked database does not leak credentials.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	DefaultSessionDuration = 7 * 24 * time.Hour
+
+	MinPasswordLength = 8
+
+	apiKeyPrefix  = "tmk_"
+	sessionPrefix = "tms_"
+)
+
+var (
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrPasswordTooShort   = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	ErrEmailTaken         = errors.New("email address is already registered")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrUnauthenticated    = errors.New("missing or invalid credentials")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrInvalidPlan        = errors.New("invalid plan")
+)
+
+// Plans a user can be on. New users are on PlanFree, and admins move them
+// between plans with SetPlan.
+const (
+	PlanFree = "free"
+	PlanPaid = "paid"
+)
+
+type User struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Plan      string    `json:"plan"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type APIKey struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store persists users and their credentials. Tokens are passed to the store
+// already hashed.
+type Store interface {
+	// CreateUser returns ErrEmailTaken if the email is already registered.
+	CreateUser(ctx context.Context, user *User, passwordHash string) error
+	// GetUserByEmail returns ErrUserNotFound if no user has the email.
+	GetUserByEmail(ctx context.Context, email string) (user *User, passwordHash string, err error)
+	// SetPlan returns ErrUserNotFound if there is no user with the id.
+	SetPlan(ctx context.Context, userID string, plan string) error
+	CreateAPIKey(ctx context.Context, key *APIKey, tokenHash string) error
+	ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+	// DeleteAPIKey returns ErrAPIKeyNotFound if the user has no such key.
+	DeleteAPIKey(ctx context.Context, userID string, id string) error
+	CreateSession(ctx context.Context, userID string, tokenHash string, expiresAt time.Time) error
+	DeleteSession(ctx context.Context, tokenHash string) error
+	// UserForToken returns the user an API key or unexpired session token
+	// belongs to, or ErrUnauthenticated.
+	UserForToken(ctx context.Context, tokenHash string, now time.Time) (*User, error)
+}
+
+// GetStore returns the account store kept in the shared database.
+var GetStore = sync.OnceValues(func() (Store, error) {
+	db, err := database.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+})
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken(prefix string) (string, error) {
+	tokenBytes := make([]byte, 32)
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(tokenBytes), nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" || domain == "" || strings.ContainsAny(email, " \t\r\n") {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// Register creates a user with the given email and password.
+func Register(ctx context.Context, store Store, email string, password string) (*User, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if len(password) < MinPasswordLength {
+		return nil, ErrPasswordTooShort
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &User{
+		ID:        uuid.New().String(),
+		Email:     email,
+		Plan:      PlanFree,
+		CreatedAt: time.Now(),
+	}
+	err = store.CreateUser(ctx, user, string(passwordHash))
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetPlan moves the user with the given email to plan, and returns the
+// updated user.
+func SetPlan(ctx context.Context, store Store, email string, plan string) (*User, error) {
+	if plan != PlanFree && plan != PlanPaid {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPlan, plan)
+	}
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	user, _, err := store.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	err = store.SetPlan(ctx, user.ID, plan)
+	if err != nil {
+		return nil, err
+	}
+	user.Plan = plan
+	return user, nil
+}
+
+// Login checks a user's password and starts a session lasting duration. It
+// returns the session token and when it expires.
+func Login(ctx context.Context, store Store, email string, password string, duration time.Duration) (string, time.Time, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	user, passwordHash, err := store.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password))
+	if err != nil {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	token, err := newToken(sessionPrefix)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(duration)
+	err = store.CreateSession(ctx, user.ID, hashToken(token), expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// Logout ends the session with the given token. It does nothing for API keys,
+// which must be deleted explicitly.
+func Logout(ctx context.Context, store Store, token string) error {
+	if !strings.HasPrefix(token, sessionPrefix) {
+		return nil
+	}
+	return store.DeleteSession(ctx, hashToken(token))
+}
+
+// NewAPIKey creates an API key for a user. The returned token is the only
+// copy of the key; it cannot be recovered later.
+func NewAPIKey(ctx context.Context, store Store, userID string, name string) (string, *APIKey, error) {
+	token, err := newToken(apiKeyPrefix)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := &APIKey{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+	err = store.CreateAPIKey(ctx, key, hashToken(token))
+	if err != nil {
+		return "", nil, err
+	}
+	return token, key, nil
+}
+
+// Authenticate returns the user an API key or session token belongs to, or
+// ErrUnauthenticated.
+func Authenticate(ctx context.Context, store Store, token string) (*User, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	return store.UserForToken(ctx, hashToken(token), time.Now())
+}
@@ -0,0 +1,229 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+)
+
+func newTestStore(t *testing.T) *auth.SQLiteStore {
+	store, err := auth.NewSQLiteStore(database.OpenTest(t))
+	if err != nil {
+		t.Fatalf("Failed to create account store: %v", err)
+	}
+	return store
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	user, err := auth.Register(ctx, store, " Ada@Example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if user.Email != "ada@example.com" {
+		t.Fatalf("Email was not normalized: %q", user.Email)
+	}
+
+	_, err = auth.Register(ctx, store, "ada@example.com", "another password")
+	if !errors.Is(err, auth.ErrEmailTaken) {
+		t.Fatalf("Expected ErrEmailTaken, got %v", err)
+	}
+	_, err = auth.Register(ctx, store, "not an email", "correct horse")
+	if !errors.Is(err, auth.ErrInvalidEmail) {
+		t.Fatalf("Expected ErrInvalidEmail, got %v", err)
+	}
+	_, err = auth.Register(ctx, store, "bob@example.com", "short")
+	if !errors.Is(err, auth.ErrPasswordTooShort) {
+		t.Fatalf("Expected ErrPasswordTooShort, got %v", err)
+	}
+
+	_, _, err = auth.Login(ctx, store, "ada@example.com", "wrong password", time.Hour)
+	if !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	_, _, err = auth.Login(ctx, store, "nobody@example.com", "correct horse", time.Hour)
+	if !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+
+	token, _, err := auth.Login(ctx, store, "ADA@example.com", "correct horse", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	authenticated, err := auth.Authenticate(ctx, store, token)
+	if err != nil {
+		t.Fatalf("Failed to authenticate session: %v", err)
+	}
+	if authenticated.ID != user.ID {
+		t.Fatalf("Session authenticated as %s, expected %s", authenticated.ID, user.ID)
+	}
+
+	err = auth.Logout(ctx, store, token)
+	if err != nil {
+		t.Fatalf("Failed to log out: %v", err)
+	}
+	_, err = auth.Authenticate(ctx, store, token)
+	if !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("Expected ErrUnauthenticated after logout, got %v", err)
+	}
+
+	expired, _, err := auth.Login(ctx, store, "ada@example.com", "correct horse", -time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	_, err = auth.Authenticate(ctx, store, expired)
+	if !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("Expected ErrUnauthenticated for expired session, got %v", err)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	user, err := auth.Register(ctx, store, "ada@example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	token, key, err := auth.NewAPIKey(ctx, store, user.ID, "laptop")
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	authenticated, err := auth.Authenticate(ctx, store, token)
+	if err != nil {
+		t.Fatalf("Failed to authenticate API key: %v", err)
+	}
+	if authenticated.ID != user.ID {
+		t.Fatalf("API key authenticated as %s, expected %s", authenticated.ID, user.ID)
+	}
+
+	keys, err := store.ListAPIKeys(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list API keys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].ID != key.ID || keys[0].Name != "laptop" {
+		t.Fatalf("Unexpected API keys: %+v", keys)
+	}
+
+	err = store.DeleteAPIKey(ctx, "someone-else", key.ID)
+	if !errors.Is(err, auth.ErrAPIKeyNotFound) {
+		t.Fatalf("Expected ErrAPIKeyNotFound deleting another user's key, got %v", err)
+	}
+	err = store.DeleteAPIKey(ctx, user.ID, key.ID)
+	if err != nil {
+		t.Fatalf("Failed to delete API key: %v", err)
+	}
+	_, err = auth.Authenticate(ctx, store, token)
+	if !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("Expected ErrUnauthenticated for deleted key, got %v", err)
+	}
+}
+
+func TestSetPlan(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	user, err := auth.Register(ctx, store, "ada@example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if user.Plan != auth.PlanFree {
+		t.Fatalf("Expected new users to be on %s, got %s", auth.PlanFree, user.Plan)
+	}
+
+	_, err = auth.SetPlan(ctx, store, "ada@example.com", "enterprise")
+	if !errors.Is(err, auth.ErrInvalidPlan) {
+		t.Fatalf("Expected ErrInvalidPlan, got %v", err)
+	}
+	_, err = auth.SetPlan(ctx, store, "nobody@example.com", auth.PlanPaid)
+	if !errors.Is(err, auth.ErrUserNotFound) {
+		t.Fatalf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	updated, err := auth.SetPlan(ctx, store, " Ada@Example.com", auth.PlanPaid)
+	if err != nil {
+		t.Fatalf("Failed to set plan: %v", err)
+	}
+	if updated.ID != user.ID || updated.Plan != auth.PlanPaid {
+		t.Fatalf("Unexpected updated user: %+v", updated)
+	}
+	stored, _, err := store.GetUserByEmail(ctx, "ada@example.com")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if stored.Plan != auth.PlanPaid {
+		t.Fatalf("Expected plan %s to be stored, got %s", auth.PlanPaid, stored.Plan)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	user, err := auth.Register(ctx, store, "ada@example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	token, _, err := auth.NewAPIKey(ctx, store, user.ID, "")
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	handler := auth.Middleware(store)(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(auth.UserFromContext(r.Context()).ID))
+	})
+
+	headers := []struct {
+		name   string
+		value  string
+		status int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"Authorization", "Bearer not-a-key", http.StatusUnauthorized},
+		{"Authorization", "Bearer " + token, http.StatusOK},
+		{"X-API-Key", token, http.StatusOK},
+	}
+	for _, header := range headers {
+		req := httptest.NewRequest("GET", "/", nil)
+		if header.name != "" {
+			req.Header.Set(header.name, header.value)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if rec.Code != header.status {
+			t.Fatalf("Expected status %d with %s header, got %d", header.status, header.name, rec.Code)
+		}
+		if rec.Code == http.StatusOK && rec.Body.String() != user.ID {
+			t.Fatalf("Handler saw user %q, expected %q", rec.Body.String(), user.ID)
+		}
+	}
+}
+
+func TestScopeKey(t *testing.T) {
+	ada := &auth.User{ID: "ada"}
+	bob := &auth.User{ID: "bob"}
+
+	key := auth.ScopeKey(ada, "meeting.wav")
+	if key != "users/ada/meeting.wav" {
+		t.Fatalf("Unexpected scoped key: %q", key)
+	}
+	if auth.ScopeKey(ada, key) != key {
+		t.Fatalf("Scoped key was scoped again: %q", auth.ScopeKey(ada, key))
+	}
+	if !auth.OwnsKey(ada, key) || auth.OwnsKey(bob, key) {
+		t.Fatalf("Unexpected ownership of %q", key)
+	}
+	if auth.ScopeKey(bob, key) != "users/bob/users/ada/meeting.wav" {
+		t.Fatalf("Another user's key escaped their scope: %q", auth.ScopeKey(bob, key))
+	}
+}
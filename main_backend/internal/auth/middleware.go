@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+type contextKey struct{}
+
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the authenticated user of a request, or nil.
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(contextKey{}).(*User)
+	return user
+}
+
+// TokenFromRequest returns the credentials of a request, given either as a
+// bearer token or in the X-API-Key header.
+func TokenFromRequest(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// RequireUser rejects requests without valid credentials and makes the
+// authenticated user available to next through UserFromContext.
+func RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store, err := GetStore()
+		if err != nil {
+			slog.Error("Failed to get account store", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		Middleware(store)(next)(w, r)
+	}
+}
+
+// getAdminEmails returns the emails of the users allowed to use admin routes,
+// given as a comma-separated list in ADMIN_EMAILS.
+var getAdminEmails = sync.OnceValue(func() map[string]bool {
+	admins := make(map[string]bool)
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email, err := normalizeEmail(email)
+		if err == nil {
+			admins[email] = true
+		}
+	}
+	return admins
+})
+
+func IsAdmin(user *User) bool {
+	return user != nil && getAdminEmails()[user.Email]
+}
+
+// RequireAdmin is like RequireUser, but only lets admins through.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !IsAdmin(UserFromContext(r.Context())) {
+			http.Error(w, "admin access required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// Middleware returns a wrapper like RequireUser that authenticates requests
+// against store.
+func Middleware(store Store) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			user, err := Authenticate(r.Context(), store, TokenFromRequest(r))
+			if errors.Is(err, ErrUnauthenticated) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				slog.Error("Failed to authenticate request", "error", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			next(w, r.WithContext(WithUser(r.Context(), user)))
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package auth
+
+import "strings"
+
+// Every object a user uploads is stored under a prefix of their own, so keys
+// from requests are always resolved within the requesting user's prefix.
+
+// KeyPrefix returns the prefix of the objects owned by userID.
+func KeyPrefix(userID string) string {
+	return "users/" + userID + "/"
+}
+
+// ScopeKey resolves a key from a request by user to a key in their prefix.
+// Keys that already carry the prefix, as returned to the client when it
+// uploaded them, are left as they are.
+func ScopeKey(user *User, key string) string {
+	prefix := KeyPrefix(user.ID)
+	if strings.HasPrefix(key, prefix) {
+		return key
+	}
+	return prefix + key
+}
+
+// OwnsKey reports whether the object at key belongs to user.
+func OwnsKey(user *User, key string) bool {
+	return strings.HasPrefix(key, KeyPrefix(user.ID))
+}
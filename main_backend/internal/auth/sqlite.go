@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+)
+
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+	id            TEXT PRIMARY KEY,
+	email         TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	created_at    INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	name       TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS api_keys_user_id ON api_keys (user_id);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	token_hash TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	expires_at INTEGER NOT NULL
+);`,
+	`ALTER TABLE users ADD COLUMN plan TEXT NOT NULL DEFAULT 'free';`,
+}
+
+// SQLiteStore is the default Store implementation.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	err := database.Migrate(db, "auth", migrations)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) CreateUser(ctx context.Context, user *User, passwordHash string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO users (id, email, plan, password_hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		user.ID, user.Email, user.Plan, passwordHash, user.CreatedAt.UnixMilli())
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: users.email") {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert user: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetUserByEmail(ctx context.Context, email string) (*User, string, error) {
+	var user User
+	var passwordHash string
+	var createdAt int64
+	err := s.db.QueryRowContext(ctx, `SELECT id, email, plan, password_hash, created_at FROM users WHERE email = ?`, email).
+		Scan(&user.ID, &user.Email, &user.Plan, &passwordHash, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrUserNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	user.CreatedAt = time.UnixMilli(createdAt)
+	return &user, passwordHash, nil
+}
+
+func (s *SQLiteStore) SetPlan(ctx context.Context, userID string, plan string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET plan = ? WHERE id = ?`, plan, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set plan: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) CreateAPIKey(ctx context.Context, key *APIKey, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO api_keys (id, user_id, name, token_hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		key.ID, key.UserID, key.Name, tokenHash, key.CreatedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to insert api key: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, name, created_at FROM api_keys WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var createdAt int64
+		err = rows.Scan(&key.ID, &key.UserID, &key.Name, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		key.CreatedAt = time.UnixMilli(createdAt)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteAPIKey(ctx context.Context, userID string, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE user_id = ? AND id = ?`, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) CreateSession(ctx context.Context, userID string, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+		tokenHash, userID, expiresAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to insert session: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) UserForToken(ctx context.Context, tokenHash string, now time.Time) (*User, error) {
+	var user User
+	var createdAt int64
+	err := s.db.QueryRowContext(ctx, `
+SELECT users.id, users.email, users.plan, users.created_at FROM api_keys JOIN users ON users.id = api_keys.user_id
+WHERE api_keys.token_hash = ?
+UNION ALL
+SELECT users.id, users.email, users.plan, users.created_at FROM sessions JOIN users ON users.id = sessions.user_id
+WHERE sessions.token_hash = ? AND sessions.expires_at > ?
+LIMIT 1`, tokenHash, tokenHash, now.UnixMilli()).Scan(&user.ID, &user.Email, &user.Plan, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.CreatedAt = time.UnixMilli(createdAt)
+	return &user, nil
+}
@@ -0,0 +1,153 @@
+// Package chunking splits long recordings into overlapping windows that can
+// be transcribed in parallel, and stitches the transcripts back together.
+package chunking
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+)
+
+const (
+	DefaultWindow  = 10 * time.Minute
+	DefaultOverlap = 10 * time.Second
+
+	PRESIGNED_URL_DURATION = 15 * time.Minute
+
+	// probeSize is how much of a file is fetched to read its header.
+	probeSize = 64 * 1024
+	// splitConcurrency is how many chunks are copied at once.
+	splitConcurrency = 4
+)
+
+// Window is a span of a recording, measured from its start.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Windows covers duration with windows of at most length, each overlapping
+// the previous one by overlap. overlap must be shorter than length.
+func Windows(duration time.Duration, length time.Duration, overlap time.Duration) []Window {
+	step := length - overlap
+	if step <= 0 {
+		step = length
+	}
+
+	var windows []Window
+	for start := time.Duration(0); ; start += step {
+		end := min(start+length, duration)
+		windows = append(windows, Window{Start: start, End: end})
+		if end == duration {
+			return windows
+		}
+	}
+}
+
+// Chunk is an object holding one window of a recording.
+type Chunk struct {
+	Key    string
+	Window Window
+}
+
+// ChunkKey returns the key of the i-th chunk of the object at key made for
+// the job with the given id. Each job has chunks of its own, so that jobs on
+// the same recording do not overwrite or delete each other's.
+func ChunkKey(key string, jobID string, i int) string {
+	return fmt.Sprintf("%s-%s-chunk%d.wav", key, jobID, i)
+}
+
+// ProbeWAV reads the header of the WAV object at key. It returns ErrNotWAV if
+// the object is not a WAV file.
+func ProbeWAV(ctx context.Context, store objectstore.ObjectStore, key string) (*WAVInfo, error) {
+	attrs, err := store.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := objectstore.GetRange(ctx, store, key, 0, min(probeSize, attrs.Size))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	info, err := ParseWAVHeader(body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Streamed recordings may not know their length when the header is
+	// written, so trust the object size over the header.
+	info.DataSize = min(info.DataSize, attrs.Size-info.DataOffset)
+	info.DataSize -= info.DataSize % info.BlockAlign
+	return info, nil
+}
+
+// SplitWAV copies each window of the WAV object at key into a chunk object of
+// its own for the job with the given id. The copies are made through
+// presigned URLs, so the audio is streamed through the backend without being
+// held in memory.
+func SplitWAV(ctx context.Context, store objectstore.ObjectStore, key string, jobID string, info *WAVInfo, windows []Window) ([]Chunk, error) {
+	chunks := make([]Chunk, len(windows))
+	errs := make([]error, len(windows))
+	semaphore := make(chan struct{}, splitConcurrency)
+
+	var wg sync.WaitGroup
+	for i, window := range windows {
+		chunks[i] = Chunk{Key: ChunkKey(key, jobID, i), Window: window}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			errs[i] = copyWindow(ctx, store, key, info, chunks[i])
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to write chunk %d of %s: %w", i, key, err)
+		}
+	}
+	return chunks, nil
+}
+
+func copyWindow(ctx context.Context, store objectstore.ObjectStore, key string, info *WAVInfo, chunk Chunk) error {
+	start := info.ByteOffset(chunk.Window.Start)
+	size := info.ByteOffset(chunk.Window.End) - start
+
+	body, err := objectstore.GetRange(ctx, store, key, info.DataOffset+start, size)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	url, err := store.PresignPut(ctx, chunk.Key, PRESIGNED_URL_DURATION)
+	if err != nil {
+		return err
+	}
+
+	header := info.Header(size)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, io.MultiReader(bytes.NewReader(header), io.LimitReader(body, size)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(header)) + size
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("upload failed with status %s", resp.Status)
+	}
+	return nil
+}
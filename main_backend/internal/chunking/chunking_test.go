@@ -0,0 +1,218 @@
+package chunking_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/chunking"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/localstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+const SAMPLE_RATE = 8000
+
+// testWAV returns a 16-bit mono WAV file whose n-th sample is n, with a LIST
+// chunk before the data like many recorders write.
+func testWAV(seconds int) []byte {
+	samples := SAMPLE_RATE * seconds
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+24+14+8+2*samples))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	for _, field := range []any{uint32(16), uint16(1), uint16(1), uint32(SAMPLE_RATE), uint32(2 * SAMPLE_RATE), uint16(2), uint16(16)} {
+		binary.Write(&buf, binary.LittleEndian, field)
+	}
+	buf.WriteString("LIST")
+	binary.Write(&buf, binary.LittleEndian, uint32(5))
+	buf.WriteString("INFOx\x00")
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(2*samples))
+	for i := 0; i < samples; i++ {
+		binary.Write(&buf, binary.LittleEndian, uint16(i))
+	}
+	return buf.Bytes()
+}
+
+func TestParseWAVHeader(t *testing.T) {
+	wav := testWAV(3)
+	info, err := chunking.ParseWAVHeader(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("Failed to parse WAV header: %v", err)
+	}
+	if info.ByteRate != 2*SAMPLE_RATE || info.BlockAlign != 2 || info.DataSize != 6*SAMPLE_RATE {
+		t.Fatalf("Unexpected WAV info: %+v", info)
+	}
+	if info.Duration() != 3*time.Second {
+		t.Fatalf("Unexpected duration: %v", info.Duration())
+	}
+	if !bytes.Equal(wav[info.DataOffset-8:info.DataOffset-4], []byte("data")) {
+		t.Fatalf("Data offset %d does not follow the data chunk header", info.DataOffset)
+	}
+
+	header := info.Header(10)
+	reparsed, err := chunking.ParseWAVHeader(bytes.NewReader(header))
+	if err != nil {
+		t.Fatalf("Failed to parse generated header: %v", err)
+	}
+	if reparsed.DataSize != 10 || reparsed.DataOffset != int64(len(header)) || !bytes.Equal(reparsed.Format, info.Format) {
+		t.Fatalf("Unexpected generated header: %+v", reparsed)
+	}
+
+	_, err = chunking.ParseWAVHeader(strings.NewReader("ID3\x04 not a wav file"))
+	if !errors.Is(err, chunking.ErrNotWAV) {
+		t.Fatalf("Expected ErrNotWAV, got %v", err)
+	}
+}
+
+func TestParseWAVHeaderOversizedFormat(t *testing.T) {
+	// A 28 byte file claiming a fmt chunk of almost 4 GiB.
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(20))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xFFFFFFF0))
+	buf.Write(make([]byte, 8))
+
+	_, err := chunking.ParseWAVHeader(bytes.NewReader(buf.Bytes()))
+	if err == nil {
+		t.Fatalf("Expected an oversized fmt chunk to be rejected")
+	}
+
+	// A fmt chunk that fits the bound but not the file.
+	header := buf.Bytes()
+	binary.LittleEndian.PutUint32(header[16:20], 1000)
+	_, err = chunking.ParseWAVHeader(bytes.NewReader(header))
+	if err == nil {
+		t.Fatalf("Expected a truncated fmt chunk to be rejected")
+	}
+}
+
+func TestWindows(t *testing.T) {
+	windows := chunking.Windows(25*time.Second, 10*time.Second, 2*time.Second)
+	expected := []chunking.Window{
+		{Start: 0, End: 10 * time.Second},
+		{Start: 8 * time.Second, End: 18 * time.Second},
+		{Start: 16 * time.Second, End: 25 * time.Second},
+	}
+	if len(windows) != len(expected) {
+		t.Fatalf("Expected %d windows, got %v", len(expected), windows)
+	}
+	for i := range windows {
+		if windows[i] != expected[i] {
+			t.Fatalf("Expected window %d to be %v, got %v", i, expected[i], windows[i])
+		}
+	}
+
+	windows = chunking.Windows(5*time.Second, 10*time.Second, 2*time.Second)
+	if len(windows) != 1 || windows[0].End != 5*time.Second {
+		t.Fatalf("Expected a single window, got %v", windows)
+	}
+}
+
+func TestSplitWAV(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewTestStore(t)
+
+	err := store.Write("meeting.wav", bytes.NewReader(testWAV(5)))
+	if err != nil {
+		t.Fatalf("Failed to write test WAV: %v", err)
+	}
+
+	info, err := chunking.ProbeWAV(ctx, store, "meeting.wav")
+	if err != nil {
+		t.Fatalf("Failed to probe WAV: %v", err)
+	}
+
+	windows := chunking.Windows(info.Duration(), 2*time.Second, 500*time.Millisecond)
+	chunks, err := chunking.SplitWAV(ctx, store, "meeting.wav", "job-1", info, windows)
+	if err != nil {
+		t.Fatalf("Failed to split WAV: %v", err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(chunks))
+	}
+
+	for i, chunk := range chunks {
+		f, err := store.Open(chunk.Key)
+		if err != nil {
+			t.Fatalf("Failed to open chunk %d: %v", i, err)
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Failed to read chunk %d: %v", i, err)
+		}
+
+		chunkInfo, err := chunking.ParseWAVHeader(bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("Failed to parse chunk %d: %v", i, err)
+		}
+		data := content[chunkInfo.DataOffset:]
+		if int64(len(data)) != chunkInfo.DataSize {
+			t.Fatalf("Chunk %d has %d bytes of data, header says %d", i, len(data), chunkInfo.DataSize)
+		}
+		if chunkInfo.Duration() != chunk.Window.End-chunk.Window.Start {
+			t.Fatalf("Chunk %d is %v long, expected %v", i, chunkInfo.Duration(), chunk.Window.End-chunk.Window.Start)
+		}
+		firstSample := binary.LittleEndian.Uint16(data[0:2])
+		if int(firstSample) != int(chunk.Window.Start.Seconds()*SAMPLE_RATE) {
+			t.Fatalf("Chunk %d starts at sample %d, expected %v", i, firstSample, chunk.Window.Start.Seconds()*SAMPLE_RATE)
+		}
+	}
+}
+
+func output(segments ...whisper.Segment) *whisper.WhisperOutput {
+	return &whisper.WhisperOutput{Segments: segments, DetectedLanguage: "en"}
+}
+
+func TestStitch(t *testing.T) {
+	// Windows [0, 10) and [8, 18) overlap on [8, 10), which is cut at 9.
+	pieces := []chunking.Piece{
+		{Start: 8, End: 18, Output: output(
+			whisper.Segment{Start: 0, End: 0.8, Text: " years ago"},
+			whisper.Segment{Start: 1.2, End: 4, Text: " our fathers brought forth", Words: []whisper.Word{{Word: " our", Start: 1.2, End: 1.5}}},
+		)},
+		{Start: 0, End: 10, Output: output(
+			whisper.Segment{Start: 0, End: 7, Text: " Four score and seven"},
+			whisper.Segment{Start: 7, End: 8.8, Text: " years ago"},
+			whisper.Segment{Start: 9, End: 10, Text: " our"},
+		)},
+	}
+
+	stitched := chunking.Stitch(pieces)
+
+	expected := []whisper.Segment{
+		{ID: 0, Start: 0, End: 7, Text: " Four score and seven"},
+		{ID: 1, Start: 7, End: 8.8, Text: " years ago"},
+		{ID: 2, Start: 9.2, End: 12, Text: " our fathers brought forth"},
+	}
+	if len(stitched.Segments) != len(expected) {
+		t.Fatalf("Expected %d segments, got %+v", len(expected), stitched.Segments)
+	}
+	for i := range expected {
+		if stitched.Segments[i].ID != expected[i].ID || stitched.Segments[i].Start != expected[i].Start ||
+			stitched.Segments[i].End != expected[i].End || stitched.Segments[i].Text != expected[i].Text {
+			t.Fatalf("Expected segment %d to be %+v, got %+v", i, expected[i], stitched.Segments[i])
+		}
+	}
+	if words := stitched.Segments[2].Words; len(words) != 1 || words[0].Start != 9.2 || words[0].End != 9.5 {
+		t.Fatalf("Expected word times to be shifted, got %+v", words)
+	}
+	if pieces[0].Output.Segments[1].Words[0].Start != 1.2 {
+		t.Fatalf("Stitch modified its input: %+v", pieces[0].Output.Segments[1].Words)
+	}
+	if stitched.Transcription != "Four score and seven years ago our fathers brought forth" {
+		t.Fatalf("Unexpected transcription: %q", stitched.Transcription)
+	}
+	if stitched.DetectedLanguage != "en" {
+		t.Fatalf("Unexpected language: %q", stitched.DetectedLanguage)
+	}
+}
@@ -0,0 +1,87 @@
+package chunking
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+// Piece is the transcript of one window of a recording. Start and End are
+// the window's bounds in seconds.
+type Piece struct {
+	Start  float64
+	End    float64
+	Output *whisper.WhisperOutput
+}
+
+// Stitch joins the transcripts of overlapping windows into a transcript of
+// the whole recording.
+//
+// Segment and word times are shifted by their window's start. Where two windows
+// overlap, the overlap is split down the middle: each segment is taken from
+// whichever window its midpoint falls on the near side of. A segment that
+// repeats the text of the one before it across the cut is dropped.
+func Stitch(pieces []Piece) *whisper.WhisperOutput {
+	pieces = slices.Clone(pieces)
+	slices.SortFunc(pieces, func(a, b Piece) int {
+		switch {
+		case a.Start < b.Start:
+			return -1
+		case a.Start > b.Start:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	stitched := &whisper.WhisperOutput{}
+	var texts []string
+	for i, piece := range pieces {
+		if i == 0 {
+			stitched.DetectedLanguage = piece.Output.DetectedLanguage
+			stitched.Device = piece.Output.Device
+			stitched.Model = piece.Output.Model
+		}
+
+		from, to := piece.Start, piece.End
+		if i > 0 {
+			from = (pieces[i-1].End + piece.Start) / 2
+		}
+		if i < len(pieces)-1 {
+			to = (piece.End + pieces[i+1].Start) / 2
+		}
+
+		for _, segment := range piece.Output.Segments {
+			segment.Start += piece.Start
+			segment.End += piece.Start
+			segment.Words = slices.Clone(segment.Words)
+			for j := range segment.Words {
+				segment.Words[j].Start += piece.Start
+				segment.Words[j].End += piece.Start
+			}
+			midpoint := (segment.Start + segment.End) / 2
+			if i > 0 && midpoint < from || i < len(pieces)-1 && midpoint >= to {
+				continue
+			}
+
+			if n := len(stitched.Segments); n > 0 {
+				last := stitched.Segments[n-1]
+				if last.End > segment.Start && normalizeText(last.Text) == normalizeText(segment.Text) {
+					continue
+				}
+			}
+
+			segment.ID = len(stitched.Segments)
+			stitched.Segments = append(stitched.Segments, segment)
+			texts = append(texts, strings.TrimSpace(segment.Text))
+		}
+	}
+
+	stitched.Transcription = strings.Join(texts, " ")
+	return stitched
+}
+
+func normalizeText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
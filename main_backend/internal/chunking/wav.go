@@ -0,0 +1,125 @@
+package chunking
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrNotWAV = errors.New("audio is not a WAV file")
+
+// maxFormatSize bounds the size of the "fmt " chunk, which is read into
+// memory. Real ones are at most 40 bytes long.
+const maxFormatSize = 4096
+
+// WAVInfo describes the layout of a WAV file.
+type WAVInfo struct {
+	// Format is the raw contents of the file's "fmt " chunk.
+	Format     []byte
+	ByteRate   int64
+	BlockAlign int64
+	// DataOffset and DataSize locate the sample data within the file.
+	DataOffset int64
+	DataSize   int64
+}
+
+func (w *WAVInfo) Duration() time.Duration {
+	return time.Duration(float64(w.DataSize) / float64(w.ByteRate) * float64(time.Second))
+}
+
+// ByteOffset returns the offset of the sample frame at t into the data.
+func (w *WAVInfo) ByteOffset(t time.Duration) int64 {
+	frame := int64(t.Seconds() * float64(w.ByteRate) / float64(w.BlockAlign))
+	return min(frame*w.BlockAlign, w.DataSize)
+}
+
+// ParseWAVHeader reads the header of a WAV file from r, stopping at the start
+// of the sample data. It returns ErrNotWAV if r is not a RIFF WAVE file.
+func ParseWAVHeader(r io.Reader) (*WAVInfo, error) {
+	var riff [12]byte
+	_, err := io.ReadFull(r, riff[:])
+	if err != nil {
+		return nil, ErrNotWAV
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+
+	info := &WAVInfo{}
+	offset := int64(len(riff))
+	for {
+		var header [8]byte
+		_, err = io.ReadFull(r, header[:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read WAV chunk header: %w", err)
+		}
+		offset += int64(len(header))
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+
+		if id == "data" {
+			if info.Format == nil {
+				return nil, fmt.Errorf("WAV data chunk precedes fmt chunk")
+			}
+			info.DataOffset = offset
+			info.DataSize = size
+			return info, nil
+		}
+
+		// Chunks are padded to an even number of bytes.
+		padded := size + size%2
+		if id != "fmt " {
+			_, err = io.CopyN(io.Discard, r, padded)
+			if err != nil {
+				return nil, fmt.Errorf("failed to skip WAV %q chunk: %w", id, err)
+			}
+			offset += padded
+			continue
+		}
+
+		if size < 16 {
+			return nil, fmt.Errorf("WAV fmt chunk is too short")
+		}
+		// The size comes straight from the file, so it is bounded before
+		// allocating. A chunk shorter than it claims fails to read below.
+		if size > maxFormatSize {
+			return nil, fmt.Errorf("WAV fmt chunk is too long: %d bytes", size)
+		}
+		format := make([]byte, padded)
+		_, err = io.ReadFull(r, format)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read WAV fmt chunk: %w", err)
+		}
+		offset += padded
+		info.Format = format[:size]
+		info.ByteRate = int64(binary.LittleEndian.Uint32(format[8:12]))
+		info.BlockAlign = int64(binary.LittleEndian.Uint16(format[12:14]))
+		if info.ByteRate == 0 || info.BlockAlign == 0 {
+			return nil, fmt.Errorf("WAV fmt chunk has no byte rate or block align")
+		}
+	}
+}
+
+// Header returns a WAV header for dataSize bytes of sample data in the same
+// format as w.
+func (w *WAVInfo) Header(dataSize int64) []byte {
+	formatSize := int64(len(w.Format))
+	formatPadded := formatSize + formatSize%2
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+formatPadded+8+dataSize))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(formatSize))
+	buf.Write(w.Format)
+	if formatSize%2 == 1 {
+		buf.WriteByte(0)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	return buf.Bytes()
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+	_ "modernc.org/sqlite"
+)
+
+// GetDB returns the SQLite database at DATABASE_PATH
+// (default: <project root>/transcribemymeet.db), shared by all stores.
+var GetDB = sync.OnceValues(func() (*sql.DB, error) {
+	path := os.Getenv("DATABASE_PATH")
+	if path == "" {
+		path = filepath.Join(utils.Root, "transcribemymeet.db")
+	}
+	return Open(path)
+})
+
+// Open opens the SQLite database at path, creating it if it does not exist.
+// Use ":memory:" for a throwaway database.
+func Open(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)", path)
+	if path != ":memory:" {
+		dsn += "&_pragma=journal_mode(WAL)"
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to ":memory:" is a separate database, and SQLite only
+	// allows a single writer anyway.
+	db.SetMaxOpenConns(1)
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const migrationsSchema = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	name    TEXT PRIMARY KEY,
+	version INTEGER NOT NULL
+);
+`
+
+// Migrate brings the tables owned by name up to date by running the
+// migrations that have not been applied yet. Migrations are append-only:
+// once released, a migration must never be edited or reordered.
+func Migrate(db *sql.DB, name string, migrations []string) error {
+	_, err := db.Exec(migrationsSchema)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	err = tx.QueryRow(`SELECT version FROM schema_migrations WHERE name = ?`, name).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get %s schema version: %w", name, err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		_, err = tx.Exec(migrations[i])
+		if err != nil {
+			return fmt.Errorf("failed to apply %s migration %d: %w", name, i+1, err)
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO schema_migrations (name, version) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET version = excluded.version`,
+		name, len(migrations))
+	if err != nil {
+		return fmt.Errorf("failed to record %s schema version: %w", name, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,18 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// OpenTest opens a throwaway in-memory database that is closed when the test
+// finishes.
+func OpenTest(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
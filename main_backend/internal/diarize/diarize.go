@@ -0,0 +1,90 @@
+// Package diarize works out who is speaking when in a recording and labels
+// transcript segments with speakers.
+package diarize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+// MaxNameLength is the longest a speaker name may be, in characters.
+const MaxNameLength = 100
+
+var ErrInvalidName = errors.New("invalid speaker name")
+
+// Turn is a span of time in which a single speaker is talking. Start and End
+// are in seconds.
+type Turn struct {
+	Speaker string  `json:"speaker"`
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+}
+
+// Result is the state of a diarization. Status is one of the RunPod job
+// statuses; Turns is set once the status is whisper.StatusComplete.
+type Result struct {
+	Status string
+	Error  string
+	Turns  []Turn
+}
+
+// Diarizer runs diarization asynchronously, like a Whisper job.
+type Diarizer interface {
+	// Start begins diarizing the audio at audioURL and returns an id that can
+	// be passed to Status.
+	Start(ctx context.Context, audioURL string) (string, error)
+	Status(ctx context.Context, id string) (*Result, error)
+}
+
+// Label sets the speaker of each segment to the speaker of the turn it
+// overlaps most. Segments that overlap no turn are left unlabelled.
+func Label(segments []whisper.Segment, turns []Turn) {
+	for i := range segments {
+		segment := &segments[i]
+		var best float64
+		for _, turn := range turns {
+			overlap := min(segment.End, turn.End) - max(segment.Start, turn.Start)
+			if overlap > best {
+				best = overlap
+				segment.Speaker = turn.Speaker
+			}
+		}
+	}
+}
+
+// Rename replaces speaker labels according to names, which maps current
+// labels to new ones. Labels not in names are kept.
+func Rename(segments []whisper.Segment, names map[string]string) {
+	for i := range segments {
+		if name, ok := names[segments[i].Speaker]; ok {
+			segments[i].Speaker = name
+		}
+	}
+}
+
+// ValidateName returns ErrInvalidName if name cannot be used as a speaker
+// label. Names must not be blank or longer than MaxNameLength, and must not
+// contain control characters or line breaks, which would end a subtitle cue.
+func ValidateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%w: name is empty", ErrInvalidName)
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("%w: name is not valid UTF-8", ErrInvalidName)
+	}
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		return fmt.Errorf("%w: name is longer than %d characters", ErrInvalidName, MaxNameLength)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || unicode.In(r, unicode.Zl, unicode.Zp) {
+			return fmt.Errorf("%w: name contains control characters", ErrInvalidName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package diarize_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/diarize"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+func TestLabel(t *testing.T) {
+	segments := []whisper.Segment{
+		{Start: 0, End: 4},
+		{Start: 4, End: 10},
+		{Start: 10, End: 12},
+		{Start: 20, End: 25},
+	}
+	turns := []diarize.Turn{
+		{Speaker: "SPEAKER_00", Start: 0, End: 5},
+		{Speaker: "SPEAKER_01", Start: 5, End: 11.5},
+		{Speaker: "SPEAKER_00", Start: 11.5, End: 15},
+	}
+
+	diarize.Label(segments, turns)
+
+	expected := []string{"SPEAKER_00", "SPEAKER_01", "SPEAKER_01", ""}
+	for i, segment := range segments {
+		if segment.Speaker != expected[i] {
+			t.Fatalf("Expected segment %d to be labelled %q, got %q", i, expected[i], segment.Speaker)
+		}
+	}
+
+	diarize.Rename(segments, map[string]string{"SPEAKER_01": "Alice"})
+	expected = []string{"SPEAKER_00", "Alice", "Alice", ""}
+	for i, segment := range segments {
+		if segment.Speaker != expected[i] {
+			t.Fatalf("Expected segment %d to be renamed %q, got %q", i, expected[i], segment.Speaker)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"Alice", "Dr. Jean-Luc Picard", "김용범", strings.Repeat("a", diarize.MaxNameLength)} {
+		err := diarize.ValidateName(name)
+		if err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"   ",
+		"Alice\n\n00:00:00,000 --> 00:00:01,000\nInjected",
+		"Alice\r",
+		"Alice\x00",
+		"Alice\u2028",
+		"\xff",
+		strings.Repeat("a", diarize.MaxNameLength+1),
+	}
+	for _, name := range invalid {
+		err := diarize.ValidateName(name)
+		if !errors.Is(err, diarize.ErrInvalidName) {
+			t.Errorf("Expected %v for %q, got %v", diarize.ErrInvalidName, name, err)
+		}
+	}
+}
+
+func TestRunpodDiarizer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /run", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input struct {
+				Audio string `json:"audio"`
+			} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Input.Audio != "https://example.com/meeting.wav" {
+			t.Errorf("Unexpected audio URL: %q", req.Input.Audio)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": "diarization-1", "status": "IN_QUEUE"})
+	})
+	mux.HandleFunc("GET /status/{id}", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":     r.PathValue("id"),
+			"status": "COMPLETED",
+			"output": map[string]any{
+				"segments": []map[string]any{{"speaker": "SPEAKER_00", "start": 0.5, "end": 2}},
+			},
+		})
+	})
+	var cancelled []string
+	mux.HandleFunc("POST /cancel/{id}", func(w http.ResponseWriter, r *http.Request) {
+		cancelled = append(cancelled, r.PathValue("id"))
+		json.NewEncoder(w).Encode(map[string]any{"id": r.PathValue("id"), "status": "CANCELLED"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	diarizer, err := diarize.NewRunpodDiarizer("test-api-key", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create diarizer: %v", err)
+	}
+
+	id, err := diarizer.Start(context.Background(), "https://example.com/meeting.wav")
+	if err != nil {
+		t.Fatalf("Failed to start diarization: %v", err)
+	}
+	if id != "diarization-1" {
+		t.Fatalf("Unexpected diarization id: %q", id)
+	}
+
+	result, err := diarizer.Status(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Failed to get diarization status: %v", err)
+	}
+	if result.Status != whisper.StatusComplete || len(result.Turns) != 1 || result.Turns[0] != (diarize.Turn{Speaker: "SPEAKER_00", Start: 0.5, End: 2}) {
+		t.Fatalf("Unexpected diarization result: %+v", result)
+	}
+
+	err = diarizer.Cancel(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Failed to cancel diarization: %v", err)
+	}
+	if len(cancelled) != 1 || cancelled[0] != id {
+		t.Fatalf("Expected %s to be cancelled, got %v", id, cancelled)
+	}
+}
@@ -0,0 +1,90 @@
+package diarize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+)
+
+// RunpodDiarizer runs diarization on a RunPod serverless endpoint. The
+// endpoint takes {"audio": "<url>"} as input and outputs
+// {"segments": [{"speaker": "...", "start": 0.0, "end": 0.0}, ...]}.
+type RunpodDiarizer struct {
+	rpclient             *runpod.RunpodClient
+	RunpodDiarizationURL string
+}
+
+var _ Diarizer = (*RunpodDiarizer)(nil)
+
+var ErrMissingRunpodDiarizationURL = fmt.Errorf("runpod diarization URL is required")
+
+func NewRunpodDiarizer(runpodAPIKey string, runpodDiarizationURL string, options ...runpod.RunpodClientOption) (*RunpodDiarizer, error) {
+	rpclient, err := runpod.NewRunpodClient(runpodAPIKey, options...)
+	if err != nil {
+		return nil, err
+	}
+	if runpodDiarizationURL == "" {
+		return nil, ErrMissingRunpodDiarizationURL
+	}
+
+	return &RunpodDiarizer{
+		rpclient:             rpclient,
+		RunpodDiarizationURL: runpodDiarizationURL,
+	}, nil
+}
+
+type runpodDiarizationInput struct {
+	AudioURL string `json:"audio"`
+}
+
+type runpodDiarizationOutput struct {
+	Segments []Turn `json:"segments"`
+}
+
+func (d *RunpodDiarizer) Start(ctx context.Context, audioURL string) (string, error) {
+	response, err := d.rpclient.RunContext(ctx, d.RunpodDiarizationURL, runpod.RunRequest{
+		Input: runpodDiarizationInput{AudioURL: audioURL},
+	})
+	if err != nil {
+		return "", err
+	}
+	if response.JobId == "" {
+		return "", fmt.Errorf("diarization job was not started: status %q", response.Status)
+	}
+	return response.JobId, nil
+}
+
+func (d *RunpodDiarizer) Status(ctx context.Context, id string) (*Result, error) {
+	response, err := d.rpclient.StatusContext(ctx, d.RunpodDiarizationURL, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Status: response.Status,
+		Error:  response.Error,
+	}
+	if response.Status != runpod.StatusComplete {
+		return result, nil
+	}
+
+	outputJSON, err := json.Marshal(response.Output)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling diarization output: %w", err)
+	}
+	var output runpodDiarizationOutput
+	err = json.Unmarshal(outputJSON, &output)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling diarization output: %w", err)
+	}
+	result.Turns = output.Segments
+	return result, nil
+}
+
+// Cancel stops a diarization that is no longer needed.
+func (d *RunpodDiarizer) Cancel(ctx context.Context, id string) error {
+	_, err := d.rpclient.CancelContext(ctx, d.RunpodDiarizationURL, id)
+	return err
+}
@@ -2,15 +2,18 @@ package gcloud
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
-	"fmt"
+	"encoding/base64"
+	"errors"
+	"net/http"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
 	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -22,21 +25,48 @@ var GetBucket = sync.OnceValue(func() string {
 	return utils.GetEnvAssert("TF_VAR_resource_name")
 })
 
-func PresignUploadURL(ctx context.Context, key string, duration time.Duration) (string, error) {
+// GetStore returns the GCS store for the configured bucket. The underlying
+// storage client is shared for the lifetime of the process.
+var GetStore = sync.OnceValues(func() (*GCSStore, error) {
+	return NewGCSStore(context.Background(), GetBucket(), GetCredentialsFile())
+})
+
+// GCSStore is the objectstore.ObjectStore implementation backed by a Google
+// Cloud Storage bucket.
+type GCSStore struct {
+	client *storage.Client
+	bucket string
+}
+
+var (
+	_ objectstore.ObjectStore       = (*GCSStore)(nil)
+	_ objectstore.ChecksumPresigner = (*GCSStore)(nil)
+)
 
-	client, err := storage.NewClient(ctx, option.WithCredentialsFile(GetCredentialsFile()))
+func NewGCSStore(ctx context.Context, bucket string, credentialsFile string) (*GCSStore, error) {
+	client, err := storage.NewClient(ctx, option.WithCredentialsFile(credentialsFile))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer client.Close()
 
+	return &GCSStore{
+		client: client,
+		bucket: bucket,
+	}, nil
+}
+
+func (s *GCSStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *GCSStore) presign(key string, method string, duration time.Duration) (string, error) {
 	opts := &storage.SignedURLOptions{
 		Scheme:  storage.SigningSchemeV4,
-		Method:  "PUT",
+		Method:  method,
 		Expires: time.Now().Add(duration),
 	}
 
-	url, err := client.Bucket(GetBucket()).SignedURL(key, opts)
+	url, err := s.client.Bucket(s.bucket).SignedURL(key, opts)
 	if err != nil {
 		return "", err
 	}
@@ -44,132 +74,161 @@ func PresignUploadURL(ctx context.Context, key string, duration time.Duration) (
 	return url, nil
 }
 
-func PresignDownloadURL(ctx context.Context, key string, duration time.Duration) (string, error) {
-	client, err := storage.NewClient(ctx, option.WithCredentialsFile(GetCredentialsFile()))
-	if err != nil {
-		return "", err
+func (s *GCSStore) PresignPut(ctx context.Context, key string, duration time.Duration) (string, error) {
+	return s.presign(key, "PUT", duration)
+}
+
+func (s *GCSStore) PresignGet(ctx context.Context, key string, duration time.Duration) (string, error) {
+	return s.presign(key, "GET", duration)
+}
+
+// PresignPutChecksum presigns an upload with the checksums in the
+// x-goog-hash header, which GCS checks the content against.
+func (s *GCSStore) PresignPutChecksum(ctx context.Context, key string, duration time.Duration, checksum objectstore.Checksum) (string, http.Header, error) {
+	var hashes []string
+	if checksum.CRC32C != "" {
+		hashes = append(hashes, "crc32c="+checksum.CRC32C)
 	}
-	defer client.Close()
+	if checksum.MD5 != "" {
+		hashes = append(hashes, "md5="+checksum.MD5)
+	}
+	headers := http.Header{}
+	headers.Set("X-Goog-Hash", strings.Join(hashes, ","))
 
 	opts := &storage.SignedURLOptions{
 		Scheme:  storage.SigningSchemeV4,
-		Method:  "GET",
+		Method:  http.MethodPut,
+		Headers: []string{"x-goog-hash:" + headers.Get("X-Goog-Hash")},
 		Expires: time.Now().Add(duration),
 	}
-
-	url, err := client.Bucket(GetBucket()).SignedURL(key, opts)
+	url, err := s.client.Bucket(s.bucket).SignedURL(key, opts)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-
-	return url, nil
+	return url, headers, nil
 }
 
-func CheckIfObjectExists(ctx context.Context, key string) (bool, error) {
-	client, err := storage.NewClient(ctx, option.WithCredentialsFile(GetCredentialsFile()))
-	if err != nil {
-		return false, err
+func toObjectAttrs(attrs *storage.ObjectAttrs) objectstore.ObjectAttrs {
+	// Composed objects have no MD5, only a CRC32C.
+	var md5 string
+	if len(attrs.MD5) > 0 {
+		md5 = base64.StdEncoding.EncodeToString(attrs.MD5)
+	}
+	return objectstore.ObjectAttrs{
+		Key:         attrs.Name,
+		Size:        attrs.Size,
+		ContentType: attrs.ContentType,
+		Updated:     attrs.Updated,
+		ETag:        attrs.Etag,
+		Checksum: objectstore.Checksum{
+			MD5:    md5,
+			CRC32C: objectstore.EncodeCRC32C(attrs.CRC32C),
+		},
 	}
-	defer client.Close()
-
-	bucket := GetBucket()
-	obj := client.Bucket(bucket).Object(key)
+}
 
-	_, err = obj.Attrs(ctx)
-	if err == storage.ErrObjectNotExist {
-		return false, nil
+func (s *GCSStore) Stat(ctx context.Context, key string) (*objectstore.ObjectAttrs, error) {
+	attrs, err := s.client.Bucket(s.bucket).Object(key).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, objectstore.ErrObjectNotExist
 	}
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return true, nil
+	objectAttrs := toObjectAttrs(attrs)
+	return &objectAttrs, nil
 }
 
-func StartMultipartUpload(ctx context.Context, key string) (uploadID string, err error) {
-	randomBytes := make([]byte, 16)
-	_, err = rand.Read(randomBytes)
-	if err != nil {
-		return "", err
+func (s *GCSStore) Compose(ctx context.Context, dst string, srcs []string) error {
+	bucket := s.client.Bucket(s.bucket)
+
+	var sourceObjects []*storage.ObjectHandle
+	for _, src := range srcs {
+		sourceObjects = append(sourceObjects, bucket.Object(src))
 	}
 
-	return hex.EncodeToString(randomBytes), nil
+	_, err := bucket.Object(dst).ComposerFrom(sourceObjects...).Run(ctx)
+	return err
 }
 
-func generatePartKey(uploadID string, partNumber int) (string, error) {
-	if partNumber < 0 || partNumber > 31 {
-		return "", fmt.Errorf("part number must be between 0 and 31, got %d", partNumber)
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
+	err := s.client.Bucket(s.bucket).Object(key).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return objectstore.ErrObjectNotExist
 	}
-	return fmt.Sprintf("%s-part%d", uploadID, partNumber), nil
+	return err
 }
 
-func GetUploadPartURL(ctx context.Context, uploadID string, partNumber int, duration time.Duration) (url string, err error) {
-	partKey, err := generatePartKey(uploadID, partNumber)
-	if err != nil {
-		return "", err
+func (s *GCSStore) List(ctx context.Context, prefix string) ([]objectstore.ObjectAttrs, error) {
+	var objects []objectstore.ObjectAttrs
+	it := s.client.Bucket(s.bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, toObjectAttrs(attrs))
 	}
 
-	url, err = PresignUploadURL(ctx, partKey, duration)
+	return objects, nil
+}
+
+// The functions below operate on the default store returned by GetStore.
+
+func PresignUploadURL(ctx context.Context, key string, duration time.Duration) (string, error) {
+	store, err := GetStore()
 	if err != nil {
 		return "", err
 	}
 
-	return url, nil
+	return store.PresignPut(ctx, key, duration)
 }
 
-func CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts int) error {
-	client, err := storage.NewClient(ctx, option.WithCredentialsFile(GetCredentialsFile()))
+func PresignDownloadURL(ctx context.Context, key string, duration time.Duration) (string, error) {
+	store, err := GetStore()
 	if err != nil {
-		return fmt.Errorf("failed to create storage client: %v", err)
+		return "", err
 	}
-	defer client.Close()
 
-	// 1. Check that all parts are uploaded
-	for partNumber := 0; partNumber < parts; partNumber++ {
-		partKey, err := generatePartKey(uploadID, partNumber)
-		if err != nil {
-			return fmt.Errorf("failed to generate part key: %v", err)
-		}
-		exists, err := CheckIfObjectExists(ctx, partKey)
-		if err != nil {
-			return fmt.Errorf("failed to check if part %d exists: %v", partNumber, err)
-		}
-		if !exists {
-			return fmt.Errorf("part %d not found", partNumber)
-		}
+	return store.PresignGet(ctx, key, duration)
+}
+
+func CheckIfObjectExists(ctx context.Context, key string) (bool, error) {
+	store, err := GetStore()
+	if err != nil {
+		return false, err
 	}
 
-	bucket := client.Bucket(GetBucket())
+	return objectstore.Exists(ctx, store, key)
+}
 
-	// 2. Compose all objects into one object
-	var sourceObjects []*storage.ObjectHandle
-	for partNumber := 0; partNumber < parts; partNumber++ {
-		partKey, err := generatePartKey(uploadID, partNumber)
-		if err != nil {
-			return fmt.Errorf("failed to generate part key: %v", err)
-		}
-		sourceObjects = append(sourceObjects, bucket.Object(partKey))
+func StartMultipartUpload(ctx context.Context, key string) (uploadID string, err error) {
+	store, err := GetStore()
+	if err != nil {
+		return "", err
 	}
 
-	compositeObject := bucket.Object(key)
-	composer := compositeObject.ComposerFrom(sourceObjects...)
-	_, err = composer.Run(ctx)
+	return objectstore.StartMultipartUpload(ctx, store, key)
+}
+
+func GetUploadPartURL(ctx context.Context, uploadID string, partNumber int, duration time.Duration) (url string, err error) {
+	store, err := GetStore()
 	if err != nil {
-		return fmt.Errorf("failed to compose objects: %v", err)
+		return "", err
 	}
 
-	// 3. Delete all parts
-	// TODO: parallelize this
-	for partNumber := 0; partNumber < parts; partNumber++ {
-		partKey, err := generatePartKey(uploadID, partNumber)
-		if err != nil {
-			return fmt.Errorf("failed to generate part key: %v", err)
-		}
-		err = bucket.Object(partKey).Delete(ctx)
-		if err != nil {
-			fmt.Printf("failed to delete part %s: %v\n", partKey, err)
-		}
+	return objectstore.GetUploadPartURL(ctx, store, uploadID, partNumber, duration)
+}
+
+func CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts int) error {
+	store, err := GetStore()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return objectstore.CompleteMultipartUpload(ctx, store, key, uploadID, parts)
 }
@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+// Broker fans changes to jobs out to their subscribers. Subscribers only see
+// the latest state of a job: one that falls behind misses the states in
+// between, never the latest. Changes made by other processes are not seen.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan *Job]struct{}
+	closed      bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[string]map[chan *Job]struct{})}
+}
+
+// GetBroker returns the broker that the shared job store publishes to.
+var GetBroker = sync.OnceValue(NewBroker)
+
+// Subscribe returns a channel that receives the job with the given id each
+// time it changes, until unsubscribe is called or the broker is closed, when
+// the channel is closed.
+func (b *Broker) Subscribe(id string) (events <-chan *Job, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan *Job, 1)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subscribers[id] == nil {
+		b.subscribers[id] = make(map[chan *Job]struct{})
+	}
+	b.subscribers[id][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[id][ch]; !ok {
+			return
+		}
+		delete(b.subscribers[id], ch)
+		if len(b.subscribers[id]) == 0 {
+			delete(b.subscribers, id)
+		}
+		close(ch)
+	}
+}
+
+// Publish sends job to its subscribers without waiting for them, replacing
+// any state they have not received yet.
+func (b *Broker) Publish(job *Job) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[job.ID] {
+		snapshot := *job
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- &snapshot
+	}
+}
+
+// Close closes all subscriptions, for the server to shut down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, subscribers := range b.subscribers {
+		for ch := range subscribers {
+			close(ch)
+		}
+		delete(b.subscribers, id)
+	}
+	b.closed = true
+}
+
+// publishingStore is a Store that publishes the jobs it creates and updates.
+type publishingStore struct {
+	Store
+	broker *Broker
+}
+
+// NewPublishingStore returns store, publishing each job it creates or
+// updates to broker.
+func NewPublishingStore(store Store, broker *Broker) Store {
+	return &publishingStore{Store: store, broker: broker}
+}
+
+func (s *publishingStore) Create(ctx context.Context, job *Job) error {
+	err := s.Store.Create(ctx, job)
+	if err == nil {
+		s.broker.Publish(job)
+	}
+	return err
+}
+
+func (s *publishingStore) UpdateStatus(ctx context.Context, id string, update StatusUpdate) (*Job, error) {
+	job, err := s.Store.UpdateStatus(ctx, id, update)
+	if err == nil {
+		s.broker.Publish(job)
+	}
+	return job, err
+}
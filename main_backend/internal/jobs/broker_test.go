@@ -0,0 +1,98 @@
+package jobs_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+func TestBrokerFanOut(t *testing.T) {
+	broker := jobs.NewBroker()
+	first, unsubscribeFirst := broker.Subscribe("job-1")
+	second, unsubscribeSecond := broker.Subscribe("job-1")
+	other, unsubscribeOther := broker.Subscribe("job-2")
+	defer unsubscribeFirst()
+	defer unsubscribeSecond()
+	defer unsubscribeOther()
+
+	broker.Publish(&jobs.Job{ID: "job-1", Status: jobs.StatusQueue})
+	broker.Publish(&jobs.Job{ID: "job-1", Status: jobs.StatusProgress, DelayTime: 100})
+
+	// Subscribers that fall behind only receive the latest state.
+	for _, events := range []<-chan *jobs.Job{first, second} {
+		select {
+		case job := <-events:
+			if job.Status != jobs.StatusProgress || job.DelayTime != 100 {
+				t.Errorf("Expected the latest state, got %+v", job)
+			}
+		default:
+			t.Errorf("Expected an event")
+		}
+	}
+	select {
+	case job := <-other:
+		t.Errorf("Expected no event for another job, got %+v", job)
+	default:
+	}
+
+	unsubscribeFirst()
+	broker.Publish(&jobs.Job{ID: "job-1", Status: jobs.StatusComplete})
+	if _, ok := <-first; ok {
+		t.Errorf("Expected the channel to be closed after unsubscribing")
+	}
+	if job := <-second; job.Status != jobs.StatusComplete {
+		t.Errorf("Expected %s, got %s", jobs.StatusComplete, job.Status)
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	broker := jobs.NewBroker()
+	events, unsubscribe := broker.Subscribe("job-1")
+	broker.Close()
+	if _, ok := <-events; ok {
+		t.Errorf("Expected the channel to be closed")
+	}
+	unsubscribe()
+
+	events, _ = broker.Subscribe("job-1")
+	if _, ok := <-events; ok {
+		t.Errorf("Expected subscriptions after closing to be closed")
+	}
+}
+
+func TestPublishingStore(t *testing.T) {
+	ctx := context.Background()
+	broker := jobs.NewBroker()
+	store := jobs.NewPublishingStore(newTestStore(t), broker)
+	events, unsubscribe := broker.Subscribe("job-1")
+	defer unsubscribe()
+
+	job := &jobs.Job{ID: "job-1", Owner: "user-1", Input: whisper.NewWhisperInput("https://example.com/a.wav")}
+	err := store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	if got := <-events; got.Status != jobs.StatusPending {
+		t.Errorf("Expected %s, got %s", jobs.StatusPending, got.Status)
+	}
+
+	_, err = store.UpdateStatus(ctx, job.ID, jobs.StatusUpdate{Status: jobs.StatusProgress, DelayTime: 50})
+	if err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+	if got := <-events; got.Status != jobs.StatusProgress || got.DelayTime != 50 {
+		t.Errorf("Unexpected event: %+v", got)
+	}
+
+	_, err = store.UpdateStatus(ctx, "unknown", jobs.StatusUpdate{Status: jobs.StatusFailed})
+	if err == nil {
+		t.Fatalf("Expected an error updating an unknown job")
+	}
+	select {
+	case got := <-events:
+		t.Errorf("Expected no event for a failed update, got %+v", got)
+	default:
+	}
+}
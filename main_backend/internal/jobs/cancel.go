@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+// Canceller is the part of whisper.Transcriber used to cancel jobs.
+type Canceller interface {
+	Cancel(ctx context.Context, jobId string) (*runpod.CancelResponse, error)
+}
+
+// Cancel cancels the RunPod job of job, or those of its children if it was
+// chunked, and marks them as cancelled. Children that could not be cancelled
+// are left as they are, along with the parent, so that cancelling can be
+// retried. A job that is being diarized is marked as cancelled without
+// stopping its diarization. Cancel returns ErrJobFinished if job has already
+// finished.
+//
+// A job that is submitted to RunPod while it is cancelled is cancelled on
+// RunPod by whichever of the two records its status last: Cancel, if the job
+// was given a RunPod job first, or the submitter, which finds it finished.
+func Cancel(ctx context.Context, store Store, client Canceller, job *Job) (*Job, error) {
+	return stop(ctx, store, client, job, StatusUpdate{Status: StatusCanceled})
+}
+
+// stop cancels the RunPod jobs of job as Cancel does, and applies update to
+// job and its children, which must move them to a terminal status. RunPod
+// jobs are left running if client is nil.
+func stop(ctx context.Context, store Store, client Canceller, job *Job, update StatusUpdate) (*Job, error) {
+	if IsTerminal(job.Status) {
+		return job, ErrJobFinished
+	}
+
+	if job.Chunks > 0 {
+		children, err := store.ListChildren(ctx, job.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list children of job %s: %w", job.ID, err)
+		}
+		var errs []error
+		for _, child := range children {
+			_, err = stop(ctx, store, client, &child, update)
+			if err != nil && !errors.Is(err, ErrJobFinished) {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+	} else if job.RunpodID != "" && job.Status != StatusDiarizing {
+		err := cancelRunpodJob(ctx, client, job, job.RunpodID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stopped, err := store.UpdateStatus(ctx, job.ID, update)
+	if err != nil {
+		return nil, err
+	}
+	if stopped.RunpodID != job.RunpodID {
+		err = cancelRunpodJob(ctx, client, job, stopped.RunpodID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stopped, nil
+}
+
+func cancelRunpodJob(ctx context.Context, client Canceller, job *Job, runpodID string) error {
+	if client == nil {
+		return nil
+	}
+	_, err := client.Cancel(ctx, runpodID)
+	// Jobs of self-hosted backends are forgotten when they restart, so
+	// there is nothing left to cancel.
+	if err != nil && !errors.Is(err, whisper.ErrUnknownJob) {
+		return fmt.Errorf("failed to cancel job %s: %w", job.ID, err)
+	}
+	return nil
+}
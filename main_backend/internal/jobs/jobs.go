@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+const (
+	// StatusPending is the status of a job that has been recorded but not yet
+	// accepted by RunPod. StatusDiarizing is the status of a job whose
+	// transcription has finished but whose diarization has not. All other
+	// statuses mirror RunPod's.
+	StatusPending   = "PENDING"
+	StatusDiarizing = "DIARIZING"
+	StatusQueue     = whisper.StatusQueue
+	StatusProgress  = whisper.StatusProgress
+	StatusComplete  = whisper.StatusComplete
+	StatusFailed    = whisper.StatusFailed
+	StatusCanceled  = whisper.StatusCanceled
+	StatusTimeout   = whisper.StatusTimeout
+)
+
+func IsTerminal(status string) bool {
+	switch status {
+	case StatusComplete, StatusFailed, StatusCanceled, StatusTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+type Job struct {
+	ID            string               `json:"id"`
+	Owner         string               `json:"owner,omitempty"`
+	UploadKey     string               `json:"upload_key,omitempty"`
+	Input         whisper.WhisperInput `json:"input"`
+	RunpodID      string               `json:"runpod_id,omitempty"`
+	Status        string               `json:"status"`
+	Error         string               `json:"error,omitempty"`
+	DelayTime     int                  `json:"delay_time,omitempty"`
+	ExecutionTime int                  `json:"execution_time,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+	// WebhookSecretHash is the SHA-256 of the secret in the job's RunPod
+	// webhook URL, if one was registered.
+	WebhookSecretHash string `json:"-"`
+	// DiarizationID is the id of the job's diarization, if one was requested.
+	DiarizationID string `json:"diarization_id,omitempty"`
+	// A long recording is transcribed by a parent job with Chunks child jobs,
+	// one for each window of the recording. ChunkStart and ChunkEnd are the
+	// bounds of a child's window in seconds.
+	ParentID   string  `json:"parent_id,omitempty"`
+	Chunks     int     `json:"chunks,omitempty"`
+	ChunkStart float64 `json:"chunk_start,omitempty"`
+	ChunkEnd   float64 `json:"chunk_end,omitempty"`
+	// AudioSeconds is the length of the job's recording, if known. It is
+	// known up front for recordings that could be probed, and otherwise
+	// estimated from the transcript once the job completes.
+	AudioSeconds float64 `json:"audio_seconds,omitempty"`
+	// Deadline is when the job is given up on if it has not finished, which
+	// is when RunPod gives up on it under the execution policy it was
+	// submitted with. Jobs without one are given up on after the poller's
+	// job timeout.
+	Deadline time.Time `json:"deadline,omitempty"`
+}
+
+type Transition struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	At   time.Time `json:"at"`
+}
+
+// StatusUpdate is a change to the RunPod-reported state of a job.
+type StatusUpdate struct {
+	RunpodID      string
+	DiarizationID string
+	Status        string
+	Error         string
+	DelayTime     int
+	ExecutionTime int
+	AudioSeconds  float64
+}
+
+var (
+	ErrJobNotFound    = errors.New("job not found")
+	ErrResultNotFound = errors.New("job result not found")
+	ErrJobFinished    = errors.New("job has already finished")
+)
+
+// Store persists transcription jobs and their results.
+type Store interface {
+	Create(ctx context.Context, job *Job) error
+	// Get returns ErrJobNotFound if there is no job with the given id.
+	Get(ctx context.Context, id string) (*Job, error)
+	// UpdateStatus applies update to the job, recording a transition if the
+	// status changed. Empty fields in update are left unchanged. Terminal
+	// statuses are final: UpdateStatus returns ErrJobFinished for a job that
+	// has reached one.
+	UpdateStatus(ctx context.Context, id string, update StatusUpdate) (*Job, error)
+	Transitions(ctx context.Context, id string) ([]Transition, error)
+	// ListActive returns all jobs that have not reached a terminal status.
+	ListActive(ctx context.Context) ([]Job, error)
+	// ListChildren returns the child jobs of a parent job in window order.
+	ListChildren(ctx context.Context, parentID string) ([]Job, error)
+	// ListFinishedParents returns the parent jobs that have finished, along
+	// with all of their children, and whose chunk objects have not been
+	// marked as collected, oldest first.
+	ListFinishedParents(ctx context.Context) ([]Job, error)
+	// MarkChunksCollected records that the chunk objects of a parent job
+	// have been deleted.
+	MarkChunksCollected(ctx context.Context, id string) error
+	// ListByOwner returns the jobs of owner created at or after since, oldest
+	// first.
+	ListByOwner(ctx context.Context, owner string, since time.Time) ([]Job, error)
+	SaveResult(ctx context.Context, id string, output *whisper.WhisperOutput) error
+	// GetResult returns ErrResultNotFound if no result has been saved.
+	GetResult(ctx context.Context, id string) (*whisper.WhisperOutput, error)
+}
+
+// GetStore returns the job store kept in the shared database, which publishes
+// changes to jobs to GetBroker.
+var GetStore = sync.OnceValues(func() (Store, error) {
+	db, err := database.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		return nil, err
+	}
+	return NewPublishingStore(store, GetBroker()), nil
+})
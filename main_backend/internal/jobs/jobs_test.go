@@ -0,0 +1,589 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/diarize"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+func newTestStore(t *testing.T) *jobs.SQLiteStore {
+	store, err := jobs.NewSQLiteStore(database.OpenTest(t))
+	if err != nil {
+		t.Fatalf("Failed to create job store: %v", err)
+	}
+	return store
+}
+
+func testOutput(t *testing.T) *whisper.WhisperOutput {
+	var output whisper.WhisperOutput
+	err := json.Unmarshal([]byte(`{
+		"segments": [{"id": 0, "start": 0, "end": 2.5, "text": " Four score and seven years ago"}],
+		"detected_language": "en",
+		"transcription": "Four score and seven years ago",
+		"model": "tiny"
+	}`), &output)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal test output: %v", err)
+	}
+	return &output
+}
+
+func TestJobLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	job := &jobs.Job{
+		ID:        "job-1",
+		Owner:     "user-1",
+		UploadKey: "gettysburg.wav",
+		Input:     whisper.NewWhisperInput("https://example.com/gettysburg.wav", whisper.WithModel(whisper.WhisperModelTiny)),
+	}
+	err := store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	got, err := store.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if got.Status != jobs.StatusPending || got.Owner != "user-1" || got.UploadKey != "gettysburg.wav" {
+		t.Fatalf("Unexpected job: %+v", got)
+	}
+	if got.Input.Model != whisper.WhisperModelTiny || got.Input.AudioURL != job.Input.AudioURL {
+		t.Fatalf("Job input was not persisted: %+v", got.Input)
+	}
+
+	updates := []jobs.StatusUpdate{
+		{RunpodID: "runpod-1", Status: jobs.StatusQueue},
+		{DiarizationID: "diarization-1"},
+		{Status: jobs.StatusProgress, DelayTime: 100},
+		{Status: jobs.StatusProgress},
+		{Status: jobs.StatusComplete, ExecutionTime: 2000},
+	}
+	for _, update := range updates {
+		_, err = store.UpdateStatus(ctx, job.ID, update)
+		if err != nil {
+			t.Fatalf("Failed to update job: %v", err)
+		}
+	}
+
+	got, err = store.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if got.RunpodID != "runpod-1" || got.DiarizationID != "diarization-1" || got.Status != jobs.StatusComplete || got.DelayTime != 100 || got.ExecutionTime != 2000 {
+		t.Fatalf("Unexpected job after updates: %+v", got)
+	}
+
+	transitions, err := store.Transitions(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get transitions: %v", err)
+	}
+	expected := [][2]string{
+		{jobs.StatusPending, jobs.StatusQueue},
+		{jobs.StatusQueue, jobs.StatusProgress},
+		{jobs.StatusProgress, jobs.StatusComplete},
+	}
+	if len(transitions) != len(expected) {
+		t.Fatalf("Expected %d transitions, got %v", len(expected), transitions)
+	}
+	for i, transition := range transitions {
+		if transition.From != expected[i][0] || transition.To != expected[i][1] {
+			t.Fatalf("Unexpected transition %d: %+v", i, transition)
+		}
+	}
+
+	_, err = store.GetResult(ctx, job.ID)
+	if !errors.Is(err, jobs.ErrResultNotFound) {
+		t.Fatalf("Expected ErrResultNotFound, got %v", err)
+	}
+	err = store.SaveResult(ctx, job.ID, testOutput(t))
+	if err != nil {
+		t.Fatalf("Failed to save result: %v", err)
+	}
+	result, err := store.GetResult(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get result: %v", err)
+	}
+	if len(result.Segments) != 1 || result.Segments[0].Text != " Four score and seven years ago" {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	_, err = store.Get(ctx, "missing")
+	if !errors.Is(err, jobs.ErrJobNotFound) {
+		t.Fatalf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestTerminalStatusIsFinal(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	job := &jobs.Job{ID: "job-1", RunpodID: "runpod-1", Status: jobs.StatusProgress}
+	err := store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	_, err = store.UpdateStatus(ctx, job.ID, jobs.StatusUpdate{Status: jobs.StatusCanceled})
+	if err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+
+	_, err = store.UpdateStatus(ctx, job.ID, jobs.StatusUpdate{Status: jobs.StatusComplete, ExecutionTime: 900})
+	if !errors.Is(err, jobs.ErrJobFinished) {
+		t.Fatalf("Expected ErrJobFinished, got %v", err)
+	}
+
+	// A poll that started before the job was cancelled leaves it cancelled.
+	client := &fakeWhisperClient{
+		status: &whisper.WhisperJobStatus{Status: whisper.StatusComplete, ExecutionTime: 900},
+		output: testOutput(t),
+	}
+	got, err := jobs.Refresh(ctx, store, client, job)
+	if err != nil {
+		t.Fatalf("Failed to refresh job: %v", err)
+	}
+	if got.Status != jobs.StatusCanceled || got.ExecutionTime != 0 {
+		t.Fatalf("Expected job to stay %s, got %+v", jobs.StatusCanceled, got)
+	}
+
+	transitions, err := store.Transitions(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get transitions: %v", err)
+	}
+	if len(transitions) != 1 {
+		t.Fatalf("Expected only the transition to %s, got %v", jobs.StatusCanceled, transitions)
+	}
+}
+
+func TestListActive(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	statuses := map[string]string{
+		"pending":   jobs.StatusPending,
+		"queued":    jobs.StatusQueue,
+		"running":   jobs.StatusProgress,
+		"completed": jobs.StatusComplete,
+		"failed":    jobs.StatusFailed,
+	}
+	for id, status := range statuses {
+		err := store.Create(ctx, &jobs.Job{ID: id, Status: status})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+
+	active, err := store.ListActive(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list active jobs: %v", err)
+	}
+	if len(active) != 3 {
+		t.Fatalf("Expected 3 active jobs, got %v", active)
+	}
+	for _, job := range active {
+		if jobs.IsTerminal(job.Status) {
+			t.Fatalf("Terminal job listed as active: %+v", job)
+		}
+	}
+}
+
+type fakeWhisperClient struct {
+	status *whisper.WhisperJobStatus
+	output *whisper.WhisperOutput
+}
+
+func (c *fakeWhisperClient) Status(ctx context.Context, jobId string) (*whisper.WhisperJobStatus, error) {
+	return c.status, nil
+}
+
+func (c *fakeWhisperClient) Result(ctx context.Context, jobId string) (*whisper.WhisperOutput, error) {
+	return c.output, nil
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	job := &jobs.Job{ID: "job-1", RunpodID: "runpod-1", Status: jobs.StatusQueue}
+	err := store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	client := &fakeWhisperClient{status: &whisper.WhisperJobStatus{Status: whisper.StatusProgress, DelayTime: 50}}
+	job, err = jobs.Refresh(ctx, store, client, job)
+	if err != nil {
+		t.Fatalf("Failed to refresh job: %v", err)
+	}
+	if job.Status != jobs.StatusProgress || job.DelayTime != 50 {
+		t.Fatalf("Unexpected job after refresh: %+v", job)
+	}
+
+	client.status = &whisper.WhisperJobStatus{Status: whisper.StatusComplete, DelayTime: 50, ExecutionTime: 900}
+	client.output = testOutput(t)
+	job, err = jobs.Refresh(ctx, store, client, job)
+	if err != nil {
+		t.Fatalf("Failed to refresh job: %v", err)
+	}
+	if job.Status != jobs.StatusComplete || job.ExecutionTime != 900 {
+		t.Fatalf("Unexpected job after refresh: %+v", job)
+	}
+
+	result, err := store.GetResult(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Completed job has no stored result: %v", err)
+	}
+	if result.Transcription != client.output.Transcription {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	// Terminal jobs are served from the store without asking RunPod again
+	client.status = nil
+	_, err = jobs.Refresh(ctx, store, client, job)
+	if err != nil {
+		t.Fatalf("Failed to refresh completed job: %v", err)
+	}
+}
+
+type fakeDiarizer struct {
+	result *diarize.Result
+}
+
+func (d *fakeDiarizer) Start(ctx context.Context, audioURL string) (string, error) {
+	return "diarization-1", nil
+}
+
+func (d *fakeDiarizer) Status(ctx context.Context, id string) (*diarize.Result, error) {
+	return d.result, nil
+}
+
+func TestRefreshDiarization(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	job := &jobs.Job{ID: "job-1", RunpodID: "runpod-1", DiarizationID: "diarization-1", Status: jobs.StatusProgress}
+	err := store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	client := &fakeWhisperClient{status: &whisper.WhisperJobStatus{Status: whisper.StatusComplete}, output: testOutput(t)}
+	job, err = jobs.Refresh(ctx, store, client, job)
+	if err != nil {
+		t.Fatalf("Failed to refresh job: %v", err)
+	}
+	if job.Status != jobs.StatusDiarizing {
+		t.Fatalf("Expected job to be diarizing, got %s", job.Status)
+	}
+
+	diarizer := &fakeDiarizer{result: &diarize.Result{Status: whisper.StatusProgress}}
+	job, err = jobs.RefreshDiarization(ctx, store, diarizer, job)
+	if err != nil {
+		t.Fatalf("Failed to refresh diarization: %v", err)
+	}
+	if job.Status != jobs.StatusDiarizing {
+		t.Fatalf("Expected job to still be diarizing, got %s", job.Status)
+	}
+
+	diarizer.result = &diarize.Result{
+		Status: whisper.StatusComplete,
+		Turns:  []diarize.Turn{{Speaker: "SPEAKER_00", Start: 0, End: 3}},
+	}
+	job, err = jobs.RefreshDiarization(ctx, store, diarizer, job)
+	if err != nil {
+		t.Fatalf("Failed to refresh diarization: %v", err)
+	}
+	if job.Status != jobs.StatusComplete || job.Error != "" {
+		t.Fatalf("Unexpected job after diarization: %+v", job)
+	}
+
+	result, err := store.GetResult(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get result: %v", err)
+	}
+	if result.Segments[0].Speaker != "SPEAKER_00" {
+		t.Fatalf("Result was not labelled with speakers: %+v", result.Segments)
+	}
+}
+
+func TestRefreshDiarizationFailed(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	job := &jobs.Job{ID: "job-1", RunpodID: "runpod-1", DiarizationID: "diarization-1", Status: jobs.StatusDiarizing}
+	err := store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	err = store.SaveResult(ctx, job.ID, testOutput(t))
+	if err != nil {
+		t.Fatalf("Failed to save result: %v", err)
+	}
+
+	diarizer := &fakeDiarizer{result: &diarize.Result{Status: whisper.StatusFailed, Error: "out of memory"}}
+	job, err = jobs.RefreshDiarization(ctx, store, diarizer, job)
+	if err != nil {
+		t.Fatalf("Failed to refresh diarization: %v", err)
+	}
+	if job.Status != jobs.StatusComplete || job.Error != "diarization FAILED: out of memory" {
+		t.Fatalf("Unexpected job after failed diarization: %+v", job)
+	}
+
+	result, err := store.GetResult(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get result: %v", err)
+	}
+	if result.Segments[0].Speaker != "" {
+		t.Fatalf("Result was labelled despite failed diarization: %+v", result.Segments)
+	}
+}
+
+func TestRefreshParent(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	parent := &jobs.Job{ID: "parent", Chunks: 2}
+	err := store.Create(ctx, parent)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	windows := [][2]float64{{0, 10}, {8, 18}}
+	for i, window := range windows {
+		child := &jobs.Job{
+			ID:         fmt.Sprintf("child-%d", i),
+			ParentID:   parent.ID,
+			RunpodID:   fmt.Sprintf("runpod-%d", i),
+			Status:     jobs.StatusQueue,
+			ChunkStart: window[0],
+			ChunkEnd:   window[1],
+		}
+		err = store.Create(ctx, child)
+		if err != nil {
+			t.Fatalf("Failed to create child job: %v", err)
+		}
+	}
+
+	_, err = store.UpdateStatus(ctx, "child-0", jobs.StatusUpdate{Status: jobs.StatusProgress})
+	if err != nil {
+		t.Fatalf("Failed to update child job: %v", err)
+	}
+	parent, err = jobs.RefreshParent(ctx, store, parent)
+	if err != nil {
+		t.Fatalf("Failed to refresh parent job: %v", err)
+	}
+	if parent.Status != jobs.StatusProgress {
+		t.Fatalf("Expected parent to be in progress, got %s", parent.Status)
+	}
+
+	client := &fakeWhisperClient{status: &whisper.WhisperJobStatus{Status: whisper.StatusComplete, ExecutionTime: 700}}
+	for i := range windows {
+		child, err := store.Get(ctx, fmt.Sprintf("child-%d", i))
+		if err != nil {
+			t.Fatalf("Failed to get child job: %v", err)
+		}
+		client.output = &whisper.WhisperOutput{
+			Segments:         []whisper.Segment{{Start: 1, End: 4, Text: fmt.Sprintf(" chunk %d", i)}},
+			DetectedLanguage: "en",
+		}
+		_, err = jobs.Sync(ctx, store, client, nil, child)
+		if err != nil {
+			t.Fatalf("Failed to refresh child job: %v", err)
+		}
+	}
+
+	parent, err = jobs.Sync(ctx, store, client, nil, parent)
+	if err != nil {
+		t.Fatalf("Failed to refresh parent job: %v", err)
+	}
+	if parent.Status != jobs.StatusComplete || parent.ExecutionTime != 700 {
+		t.Fatalf("Unexpected parent job: %+v", parent)
+	}
+
+	result, err := store.GetResult(ctx, parent.ID)
+	if err != nil {
+		t.Fatalf("Failed to get parent result: %v", err)
+	}
+	if result.Transcription != "chunk 0 chunk 1" || len(result.Segments) != 2 || result.Segments[1].Start != 9 {
+		t.Fatalf("Unexpected stitched result: %+v", result)
+	}
+
+	active, err := store.ListActive(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list active jobs: %v", err)
+	}
+	if len(active) != 0 {
+		t.Fatalf("Expected no active jobs, got %+v", active)
+	}
+}
+
+func TestRefreshParentFailed(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	parent := &jobs.Job{ID: "parent", Chunks: 2}
+	err := store.Create(ctx, parent)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	// Children are still being created
+	err = store.Create(ctx, &jobs.Job{ID: "child-0", ParentID: parent.ID, Status: jobs.StatusFailed, Error: "boom"})
+	if err != nil {
+		t.Fatalf("Failed to create child job: %v", err)
+	}
+	parent, err = jobs.RefreshParent(ctx, store, parent)
+	if err != nil {
+		t.Fatalf("Failed to refresh parent job: %v", err)
+	}
+	if parent.Status != jobs.StatusPending {
+		t.Fatalf("Expected parent to be pending, got %s", parent.Status)
+	}
+
+	err = store.Create(ctx, &jobs.Job{ID: "child-1", ParentID: parent.ID, ChunkStart: 8, Status: jobs.StatusQueue})
+	if err != nil {
+		t.Fatalf("Failed to create child job: %v", err)
+	}
+	parent, err = jobs.RefreshParent(ctx, store, parent)
+	if err != nil {
+		t.Fatalf("Failed to refresh parent job: %v", err)
+	}
+	if parent.Status != jobs.StatusFailed || parent.Error != "chunk 0 FAILED: boom" {
+		t.Fatalf("Unexpected parent job: %+v", parent)
+	}
+}
+
+type fakeCanceller struct {
+	cancelled []string
+	err       error
+}
+
+func (c *fakeCanceller) Cancel(ctx context.Context, jobId string) (*runpod.CancelResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.cancelled = append(c.cancelled, jobId)
+	return &runpod.CancelResponse{JobId: jobId, Status: runpod.StatusCanceled}, nil
+}
+
+func TestCancel(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	job := &jobs.Job{ID: "job-1", RunpodID: "runpod-1", Status: jobs.StatusProgress}
+	err := store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	client := &fakeCanceller{err: errors.New("unavailable")}
+	_, err = jobs.Cancel(ctx, store, client, job)
+	if err == nil {
+		t.Fatalf("Expected an error when RunPod fails to cancel the job")
+	}
+	job, err = store.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Status != jobs.StatusProgress {
+		t.Fatalf("Expected job to be left %s, got %s", jobs.StatusProgress, job.Status)
+	}
+
+	client.err = nil
+	job, err = jobs.Cancel(ctx, store, client, job)
+	if err != nil {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+	if job.Status != jobs.StatusCanceled || len(client.cancelled) != 1 || client.cancelled[0] != "runpod-1" {
+		t.Fatalf("Unexpected job after cancelling: %+v, cancelled %v", job, client.cancelled)
+	}
+
+	_, err = jobs.Cancel(ctx, store, client, job)
+	if !errors.Is(err, jobs.ErrJobFinished) {
+		t.Fatalf("Expected ErrJobFinished, got %v", err)
+	}
+}
+
+func TestCancelParent(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	parent := &jobs.Job{ID: "parent", Chunks: 3, Status: jobs.StatusProgress}
+	children := []*jobs.Job{
+		{ID: "child-0", ParentID: parent.ID, RunpodID: "runpod-0", Status: jobs.StatusComplete},
+		{ID: "child-1", ParentID: parent.ID, RunpodID: "runpod-1", ChunkStart: 8, Status: jobs.StatusProgress},
+		// Not yet submitted to RunPod
+		{ID: "child-2", ParentID: parent.ID, ChunkStart: 16},
+	}
+	for _, job := range append([]*jobs.Job{parent}, children...) {
+		err := store.Create(ctx, job)
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+
+	client := &fakeCanceller{}
+	parent, err := jobs.Cancel(ctx, store, client, parent)
+	if err != nil {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+	if parent.Status != jobs.StatusCanceled {
+		t.Fatalf("Expected parent to be %s, got %s", jobs.StatusCanceled, parent.Status)
+	}
+	if len(client.cancelled) != 1 || client.cancelled[0] != "runpod-1" {
+		t.Fatalf("Expected only the running child to be cancelled on RunPod, got %v", client.cancelled)
+	}
+
+	expected := []string{jobs.StatusComplete, jobs.StatusCanceled, jobs.StatusCanceled}
+	for i, child := range children {
+		got, err := store.Get(ctx, child.ID)
+		if err != nil {
+			t.Fatalf("Failed to get child job: %v", err)
+		}
+		if got.Status != expected[i] {
+			t.Errorf("Expected child %d to be %s, got %s", i, expected[i], got.Status)
+		}
+	}
+}
+
+func TestCancelWhileSubmitted(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	job := &jobs.Job{ID: "job-1"}
+	err := store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	// The job is submitted after it was read for cancelling.
+	_, err = store.UpdateStatus(ctx, job.ID, jobs.StatusUpdate{RunpodID: "runpod-1", Status: jobs.StatusQueue})
+	if err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+
+	client := &fakeCanceller{}
+	got, err := jobs.Cancel(ctx, store, client, job)
+	if err != nil {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+	if got.Status != jobs.StatusCanceled || len(client.cancelled) != 1 || client.cancelled[0] != "runpod-1" {
+		t.Fatalf("Expected the RunPod job to be cancelled, got %+v, cancelled %v", got, client.cancelled)
+	}
+
+	// Submitting a job that has been cancelled fails, so the submitter can
+	// cancel its RunPod job.
+	_, err = store.UpdateStatus(ctx, job.ID, jobs.StatusUpdate{RunpodID: "runpod-2", Status: jobs.StatusQueue})
+	if !errors.Is(err, jobs.ErrJobFinished) {
+		t.Fatalf("Expected ErrJobFinished, got %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/diarize"
+)
+
+const (
+	DefaultPollInterval = 2 * time.Second
+	DefaultMinBackoff   = 2 * time.Second
+	DefaultMaxBackoff   = 1 * time.Minute
+	// DefaultJobTimeout is how long jobs without a deadline may run.
+	DefaultJobTimeout = 2 * time.Hour
+	// DefaultDiarizationTimeout is how long a job may be diarized for.
+	DefaultDiarizationTimeout = 1 * time.Hour
+)
+
+// Poller drives active jobs to completion in the background, so results are
+// stored whether or not a client is polling for them.
+//
+// Each job is polled on its own schedule: the delay before the next poll
+// doubles, up to the maximum backoff, every time the job is found unchanged
+// or RunPod cannot be reached, and is reset when the job changes status.
+//
+// Jobs that are still active after their deadline, or the job timeout if
+// they have none, are marked as timed out, and their RunPod jobs cancelled if
+// the client can cancel jobs. Jobs that are being diarized have already been
+// transcribed, so they are completed without speakers instead once they have
+// been diarized for longer than the diarization timeout.
+type Poller struct {
+	store              Store
+	client             WhisperClient
+	canceller          Canceller
+	diarizer           diarize.Diarizer
+	interval           time.Duration
+	minBackoff         time.Duration
+	maxBackoff         time.Duration
+	timeout            time.Duration
+	diarizationTimeout time.Duration
+
+	schedules map[string]*pollSchedule
+}
+
+type pollSchedule struct {
+	next  time.Time
+	delay time.Duration
+}
+
+type PollerOption func(*Poller)
+
+// WithPollInterval sets how often the poller looks for jobs that are due.
+func WithPollInterval(interval time.Duration) PollerOption {
+	return func(p *Poller) {
+		p.interval = interval
+	}
+}
+
+func WithBackoff(minBackoff time.Duration, maxBackoff time.Duration) PollerOption {
+	return func(p *Poller) {
+		p.minBackoff = minBackoff
+		p.maxBackoff = maxBackoff
+	}
+}
+
+// WithDiarizer lets the poller finish jobs that are being diarized. Without
+// it, DIARIZING jobs are left for a client request to refresh.
+func WithDiarizer(diarizer diarize.Diarizer) PollerOption {
+	return func(p *Poller) {
+		p.diarizer = diarizer
+	}
+}
+
+// WithJobTimeout sets how long jobs without a deadline may run.
+func WithJobTimeout(timeout time.Duration) PollerOption {
+	return func(p *Poller) {
+		p.timeout = timeout
+	}
+}
+
+func WithDiarizationTimeout(timeout time.Duration) PollerOption {
+	return func(p *Poller) {
+		p.diarizationTimeout = timeout
+	}
+}
+
+func NewPoller(store Store, client WhisperClient, options ...PollerOption) *Poller {
+	p := &Poller{
+		store:      store,
+		client:     client,
+		interval:   DefaultPollInterval,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+		timeout:    DefaultJobTimeout,
+		schedules:  make(map[string]*pollSchedule),
+
+		diarizationTimeout: DefaultDiarizationTimeout,
+	}
+	if canceller, ok := client.(Canceller); ok {
+		p.canceller = canceller
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// Run polls until ctx is cancelled.
+func (p *Poller) Run(ctx context.Context) {
+	slog.Info("Starting job poller", "interval", p.interval)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping job poller")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll makes a single pass over the active jobs, refreshing those that are due.
+func (p *Poller) Poll(ctx context.Context) {
+	active, err := p.store.ListActive(ctx)
+	if err != nil {
+		slog.Error("Failed to list active jobs", "error", err)
+		return
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool, len(active))
+	for i := range active {
+		if ctx.Err() != nil {
+			return
+		}
+		job := &active[i]
+		seen[job.ID] = true
+
+		if job.Status == StatusDiarizing {
+			if p.diarizationExpired(ctx, job, now) {
+				p.expireDiarization(ctx, job)
+				continue
+			}
+		} else if now.After(p.deadline(job)) {
+			p.expire(ctx, job)
+			continue
+		}
+
+		schedule, ok := p.schedules[job.ID]
+		if !ok {
+			schedule = &pollSchedule{next: now, delay: p.minBackoff}
+			p.schedules[job.ID] = schedule
+		}
+		if now.Before(schedule.next) {
+			continue
+		}
+
+		p.poll(ctx, job, schedule, now)
+	}
+
+	// Forget jobs that were finished elsewhere, e.g. by a client request.
+	for id := range p.schedules {
+		if !seen[id] {
+			delete(p.schedules, id)
+		}
+	}
+}
+
+func (p *Poller) poll(ctx context.Context, job *Job, schedule *pollSchedule, now time.Time) {
+	updated, err := Sync(ctx, p.store, p.client, p.diarizer, job)
+	if err != nil {
+		slog.Error("Failed to poll job", "jobId", job.ID, "error", err)
+		p.backoff(schedule, now)
+		return
+	}
+
+	if IsTerminal(updated.Status) {
+		slog.Info("Job finished", "jobId", job.ID, "status", updated.Status)
+		delete(p.schedules, job.ID)
+		return
+	}
+
+	if updated.Status != job.Status {
+		schedule.delay = p.minBackoff
+		schedule.next = now.Add(schedule.delay)
+		return
+	}
+	p.backoff(schedule, now)
+}
+
+func (p *Poller) backoff(schedule *pollSchedule, now time.Time) {
+	schedule.next = now.Add(schedule.delay)
+	schedule.delay = min(schedule.delay*2, p.maxBackoff)
+}
+
+func (p *Poller) deadline(job *Job) time.Time {
+	if !job.Deadline.IsZero() {
+		return job.Deadline
+	}
+	return job.CreatedAt.Add(p.timeout)
+}
+
+func (p *Poller) expire(ctx context.Context, job *Job) {
+	deadline := p.deadline(job)
+	slog.Warn("Job timed out", "jobId", job.ID, "status", job.Status, "createdAt", job.CreatedAt, "deadline", deadline)
+	_, err := stop(ctx, p.store, p.canceller, job, StatusUpdate{
+		Status: StatusTimeout,
+		Error:  "job did not finish within " + deadline.Sub(job.CreatedAt).Round(time.Second).String(),
+	})
+	if err != nil && !errors.Is(err, ErrJobFinished) {
+		slog.Error("Failed to mark job as timed out", "jobId", job.ID, "error", err)
+		return
+	}
+	delete(p.schedules, job.ID)
+}
+
+// diarizationExpired reports whether job has been diarized for longer than
+// the diarization timeout.
+func (p *Poller) diarizationExpired(ctx context.Context, job *Job, now time.Time) bool {
+	transitions, err := p.store.Transitions(ctx, job.ID)
+	if err != nil {
+		slog.Error("Failed to get job transitions", "jobId", job.ID, "error", err)
+		return false
+	}
+	for i := len(transitions) - 1; i >= 0; i-- {
+		if transitions[i].To == StatusDiarizing {
+			return now.Sub(transitions[i].At) > p.diarizationTimeout
+		}
+	}
+	return now.Sub(job.UpdatedAt) > p.diarizationTimeout
+}
+
+// expireDiarization completes job with its transcript unlabelled, as if its
+// diarization had failed.
+func (p *Poller) expireDiarization(ctx context.Context, job *Job) {
+	slog.Warn("Diarization timed out", "jobId", job.ID, "diarizationId", job.DiarizationID)
+	_, err := p.store.UpdateStatus(ctx, job.ID, StatusUpdate{
+		Status: StatusComplete,
+		Error:  "diarization " + StatusTimeout + " after " + p.diarizationTimeout.String(),
+	})
+	if err != nil && !errors.Is(err, ErrJobFinished) {
+		slog.Error("Failed to complete job", "jobId", job.ID, "error", err)
+		return
+	}
+	delete(p.schedules, job.ID)
+}
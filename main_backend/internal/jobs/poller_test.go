@@ -0,0 +1,283 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+// fakeRunpod serves RunPod's /status endpoint from a script of responses per
+// job, repeating the last response once the script runs out.
+type fakeRunpod struct {
+	mu        sync.Mutex
+	scripts   map[string][]map[string]any
+	calls     map[string]int
+	cancelled []string
+}
+
+func newFakeRunpod(t *testing.T, scripts map[string][]map[string]any) (*fakeRunpod, *whisper.RunpodWhisperClient) {
+	fake := &fakeRunpod{scripts: scripts, calls: make(map[string]int)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		id := r.PathValue("id")
+		script, ok := fake.scripts[id]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		response := script[min(fake.calls[id], len(script)-1)]
+		fake.calls[id]++
+		json.NewEncoder(w).Encode(response)
+	})
+	mux.HandleFunc("POST /cancel/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		id := r.PathValue("id")
+		fake.cancelled = append(fake.cancelled, id)
+		json.NewEncoder(w).Encode(status(id, whisper.StatusCanceled))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := whisper.NewRunpodWhisperClient("test-api-key", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create whisper client: %v", err)
+	}
+	return fake, client
+}
+
+func (f *fakeRunpod) callCount(id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[id]
+}
+
+func (f *fakeRunpod) cancelledJobs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cancelled
+}
+
+func status(id string, status string) map[string]any {
+	return map[string]any{"id": id, "status": status}
+}
+
+func TestPollerDrivesJobsToCompletion(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	output := map[string]any{
+		"segments":      []map[string]any{{"id": 0, "start": 0, "end": 2.5, "text": " Four score"}},
+		"transcription": "Four score",
+	}
+	fake, client := newFakeRunpod(t, map[string][]map[string]any{
+		"runpod-ok": {
+			status("runpod-ok", whisper.StatusQueue),
+			status("runpod-ok", whisper.StatusProgress),
+			{"id": "runpod-ok", "status": whisper.StatusComplete, "delayTime": 10, "executionTime": 200, "output": output},
+		},
+		"runpod-fail": {
+			{"id": "runpod-fail", "status": whisper.StatusFailed, "error": "out of memory"},
+		},
+	})
+
+	for id, runpodID := range map[string]string{"job-ok": "runpod-ok", "job-fail": "runpod-fail"} {
+		err := store.Create(ctx, &jobs.Job{ID: id, RunpodID: runpodID, Status: jobs.StatusQueue})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+
+	poller := jobs.NewPoller(store, client, jobs.WithBackoff(0, 0))
+	for i := 0; i < 5; i++ {
+		poller.Poll(ctx)
+	}
+
+	job, err := store.Get(ctx, "job-ok")
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Status != jobs.StatusComplete || job.ExecutionTime != 200 {
+		t.Fatalf("Unexpected job: %+v", job)
+	}
+	result, err := store.GetResult(ctx, "job-ok")
+	if err != nil {
+		t.Fatalf("Completed job has no stored result: %v", err)
+	}
+	if result.Transcription != "Four score" || len(result.Segments) != 1 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	job, err = store.Get(ctx, "job-fail")
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Status != jobs.StatusFailed || job.Error != "out of memory" {
+		t.Fatalf("Unexpected job: %+v", job)
+	}
+	if calls := fake.callCount("runpod-fail"); calls != 1 {
+		t.Fatalf("Expected failed job to be polled once, got %d", calls)
+	}
+}
+
+func TestPollerBackoff(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	fake, client := newFakeRunpod(t, map[string][]map[string]any{
+		"runpod-1": {status("runpod-1", whisper.StatusQueue)},
+	})
+	err := store.Create(ctx, &jobs.Job{ID: "job-1", RunpodID: "runpod-1", Status: jobs.StatusQueue})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	poller := jobs.NewPoller(store, client, jobs.WithBackoff(time.Hour, time.Hour))
+	for i := 0; i < 3; i++ {
+		poller.Poll(ctx)
+	}
+
+	if calls := fake.callCount("runpod-1"); calls != 1 {
+		t.Fatalf("Expected unchanged job to be polled once within its backoff, got %d", calls)
+	}
+}
+
+func TestPollerTimeout(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	fake, client := newFakeRunpod(t, map[string][]map[string]any{
+		"runpod-1": {status("runpod-1", whisper.StatusQueue)},
+	})
+	err := store.Create(ctx, &jobs.Job{
+		ID:        "job-1",
+		RunpodID:  "runpod-1",
+		Status:    jobs.StatusQueue,
+		CreatedAt: time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	jobs.NewPoller(store, client, jobs.WithJobTimeout(time.Minute)).Poll(ctx)
+
+	job, err := store.Get(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Status != jobs.StatusTimeout {
+		t.Fatalf("Expected job to time out, got %+v", job)
+	}
+	if calls := fake.callCount("runpod-1"); calls != 0 {
+		t.Fatalf("Expected timed out job not to be polled, got %d calls", calls)
+	}
+	if cancelled := fake.cancelledJobs(); len(cancelled) != 1 || cancelled[0] != "runpod-1" {
+		t.Fatalf("Expected the RunPod job to be cancelled, got %v", cancelled)
+	}
+}
+
+func TestPollerDeadline(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	fake, client := newFakeRunpod(t, map[string][]map[string]any{
+		"runpod-1": {status("runpod-1", whisper.StatusProgress)},
+		"runpod-2": {status("runpod-2", whisper.StatusProgress)},
+	})
+	// Both jobs are older than the job timeout, but only the first is past
+	// its deadline.
+	for _, job := range []*jobs.Job{
+		{ID: "job-1", RunpodID: "runpod-1", Status: jobs.StatusProgress, CreatedAt: time.Now().Add(-time.Hour), Deadline: time.Now().Add(-time.Minute)},
+		{ID: "job-2", RunpodID: "runpod-2", Status: jobs.StatusProgress, CreatedAt: time.Now().Add(-time.Hour), Deadline: time.Now().Add(time.Hour)},
+	} {
+		err := store.Create(ctx, job)
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+
+	jobs.NewPoller(store, client, jobs.WithJobTimeout(time.Minute)).Poll(ctx)
+
+	for id, expected := range map[string]string{"job-1": jobs.StatusTimeout, "job-2": jobs.StatusProgress} {
+		job, err := store.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.Status != expected {
+			t.Errorf("Expected %s to be %s, got %s", id, expected, job.Status)
+		}
+	}
+	if cancelled := fake.cancelledJobs(); len(cancelled) != 1 || cancelled[0] != "runpod-1" {
+		t.Errorf("Expected only the expired RunPod job to be cancelled, got %v", cancelled)
+	}
+}
+
+func TestPollerDiarizationTimeout(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	fake, client := newFakeRunpod(t, nil)
+	job := &jobs.Job{ID: "job-1", RunpodID: "runpod-1", DiarizationID: "diarization-1", Status: jobs.StatusProgress, CreatedAt: time.Now().Add(-3 * time.Hour)}
+	err := store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	_, err = store.UpdateStatus(ctx, job.ID, jobs.StatusUpdate{Status: jobs.StatusDiarizing})
+	if err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+
+	// A slow diarization does not time out the job it was started for.
+	jobs.NewPoller(store, client, jobs.WithJobTimeout(time.Minute)).Poll(ctx)
+	job, err = store.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Status != jobs.StatusDiarizing {
+		t.Fatalf("Expected job to be %s, got %s", jobs.StatusDiarizing, job.Status)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	jobs.NewPoller(store, client, jobs.WithDiarizationTimeout(time.Millisecond)).Poll(ctx)
+	job, err = store.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Status != jobs.StatusComplete || job.Error == "" {
+		t.Fatalf("Expected job to complete with an error, got %+v", job)
+	}
+	if cancelled := fake.cancelledJobs(); len(cancelled) != 0 {
+		t.Errorf("Expected no RunPod job to be cancelled, got %v", cancelled)
+	}
+}
+
+func TestPollerStopsWithContext(t *testing.T) {
+	store := newTestStore(t)
+	_, client := newFakeRunpod(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		jobs.NewPoller(store, client, jobs.WithPollInterval(10*time.Millisecond)).Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Poller did not stop after its context was cancelled")
+	}
+}
@@ -0,0 +1,201 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/chunking"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/diarize"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+// WhisperClient is the part of whisper.Transcriber used to track jobs.
+type WhisperClient interface {
+	Status(ctx context.Context, jobId string) (*whisper.WhisperJobStatus, error)
+	Result(ctx context.Context, jobId string) (*whisper.WhisperOutput, error)
+}
+
+// Sync brings job up to date with whatever it is waiting on: its RunPod job,
+// its child jobs or its diarization. DIARIZING jobs are left as they are if
+// diarizer is nil.
+func Sync(ctx context.Context, store Store, client WhisperClient, diarizer diarize.Diarizer, job *Job) (*Job, error) {
+	switch {
+	case IsTerminal(job.Status):
+		return job, nil
+	case job.Status == StatusDiarizing:
+		if diarizer == nil {
+			return job, nil
+		}
+		return RefreshDiarization(ctx, store, diarizer, job)
+	case job.Chunks > 0:
+		return RefreshParent(ctx, store, job)
+	default:
+		return Refresh(ctx, store, client, job)
+	}
+}
+
+// Refresh fetches the latest RunPod status of job and persists it.
+func Refresh(ctx context.Context, store Store, client WhisperClient, job *Job) (*Job, error) {
+	if IsTerminal(job.Status) || job.Status == StatusDiarizing || job.Chunks > 0 || job.RunpodID == "" {
+		return job, nil
+	}
+
+	status, err := client.Status(ctx, job.RunpodID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status of job %s: %w", job.ID, err)
+	}
+
+	var output *whisper.WhisperOutput
+	if status.Status == StatusComplete {
+		output, err = client.Result(ctx, job.RunpodID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get result of job %s: %w", job.ID, err)
+		}
+	}
+
+	return Apply(ctx, store, job, status, output)
+}
+
+// Apply records a RunPod status report for job, however it was received.
+// When the job has completed, output is saved before the status is, so a
+// COMPLETED job always has a result in the store. A completed job that is
+// being diarized moves to DIARIZING instead. Reports for jobs that have
+// already finished transcribing are ignored.
+func Apply(ctx context.Context, store Store, job *Job, status *whisper.WhisperJobStatus, output *whisper.WhisperOutput) (*Job, error) {
+	if IsTerminal(job.Status) || job.Status == StatusDiarizing {
+		return job, nil
+	}
+
+	update := StatusUpdate{
+		Status:        status.Status,
+		Error:         status.Error,
+		DelayTime:     status.DelayTime,
+		ExecutionTime: status.ExecutionTime,
+	}
+	if status.Status == StatusComplete {
+		if output == nil {
+			return nil, fmt.Errorf("job %s completed without output", job.ID)
+		}
+		err := store.SaveResult(ctx, job.ID, output)
+		if err != nil {
+			return nil, err
+		}
+		if job.DiarizationID != "" {
+			update.Status = StatusDiarizing
+		}
+		if job.AudioSeconds == 0 && len(output.Segments) > 0 {
+			update.AudioSeconds = output.Segments[len(output.Segments)-1].End
+		}
+	}
+
+	return updateStatus(ctx, store, job.ID, update)
+}
+
+// updateStatus applies update to the job with the given id. If the job has
+// finished since it was read, e.g. because it was cancelled or timed out
+// while RunPod was polled, the finished job is returned instead.
+func updateStatus(ctx context.Context, store Store, id string, update StatusUpdate) (*Job, error) {
+	job, err := store.UpdateStatus(ctx, id, update)
+	if errors.Is(err, ErrJobFinished) {
+		return store.Get(ctx, id)
+	}
+	return job, err
+}
+
+// RefreshParent derives the status of a parent job from its children. Once
+// every child has completed, their results are stitched into the parent's.
+// If any child fails, so does the parent.
+func RefreshParent(ctx context.Context, store Store, job *Job) (*Job, error) {
+	if IsTerminal(job.Status) || job.Status == StatusDiarizing {
+		return job, nil
+	}
+
+	children, err := store.ListChildren(ctx, job.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list children of job %s: %w", job.ID, err)
+	}
+	if len(children) != job.Chunks {
+		// Children are still being created.
+		return job, nil
+	}
+
+	status := StatusComplete
+	for i, child := range children {
+		switch child.Status {
+		case StatusComplete:
+		case StatusFailed, StatusCanceled, StatusTimeout:
+			chunkErr := fmt.Sprintf("chunk %d %s", i, child.Status)
+			if child.Error != "" {
+				chunkErr += ": " + child.Error
+			}
+			return updateStatus(ctx, store, job.ID, StatusUpdate{Status: StatusFailed, Error: chunkErr})
+		case StatusProgress:
+			status = StatusProgress
+		default:
+			if status == StatusComplete {
+				status = StatusQueue
+			}
+		}
+	}
+
+	if status != StatusComplete {
+		if status == job.Status {
+			return job, nil
+		}
+		return updateStatus(ctx, store, job.ID, StatusUpdate{Status: status})
+	}
+
+	pieces := make([]chunking.Piece, len(children))
+	var executionTime int
+	for i, child := range children {
+		output, err := store.GetResult(ctx, child.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get result of chunk %d of job %s: %w", i, job.ID, err)
+		}
+		pieces[i] = chunking.Piece{Start: child.ChunkStart, End: child.ChunkEnd, Output: output}
+		executionTime = max(executionTime, child.ExecutionTime)
+	}
+
+	return Apply(ctx, store, job, &whisper.WhisperJobStatus{
+		Status:        StatusComplete,
+		ExecutionTime: executionTime,
+	}, chunking.Stitch(pieces))
+}
+
+// RefreshDiarization checks on the diarization of a DIARIZING job. Once it
+// has finished, the stored result is labelled with speakers and the job is
+// completed. A failed diarization still completes the job, with the
+// transcript unlabelled and the failure recorded in the job's error.
+func RefreshDiarization(ctx context.Context, store Store, diarizer diarize.Diarizer, job *Job) (*Job, error) {
+	if job.Status != StatusDiarizing {
+		return job, nil
+	}
+
+	result, err := diarizer.Status(ctx, job.DiarizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diarization status of job %s: %w", job.ID, err)
+	}
+
+	switch result.Status {
+	case StatusComplete:
+		output, err := store.GetResult(ctx, job.ID)
+		if err != nil {
+			return nil, err
+		}
+		diarize.Label(output.Segments, result.Turns)
+		err = store.SaveResult(ctx, job.ID, output)
+		if err != nil {
+			return nil, err
+		}
+		return updateStatus(ctx, store, job.ID, StatusUpdate{Status: StatusComplete})
+	case StatusFailed, StatusCanceled, StatusTimeout:
+		diarizationErr := "diarization " + result.Status
+		if result.Error != "" {
+			diarizationErr += ": " + result.Error
+		}
+		return updateStatus(ctx, store, job.ID, StatusUpdate{Status: StatusComplete, Error: diarizationErr})
+	default:
+		return job, nil
+	}
+}
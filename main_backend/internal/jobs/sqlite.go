@@ -0,0 +1,341 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS jobs (
+	id             TEXT PRIMARY KEY,
+	owner          TEXT NOT NULL DEFAULT '',
+	upload_key     TEXT NOT NULL DEFAULT '',
+	input          TEXT NOT NULL,
+	runpod_id      TEXT NOT NULL DEFAULT '',
+	status         TEXT NOT NULL,
+	error          TEXT NOT NULL DEFAULT '',
+	delay_time     INTEGER NOT NULL DEFAULT 0,
+	execution_time INTEGER NOT NULL DEFAULT 0,
+	created_at     INTEGER NOT NULL,
+	updated_at     INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_status ON jobs (status);
+CREATE INDEX IF NOT EXISTS jobs_owner ON jobs (owner);
+
+CREATE TABLE IF NOT EXISTS job_transitions (
+	job_id      TEXT NOT NULL REFERENCES jobs (id) ON DELETE CASCADE,
+	from_status TEXT NOT NULL,
+	to_status   TEXT NOT NULL,
+	at          INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS job_transitions_job_id ON job_transitions (job_id);
+
+CREATE TABLE IF NOT EXISTS job_results (
+	job_id TEXT PRIMARY KEY REFERENCES jobs (id) ON DELETE CASCADE,
+	output TEXT NOT NULL
+);`,
+	`ALTER TABLE jobs ADD COLUMN webhook_secret_hash TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE jobs ADD COLUMN diarization_id TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE jobs ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE jobs ADD COLUMN chunks INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN chunk_start REAL NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN chunk_end REAL NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS jobs_parent_id ON jobs (parent_id);`,
+	`ALTER TABLE jobs ADD COLUMN audio_seconds REAL NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS jobs_owner_created_at ON jobs (owner, created_at);`,
+	`ALTER TABLE jobs ADD COLUMN chunks_collected INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE jobs ADD COLUMN deadline INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// SQLiteStore is the default Store implementation.
+type SQLiteStore struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	err := database.Migrate(db, "jobs", migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLiteStore{
+		db:  db,
+		now: time.Now,
+	}, nil
+}
+
+const jobColumns = `id, owner, upload_key, input, runpod_id, status, error, delay_time, execution_time, created_at, updated_at,
+	webhook_secret_hash, diarization_id, parent_id, chunks, chunk_start, chunk_end, audio_seconds, deadline`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row scanner) (*Job, error) {
+	var job Job
+	var input string
+	var createdAt, updatedAt, deadline int64
+	err := row.Scan(&job.ID, &job.Owner, &job.UploadKey, &input, &job.RunpodID, &job.Status, &job.Error,
+		&job.DelayTime, &job.ExecutionTime, &createdAt, &updatedAt, &job.WebhookSecretHash, &job.DiarizationID,
+		&job.ParentID, &job.Chunks, &job.ChunkStart, &job.ChunkEnd, &job.AudioSeconds, &deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(input), &job.Input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job input: %w", err)
+	}
+	job.CreatedAt = time.UnixMilli(createdAt)
+	job.UpdatedAt = time.UnixMilli(updatedAt)
+	if deadline != 0 {
+		job.Deadline = time.UnixMilli(deadline)
+	}
+
+	return &job, nil
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, job *Job) error {
+	input, err := json.Marshal(job.Input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job input: %w", err)
+	}
+
+	now := s.now()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	job.UpdatedAt = now
+	if job.Status == "" {
+		job.Status = StatusPending
+	}
+
+	var deadline int64
+	if !job.Deadline.IsZero() {
+		deadline = job.Deadline.UnixMilli()
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO jobs (`+jobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Owner, job.UploadKey, string(input), job.RunpodID, job.Status, job.Error,
+		job.DelayTime, job.ExecutionTime, job.CreatedAt.UnixMilli(), job.UpdatedAt.UnixMilli(), job.WebhookSecretHash, job.DiarizationID,
+		job.ParentID, job.Chunks, job.ChunkStart, job.ChunkEnd, job.AudioSeconds, deadline)
+	if err != nil {
+		return fmt.Errorf("failed to insert job: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, id string) (*Job, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *SQLiteStore) UpdateStatus(ctx context.Context, id string, update StatusUpdate) (*Job, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	job, err := scanJob(tx.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if IsTerminal(job.Status) {
+		return nil, ErrJobFinished
+	}
+
+	now := s.now()
+	if update.Status != "" && update.Status != job.Status {
+		_, err = tx.ExecContext(ctx, `INSERT INTO job_transitions (job_id, from_status, to_status, at) VALUES (?, ?, ?, ?)`,
+			id, job.Status, update.Status, now.UnixMilli())
+		if err != nil {
+			return nil, fmt.Errorf("failed to record transition: %w", err)
+		}
+		job.Status = update.Status
+	}
+	if update.RunpodID != "" {
+		job.RunpodID = update.RunpodID
+	}
+	if update.DiarizationID != "" {
+		job.DiarizationID = update.DiarizationID
+	}
+	if update.Error != "" {
+		job.Error = update.Error
+	}
+	if update.DelayTime != 0 {
+		job.DelayTime = update.DelayTime
+	}
+	if update.ExecutionTime != 0 {
+		job.ExecutionTime = update.ExecutionTime
+	}
+	if update.AudioSeconds != 0 {
+		job.AudioSeconds = update.AudioSeconds
+	}
+	job.UpdatedAt = now
+
+	// The status is checked again in the update in case the job finished
+	// after it was read.
+	result, err := tx.ExecContext(ctx, `UPDATE jobs SET runpod_id = ?, diarization_id = ?, status = ?, error = ?, delay_time = ?, execution_time = ?, audio_seconds = ?, updated_at = ?
+		WHERE id = ? AND status NOT IN (?, ?, ?, ?)`,
+		job.RunpodID, job.DiarizationID, job.Status, job.Error, job.DelayTime, job.ExecutionTime, job.AudioSeconds, job.UpdatedAt.UnixMilli(), id,
+		StatusComplete, StatusFailed, StatusCanceled, StatusTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update job: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update job: %w", err)
+	}
+	if updated == 0 {
+		return nil, ErrJobFinished
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *SQLiteStore) Transitions(ctx context.Context, id string) ([]Transition, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT from_status, to_status, at FROM job_transitions WHERE job_id = ? ORDER BY rowid`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transitions []Transition
+	for rows.Next() {
+		var transition Transition
+		var at int64
+		err = rows.Scan(&transition.From, &transition.To, &at)
+		if err != nil {
+			return nil, err
+		}
+		transition.At = time.UnixMilli(at)
+		transitions = append(transitions, transition)
+	}
+	return transitions, rows.Err()
+}
+
+func (s *SQLiteStore) ListActive(ctx context.Context) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE status NOT IN (?, ?, ?, ?) ORDER BY created_at`,
+		StatusComplete, StatusFailed, StatusCanceled, StatusTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+func (s *SQLiteStore) ListChildren(ctx context.Context, parentID string) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE parent_id = ? ORDER BY chunk_start`, parentID)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+func (s *SQLiteStore) ListByOwner(ctx context.Context, owner string, since time.Time) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE owner = ? AND created_at >= ? ORDER BY created_at`,
+		owner, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *SQLiteStore) SaveResult(ctx context.Context, id string, output *whisper.WhisperOutput) error {
+	outputJSON, err := json.Marshal(output)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job result: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO job_results (job_id, output) VALUES (?, ?) ON CONFLICT (job_id) DO UPDATE SET output = excluded.output`,
+		id, string(outputJSON))
+	if err != nil {
+		return fmt.Errorf("failed to save job result: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetResult(ctx context.Context, id string) (*whisper.WhisperOutput, error) {
+	var outputJSON string
+	err := s.db.QueryRowContext(ctx, `SELECT output FROM job_results WHERE job_id = ?`, id).Scan(&outputJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrResultNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var output whisper.WhisperOutput
+	err = json.Unmarshal([]byte(outputJSON), &output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job result: %w", err)
+	}
+	return &output, nil
+}
+
+func (s *SQLiteStore) ListFinishedParents(ctx context.Context) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs AS parent
+		WHERE chunks > 0 AND chunks_collected = 0 AND status IN (?, ?, ?, ?)
+		AND NOT EXISTS (SELECT 1 FROM jobs AS child WHERE child.parent_id = parent.id AND child.status NOT IN (?, ?, ?, ?))
+		ORDER BY created_at`,
+		StatusComplete, StatusFailed, StatusCanceled, StatusTimeout,
+		StatusComplete, StatusFailed, StatusCanceled, StatusTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+func (s *SQLiteStore) MarkChunksCollected(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE jobs SET chunks_collected = 1 WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
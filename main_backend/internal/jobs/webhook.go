@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// RunPod calls a job's webhook when the job finishes. The webhook URL ends in
+// a token of the form "<job id>.<secret>"; only the hash of the secret is
+// stored, so the token cannot be recovered from the database.
+
+var ErrInvalidWebhookToken = errors.New("invalid webhook token")
+
+func hashWebhookSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewWebhookToken generates a webhook token for job and sets the job's
+// WebhookSecretHash accordingly. It must be called before the job is created.
+func NewWebhookToken(job *Job) (string, error) {
+	secretBytes := make([]byte, 32)
+	_, err := rand.Read(secretBytes)
+	if err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	job.WebhookSecretHash = hashWebhookSecret(secret)
+	return job.ID + "." + secret, nil
+}
+
+// ParseWebhookToken returns the job id a webhook token was issued for. The
+// token must still be checked against the job with VerifyWebhookToken.
+func ParseWebhookToken(token string) (jobID string, err error) {
+	jobID, _, ok := strings.Cut(token, ".")
+	if !ok || jobID == "" {
+		return "", ErrInvalidWebhookToken
+	}
+	return jobID, nil
+}
+
+func VerifyWebhookToken(job *Job, token string) error {
+	jobID, secret, ok := strings.Cut(token, ".")
+	if !ok || jobID != job.ID || job.WebhookSecretHash == "" {
+		return ErrInvalidWebhookToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashWebhookSecret(secret)), []byte(job.WebhookSecretHash)) != 1 {
+		return ErrInvalidWebhookToken
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+func TestWebhookToken(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	job := &jobs.Job{ID: "job-1"}
+	token, err := jobs.NewWebhookToken(job)
+	if err != nil {
+		t.Fatalf("Failed to create webhook token: %v", err)
+	}
+	if strings.Contains(token, job.WebhookSecretHash) {
+		t.Fatalf("Webhook token contains its own hash: %s", token)
+	}
+
+	err = store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	jobID, err := jobs.ParseWebhookToken(token)
+	if err != nil {
+		t.Fatalf("Failed to parse webhook token: %v", err)
+	}
+	got, err := store.Get(ctx, jobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+
+	err = jobs.VerifyWebhookToken(got, token)
+	if err != nil {
+		t.Fatalf("Failed to verify webhook token: %v", err)
+	}
+
+	invalidTokens := []string{
+		"",
+		job.ID,
+		job.ID + ".",
+		job.ID + ".not-the-secret",
+		"job-2" + token[len(job.ID):],
+	}
+	for _, invalid := range invalidTokens {
+		err = jobs.VerifyWebhookToken(got, invalid)
+		if !errors.Is(err, jobs.ErrInvalidWebhookToken) {
+			t.Fatalf("Expected ErrInvalidWebhookToken for %q, got %v", invalid, err)
+		}
+	}
+
+	err = jobs.VerifyWebhookToken(&jobs.Job{ID: job.ID}, token)
+	if !errors.Is(err, jobs.ErrInvalidWebhookToken) {
+		t.Fatalf("Expected ErrInvalidWebhookToken for job without webhook, got %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	job := &jobs.Job{ID: "job-1", RunpodID: "runpod-1", Status: jobs.StatusQueue}
+	err := store.Create(ctx, job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	_, err = jobs.Apply(ctx, store, job, &whisper.WhisperJobStatus{Status: jobs.StatusComplete}, nil)
+	if err == nil {
+		t.Fatalf("Expected error applying completion without output")
+	}
+
+	output := testOutput(t)
+	job, err = jobs.Apply(ctx, store, job, &whisper.WhisperJobStatus{Status: jobs.StatusComplete, ExecutionTime: 1500}, output)
+	if err != nil {
+		t.Fatalf("Failed to apply status: %v", err)
+	}
+	if job.Status != jobs.StatusComplete || job.ExecutionTime != 1500 {
+		t.Fatalf("Unexpected job: %+v", job)
+	}
+
+	result, err := store.GetResult(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get result: %v", err)
+	}
+	if result.Transcription != output.Transcription {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	// A repeated delivery must not change a finished job.
+	job, err = jobs.Apply(ctx, store, job, &whisper.WhisperJobStatus{Status: jobs.StatusFailed, Error: "late"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to apply status: %v", err)
+	}
+	if job.Status != jobs.StatusComplete || job.Error != "" {
+		t.Fatalf("Finished job was changed: %+v", job)
+	}
+}
@@ -0,0 +1,67 @@
+package localstore
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"path"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+)
+
+// HandleUpload serves presigned PUT URLs. It is meant to be registered as
+// "PUT /storage/local/{key...}".
+func (s *LocalStore) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	err := s.Verify(http.MethodPut, key, r.URL.Query(), r.Header)
+	if err != nil {
+		slog.Error("Rejected local storage upload", "key", key, "error", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	defer r.Body.Close()
+	err = s.WriteChecksum(key, r.Body, ChecksumFromHeader(r.Header))
+	if errors.Is(err, ErrInvalidKey) || errors.Is(err, objectstore.ErrChecksumMismatch) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to write object", "key", key, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleDownload serves presigned GET URLs. It is meant to be registered as
+// "GET /storage/local/{key...}".
+func (s *LocalStore) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	err := s.Verify(http.MethodGet, key, r.URL.Query(), http.Header{})
+	if err != nil {
+		slog.Error("Rejected local storage download", "key", key, "error", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	f, err := s.Open(key)
+	if errors.Is(err, objectstore.ErrObjectNotExist) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.ServeContent(w, r, path.Base(key), info.ModTime(), f)
+}
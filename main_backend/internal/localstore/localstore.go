@@ -0,0 +1,404 @@
+package localstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+)
+
+// RoutePrefix is where the backend serves presigned local storage URLs.
+const RoutePrefix = "/storage/local"
+
+// GetStore returns a LocalStore configured from the environment:
+//   - LOCAL_STORAGE_DIR: directory to keep objects in (default: <project root>/local_storage)
+//   - LOCAL_STORAGE_URL: externally reachable base URL of this backend (default: http://localhost:$PORT)
+//   - LOCAL_STORAGE_SECRET: key used to sign URLs (default: random, so URLs do not survive a restart)
+var GetStore = sync.OnceValues(func() (*LocalStore, error) {
+	dir := os.Getenv("LOCAL_STORAGE_DIR")
+	if dir == "" {
+		dir = filepath.Join(utils.Root, "local_storage")
+	}
+
+	baseURL := os.Getenv("LOCAL_STORAGE_URL")
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("http://localhost:%s", utils.GetEnvAssert("PORT"))
+	}
+
+	secret := []byte(os.Getenv("LOCAL_STORAGE_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewLocalStore(dir, baseURL+RoutePrefix, secret)
+})
+
+// LocalStore is an objectstore.ObjectStore that keeps objects on the local
+// filesystem. Presigned URLs point back at the backend itself, and are
+// authenticated with an HMAC over the method, key and expiry.
+type LocalStore struct {
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+var (
+	_ objectstore.ObjectStore       = (*LocalStore)(nil)
+	_ objectstore.ChecksumPresigner = (*LocalStore)(nil)
+)
+
+var (
+	ErrInvalidKey       = errors.New("invalid object key")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrURLExpired       = errors.New("presigned url has expired")
+)
+
+func NewLocalStore(root string, baseURL string, secret []byte) (*LocalStore, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("local store secret is required")
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+	}, nil
+}
+
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	err := validateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// CRC32CHeader carries the expected CRC32C of an upload, like Content-MD5
+// carries its MD5.
+const CRC32CHeader = "X-Checksum-Crc32c"
+
+func checksumHeaders(checksum objectstore.Checksum) http.Header {
+	headers := http.Header{}
+	if checksum.MD5 != "" {
+		headers.Set("Content-MD5", checksum.MD5)
+	}
+	if checksum.CRC32C != "" {
+		headers.Set(CRC32CHeader, checksum.CRC32C)
+	}
+	return headers
+}
+
+// ChecksumFromHeader returns the checksum a request declares for its body.
+func ChecksumFromHeader(header http.Header) objectstore.Checksum {
+	return objectstore.Checksum{
+		MD5:    header.Get("Content-MD5"),
+		CRC32C: header.Get(CRC32CHeader),
+	}
+}
+
+// sign covers the checksum headers too, so they cannot be dropped from a
+// presigned upload.
+func (s *LocalStore) sign(method string, key string, expires int64, checksum objectstore.Checksum) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s\n%s", method, key, expires, checksum.MD5, checksum.CRC32C)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStore) presign(method string, key string, duration time.Duration, checksum objectstore.Checksum) (string, error) {
+	err := validateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	expires := time.Now().Add(duration).Unix()
+	query := url.Values{}
+	query.Set("expires", fmt.Sprint(expires))
+	query.Set("signature", s.sign(method, key, expires, checksum))
+
+	return fmt.Sprintf("%s/%s?%s", s.baseURL, (&url.URL{Path: key}).EscapedPath(), query.Encode()), nil
+}
+
+// Verify checks the signature and expiry of a presigned request for key,
+// including the checksum headers it was signed with.
+func (s *LocalStore) Verify(method string, key string, query url.Values, header http.Header) error {
+	var expires int64
+	_, err := fmt.Sscan(query.Get("expires"), &expires)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	expected := s.sign(method, key, expires, ChecksumFromHeader(header))
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return ErrURLExpired
+	}
+
+	return nil
+}
+
+func (s *LocalStore) PresignPut(ctx context.Context, key string, duration time.Duration) (string, error) {
+	return s.presign("PUT", key, duration, objectstore.Checksum{})
+}
+
+func (s *LocalStore) PresignPutChecksum(ctx context.Context, key string, duration time.Duration, checksum objectstore.Checksum) (string, http.Header, error) {
+	url, err := s.presign("PUT", key, duration, checksum)
+	if err != nil {
+		return "", nil, err
+	}
+	return url, checksumHeaders(checksum), nil
+}
+
+func (s *LocalStore) PresignGet(ctx context.Context, key string, duration time.Duration) (string, error) {
+	return s.presign("GET", key, duration, objectstore.Checksum{})
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (*objectstore.ObjectAttrs, error) {
+	return s.stat(key)
+}
+
+func (s *LocalStore) stat(key string) (*objectstore.ObjectAttrs, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil, objectstore.ErrObjectNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	etag := fileETag(info)
+	return &objectstore.ObjectAttrs{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		Updated:     info.ModTime(),
+		ETag:        etag,
+		Checksum:    readChecksum(p, etag),
+	}, nil
+}
+
+// fileETag returns the ETag of the object in the file described by info.
+// Objects are only ever replaced whole, so their modification time and size
+// identify their content without reading it.
+func fileETag(info fs.FileInfo) string {
+	return fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+}
+
+// The checksum of an object is computed as it is written, and kept next to
+// it in a file named with checksumPrefix, along with the ETag of the content
+// it was computed for.
+const checksumPrefix = ".checksum-"
+
+type checksumFile struct {
+	ETag     string               `json:"etag"`
+	Checksum objectstore.Checksum `json:"checksum"`
+}
+
+func checksumPath(p string) string {
+	return filepath.Join(filepath.Dir(p), checksumPrefix+filepath.Base(p))
+}
+
+// readChecksum returns the checksum recorded for the object in the file at p.
+// It returns no checksum if none was recorded for content with etag, as for
+// files put in place without Write.
+func readChecksum(p string, etag string) objectstore.Checksum {
+	b, err := os.ReadFile(checksumPath(p))
+	if err != nil {
+		return objectstore.Checksum{}
+	}
+	var recorded checksumFile
+	err = json.Unmarshal(b, &recorded)
+	if err != nil || recorded.ETag != etag {
+		return objectstore.Checksum{}
+	}
+	return recorded.Checksum
+}
+
+func writeChecksum(p string, checksum objectstore.Checksum) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(checksumFile{ETag: fileETag(info), Checksum: checksum})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(checksumPath(p), b, 0o644)
+}
+
+// Write stores the contents of r at key, replacing any existing object.
+// The object only becomes visible once it has been completely written.
+func (s *LocalStore) Write(key string, r io.Reader) error {
+	return s.WriteChecksum(key, r, objectstore.Checksum{})
+}
+
+// WriteChecksum is like Write, but discards the object and returns
+// objectstore.ErrChecksumMismatch unless its content matches checksum.
+func (s *LocalStore) WriteChecksum(key string, r io.Reader, checksum objectstore.Checksum) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(p), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	actual, _, err := objectstore.ComputeChecksum(io.TeeReader(r, tmp))
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = checksum.Verify(actual)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), p)
+	if err != nil {
+		return err
+	}
+	return writeChecksum(p, actual)
+}
+
+// Open returns a reader for the object at key.
+func (s *LocalStore) Open(key string) (*os.File, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, objectstore.ErrObjectNotExist
+	}
+	return f, err
+}
+
+func (s *LocalStore) Compose(ctx context.Context, dst string, srcs []string) error {
+	var readers []io.Reader
+	for _, src := range srcs {
+		f, err := s.Open(src)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", src, err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	return s.Write(dst, io.MultiReader(readers...))
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return objectstore.ErrObjectNotExist
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(checksumPath(p))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]objectstore.ObjectAttrs, error) {
+	var objects []objectstore.ObjectAttrs
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") || strings.HasPrefix(d.Name(), checksumPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		attrs, err := s.stat(key)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, *attrs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
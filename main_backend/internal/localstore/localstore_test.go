@@ -0,0 +1,451 @@
+package localstore_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/localstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+)
+
+const PRESIGNED_URL_DURATION = 5 * time.Minute
+
+func put(t *testing.T, url string, content []byte) *http.Response {
+	return putHeaders(t, url, nil, content)
+}
+
+func putHeaders(t *testing.T, url string, headers http.Header, content []byte) *http.Response {
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func get(t *testing.T, url string) (*http.Response, []byte) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Failed to download: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response body: %v", err)
+	}
+	return resp, body
+}
+
+func TestPresignUploadDownload(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewTestStore(t)
+	key := "nested/dir/test file.txt"
+	testContent := []byte("This is a test file content")
+
+	uploadURL, err := store.PresignPut(ctx, key, PRESIGNED_URL_DURATION)
+	if err != nil {
+		t.Fatalf("Failed to generate presigned upload URL: %v", err)
+	}
+	resp := put(t, uploadURL, testContent)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Upload failed with status code: %d", resp.StatusCode)
+	}
+
+	attrs, err := store.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Failed to stat object: %v", err)
+	}
+	if attrs.Size != int64(len(testContent)) {
+		t.Fatalf("Unexpected object size. Expected: %d, Got: %d", len(testContent), attrs.Size)
+	}
+
+	downloadURL, err := store.PresignGet(ctx, key, PRESIGNED_URL_DURATION)
+	if err != nil {
+		t.Fatalf("Failed to generate presigned download URL: %v", err)
+	}
+	resp, body := get(t, downloadURL)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Download failed with status code: %d", resp.StatusCode)
+	}
+	if !bytes.Equal(body, testContent) {
+		t.Fatalf("Downloaded content does not match. Expected: %s, Got: %s", testContent, body)
+	}
+}
+
+func TestPresignedURLRejected(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewTestStore(t)
+	key := "test-file"
+
+	// A GET URL must not be usable for uploads
+	downloadURL, err := store.PresignGet(ctx, key, PRESIGNED_URL_DURATION)
+	if err != nil {
+		t.Fatalf("Failed to generate presigned download URL: %v", err)
+	}
+	resp := put(t, downloadURL, []byte("content"))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected status %d for mismatched method, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+
+	// Signatures are bound to the key
+	uploadURL, err := store.PresignPut(ctx, key, PRESIGNED_URL_DURATION)
+	if err != nil {
+		t.Fatalf("Failed to generate presigned upload URL: %v", err)
+	}
+	tampered, err := url.Parse(uploadURL)
+	if err != nil {
+		t.Fatalf("Failed to parse presigned upload URL: %v", err)
+	}
+	tampered.Path = localstore.RoutePrefix + "/other-file"
+	resp = put(t, tampered.String(), []byte("content"))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected status %d for tampered url, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+
+	// Expired URLs are rejected
+	expiredURL, err := store.PresignPut(ctx, key, -time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate presigned upload URL: %v", err)
+	}
+	resp = put(t, expiredURL, []byte("content"))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected status %d for expired url, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+
+	exists, err := objectstore.Exists(ctx, store, key)
+	if err != nil {
+		t.Fatalf("Failed to check if object exists: %v", err)
+	}
+	if exists {
+		t.Fatalf("Object was written by a rejected request")
+	}
+
+	// Keys may not escape the storage directory
+	_, err = store.PresignPut(ctx, "../escape", PRESIGNED_URL_DURATION)
+	if err == nil {
+		t.Fatalf("Expected error presigning key outside of the store")
+	}
+}
+
+func TestMultipartUploadFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		numParts int
+	}{
+		{"SinglePart", 1},
+		{"ThreeParts", 3},
+		{"FiveParts", 5},
+	}
+
+	fileContent, err := os.ReadFile("../../resources/gettysburg.wav")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := localstore.NewTestStore(t)
+			key := "gettysburg.wav"
+
+			uploadID, err := objectstore.StartMultipartUpload(ctx, store, key)
+			if err != nil {
+				t.Fatalf("Failed to start multipart upload: %v", err)
+			}
+
+			partSize := len(fileContent) / tc.numParts
+			for i := 0; i < tc.numParts; i++ {
+				start := i * partSize
+				end := (i + 1) * partSize
+				if i == tc.numParts-1 {
+					end = len(fileContent)
+				}
+
+				url, err := objectstore.GetUploadPartURL(ctx, store, uploadID, i, PRESIGNED_URL_DURATION)
+				if err != nil {
+					t.Fatalf("Failed to get upload URL for part %d: %v", i, err)
+				}
+				resp := put(t, url, fileContent[start:end])
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("Upload of part %d failed with status code: %d", i, resp.StatusCode)
+				}
+			}
+
+			err = objectstore.CompleteMultipartUpload(ctx, store, key, uploadID, tc.numParts)
+			if err != nil {
+				t.Fatalf("Failed to complete multipart upload: %v", err)
+			}
+
+			objects, err := store.List(ctx, "")
+			if err != nil {
+				t.Fatalf("Failed to list objects: %v", err)
+			}
+			if len(objects) != 1 || objects[0].Key != key {
+				t.Fatalf("Expected only the composed object to remain, got %v", objects)
+			}
+
+			downloadURL, err := store.PresignGet(ctx, key, PRESIGNED_URL_DURATION)
+			if err != nil {
+				t.Fatalf("Failed to get download URL: %v", err)
+			}
+			_, downloadedContent := get(t, downloadURL)
+			if !bytes.Equal(downloadedContent, fileContent) {
+				t.Fatalf("Downloaded content does not match original file")
+			}
+		})
+	}
+}
+
+func TestListUploadedParts(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewTestStore(t)
+
+	uploadID, err := objectstore.StartMultipartUpload(ctx, store, "resumed.wav")
+	if err != nil {
+		t.Fatalf("Failed to start multipart upload: %v", err)
+	}
+
+	parts, err := objectstore.ListUploadedParts(ctx, store, uploadID)
+	if err != nil {
+		t.Fatalf("Failed to list parts: %v", err)
+	}
+	if len(parts) != 0 {
+		t.Fatalf("Expected no parts before uploading, got %v", parts)
+	}
+
+	contents := map[int][]byte{
+		2: []byte("the third part"),
+		0: []byte("the first"),
+	}
+	for _, partNumber := range []int{2, 0} {
+		partURL, err := objectstore.GetUploadPartURL(ctx, store, uploadID, partNumber, PRESIGNED_URL_DURATION)
+		if err != nil {
+			t.Fatalf("Failed to get upload URL for part %d: %v", partNumber, err)
+		}
+		resp := put(t, partURL, contents[partNumber])
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Upload of part %d failed with status code: %d", partNumber, resp.StatusCode)
+		}
+	}
+
+	parts, err = objectstore.ListUploadedParts(ctx, store, uploadID)
+	if err != nil {
+		t.Fatalf("Failed to list parts: %v", err)
+	}
+	if len(parts) != 2 || parts[0].PartNumber != 0 || parts[1].PartNumber != 2 {
+		t.Fatalf("Expected parts 0 and 2 in order, got %v", parts)
+	}
+	for _, part := range parts {
+		if part.Size != int64(len(contents[part.PartNumber])) {
+			t.Errorf("Expected part %d to have size %d, got %d", part.PartNumber, len(contents[part.PartNumber]), part.Size)
+		}
+		if part.ETag == "" {
+			t.Errorf("Expected part %d to have an ETag", part.PartNumber)
+		}
+	}
+}
+
+// composeLimitedStore rejects composes of more than
+// objectstore.MaxComposeSources objects, like GCS does.
+type composeLimitedStore struct {
+	*localstore.LocalStore
+	composes int
+}
+
+func (s *composeLimitedStore) Compose(ctx context.Context, dst string, srcs []string) error {
+	if len(srcs) > objectstore.MaxComposeSources {
+		return fmt.Errorf("too many sources: %d", len(srcs))
+	}
+	s.composes++
+	return s.LocalStore.Compose(ctx, dst, srcs)
+}
+
+func TestMultipartUploadManyParts(t *testing.T) {
+	ctx := context.Background()
+	store := &composeLimitedStore{LocalStore: localstore.NewTestStore(t)}
+	key := "long-meeting.wav"
+	numParts := 2*objectstore.MaxComposeSources + 5
+
+	uploadID, err := objectstore.StartMultipartUpload(ctx, store, key)
+	if err != nil {
+		t.Fatalf("Failed to start multipart upload: %v", err)
+	}
+
+	var fileContent []byte
+	for i := 0; i < numParts; i++ {
+		part := []byte(fmt.Sprintf("part %d;", i))
+		fileContent = append(fileContent, part...)
+
+		url, err := objectstore.GetUploadPartURL(ctx, store, uploadID, i, PRESIGNED_URL_DURATION)
+		if err != nil {
+			t.Fatalf("Failed to get upload URL for part %d: %v", i, err)
+		}
+		resp := put(t, url, part)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Upload of part %d failed with status code: %d", i, resp.StatusCode)
+		}
+	}
+
+	err = objectstore.CompleteMultipartUpload(ctx, store, key, uploadID, numParts)
+	if err != nil {
+		t.Fatalf("Failed to complete multipart upload: %v", err)
+	}
+	// Three intermediate objects, then the final object.
+	if store.composes != 4 {
+		t.Errorf("Expected 4 composes, got %d", store.composes)
+	}
+
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != key {
+		t.Fatalf("Expected only the composed object to remain, got %v", objects)
+	}
+
+	downloadURL, err := store.PresignGet(ctx, key, PRESIGNED_URL_DURATION)
+	if err != nil {
+		t.Fatalf("Failed to get download URL: %v", err)
+	}
+	_, downloadedContent := get(t, downloadURL)
+	if !bytes.Equal(downloadedContent, fileContent) {
+		t.Fatalf("Downloaded content does not match original file")
+	}
+}
+
+func TestChecksumMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewTestStore(t)
+	key := "checked.wav"
+	contents := [][]byte{[]byte("the first part, "), []byte("the second part, "), []byte("and the last")}
+
+	uploadID, err := objectstore.StartMultipartUpload(ctx, store, key)
+	if err != nil {
+		t.Fatalf("Failed to start multipart upload: %v", err)
+	}
+
+	var parts []objectstore.ChecksumPart
+	for i, content := range contents {
+		checksum, size, err := objectstore.ComputeChecksum(bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("Failed to compute checksum of part %d: %v", i, err)
+		}
+		parts = append(parts, objectstore.ChecksumPart{CRC32C: checksum.CRC32C, Size: size})
+
+		url, headers, err := objectstore.GetUploadPartURLWithChecksum(ctx, store, uploadID, i, PRESIGNED_URL_DURATION, checksum)
+		if err != nil {
+			t.Fatalf("Failed to get upload URL for part %d: %v", i, err)
+		}
+
+		resp := putHeaders(t, url, headers, []byte("corrupted"))
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected corrupted part %d to be rejected, got status code: %d", i, resp.StatusCode)
+		}
+		resp = put(t, url, []byte("corrupted"))
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected part %d without checksum headers to be rejected, got status code: %d", i, resp.StatusCode)
+		}
+		resp = putHeaders(t, url, headers, content)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Upload of part %d failed with status code: %d", i, resp.StatusCode)
+		}
+	}
+
+	err = objectstore.CompleteMultipartUpload(ctx, store, key, uploadID, len(contents))
+	if err != nil {
+		t.Fatalf("Failed to complete multipart upload: %v", err)
+	}
+
+	attrs, err := store.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Failed to stat object: %v", err)
+	}
+	expected, _, err := objectstore.ComputeChecksum(bytes.NewReader(bytes.Join(contents, nil)))
+	if err != nil {
+		t.Fatalf("Failed to compute checksum: %v", err)
+	}
+	if attrs.Checksum != expected {
+		t.Errorf("Expected checksum %+v, got %+v", expected, attrs.Checksum)
+	}
+	composite, err := objectstore.CompositeCRC32C(parts)
+	if err != nil {
+		t.Fatalf("Failed to combine part checksums: %v", err)
+	}
+	if composite != expected.CRC32C {
+		t.Errorf("Expected composite crc32c %s, got %s", expected.CRC32C, composite)
+	}
+}
+
+func TestStatChecksum(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := localstore.NewLocalStore(dir, "http://localhost"+localstore.RoutePrefix, []byte("test-secret"))
+	if err != nil {
+		t.Fatalf("Failed to create local store: %v", err)
+	}
+	key := "nested/file.txt"
+	content := []byte("This is a test file content")
+
+	err = store.Write(key, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to write object: %v", err)
+	}
+	expected, _, err := objectstore.ComputeChecksum(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to compute checksum: %v", err)
+	}
+	attrs, err := store.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Failed to stat object: %v", err)
+	}
+	if attrs.Checksum != expected {
+		t.Errorf("Expected checksum %+v, got %+v", expected, attrs.Checksum)
+	}
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != key || objects[0].Checksum != expected {
+		t.Errorf("Expected only %s with its checksum to be listed, got %+v", key, objects)
+	}
+
+	// The recorded checksum is not reported for content written some other
+	// way.
+	err = os.WriteFile(dir+"/"+key, []byte("Replaced content"), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to replace file: %v", err)
+	}
+	attrs, err = store.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Failed to stat object: %v", err)
+	}
+	if !attrs.Checksum.IsZero() {
+		t.Errorf("Expected no checksum for replaced content, got %+v", attrs.Checksum)
+	}
+
+	err = store.Delete(ctx, key)
+	if err != nil {
+		t.Fatalf("Failed to delete object: %v", err)
+	}
+	entries, err := os.ReadDir(dir + "/nested")
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected nothing to be left after deleting, got %v", entries)
+	}
+}
@@ -0,0 +1,25 @@
+package localstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// NewTestStore returns a LocalStore in a temporary directory whose presigned
+// URLs are served by a test server, which is closed when the test finishes.
+func NewTestStore(t testing.TB) *LocalStore {
+	t.Helper()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	store, err := NewLocalStore(t.TempDir(), server.URL+RoutePrefix, []byte("test-secret"))
+	if err != nil {
+		t.Fatalf("Failed to create local store: %v", err)
+	}
+	mux.HandleFunc("PUT "+RoutePrefix+"/{key...}", store.HandleUpload)
+	mux.HandleFunc("GET "+RoutePrefix+"/{key...}", store.HandleDownload)
+
+	return store
+}
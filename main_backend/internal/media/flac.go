@@ -0,0 +1,46 @@
+package media
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// streamInfoSize is the length of a FLAC STREAMINFO block.
+const streamInfoSize = 34
+
+func probeFLAC(r io.ReaderAt, size int64) (*Info, error) {
+	// "fLaC", then the STREAMINFO block, which always comes first.
+	header, err := readFull(r, size, 0, 8+streamInfoSize)
+	if err != nil {
+		return nil, corrupt(FormatFLAC, "file is too short")
+	}
+	if header[4]&0x7f != 0 {
+		return nil, corrupt(FormatFLAC, "first metadata block is not STREAMINFO")
+	}
+	return parseStreamInfo(FormatFLAC, header[8:])
+}
+
+// parseStreamInfo reads a FLAC STREAMINFO block, which is also how FLAC is
+// described inside Ogg.
+func parseStreamInfo(format string, b []byte) (*Info, error) {
+	if len(b) < streamInfoSize {
+		return nil, corrupt(format, "STREAMINFO is too short")
+	}
+	// After the block and frame sizes: 20 bits of sample rate, 3 bits of
+	// channels minus one, 5 bits of bits per sample minus one, then 36 bits
+	// of total samples.
+	sampleRate := int(b[10])<<12 | int(b[11])<<4 | int(b[12])>>4
+	channels := int(b[12]>>1&0x07) + 1
+	totalSamples := uint64(b[13]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(b[14:18]))
+	if sampleRate == 0 {
+		return nil, corrupt(format, "STREAMINFO has no sample rate")
+	}
+
+	return &Info{
+		Format:          format,
+		Codec:           "flac",
+		DurationSeconds: float64(totalSamples) / float64(sampleRate),
+		SampleRate:      sampleRate,
+		Channels:        channels,
+	}, nil
+}
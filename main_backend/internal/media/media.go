@@ -0,0 +1,133 @@
+// Package media identifies uploaded recordings from their headers, so that
+// files which cannot be transcribed are rejected when they are uploaded
+// rather than when the transcription job fails.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+)
+
+const (
+	FormatWAV  = "wav"
+	FormatMP3  = "mp3"
+	FormatMP4  = "mp4"
+	FormatOgg  = "ogg"
+	FormatWebM = "webm"
+	FormatFLAC = "flac"
+)
+
+var (
+	// ErrUnsupported is returned for files that are not in one of the
+	// supported formats, or have no audio we can transcribe.
+	ErrUnsupported = errors.New("unsupported media")
+	// ErrCorrupt is returned for files that claim to be in a supported format
+	// but cannot be read as such.
+	ErrCorrupt = errors.New("corrupt media")
+)
+
+// sniffSize is how much of a file is read to tell its format.
+const sniffSize = 512
+
+// Info describes the audio in a media file.
+type Info struct {
+	Format string `json:"format"`
+	// Codec is the audio codec, e.g. "pcm", "aac" or "opus".
+	Codec string `json:"codec"`
+	// DurationSeconds is 0 if the file does not record its duration, as is
+	// the case for WebM files written by browsers.
+	DurationSeconds float64 `json:"duration_seconds"`
+	SampleRate      int     `json:"sample_rate"`
+	Channels        int     `json:"channels"`
+}
+
+func (i *Info) Duration() time.Duration {
+	return time.Duration(i.DurationSeconds * float64(time.Second))
+}
+
+// Probe reads the headers of the media file in r, which is size bytes long.
+// It returns ErrUnsupported if the file is not in a supported format, and
+// ErrCorrupt if it cannot be parsed.
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+	head, err := readAt(r, size, 0, sniffSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: file is empty", ErrUnsupported)
+	}
+
+	var probe func(io.ReaderAt, int64) (*Info, error)
+	switch {
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		probe = probeWAV
+	case len(head) >= 4 && string(head[0:4]) == "fLaC":
+		probe = probeFLAC
+	case len(head) >= 4 && string(head[0:4]) == "OggS":
+		probe = probeOgg
+	case len(head) >= 4 && string(head[0:4]) == ebmlMagic:
+		probe = probeWebM
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		probe = probeMP4
+	case isMP3(head):
+		probe = probeMP3
+	default:
+		return nil, fmt.Errorf("%w: %s is not a supported audio format", ErrUnsupported, http.DetectContentType(head))
+	}
+
+	info, err := probe(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if info.SampleRate <= 0 || info.Channels <= 0 {
+		return nil, fmt.Errorf("%w: %s file has no sample rate or channel count", ErrCorrupt, info.Format)
+	}
+	return info, nil
+}
+
+// ProbeObject probes the object at key, fetching only the parts of it that
+// are needed.
+func ProbeObject(ctx context.Context, store objectstore.ObjectStore, key string) (*Info, error) {
+	attrs, err := store.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return Probe(newObjectReader(ctx, store, key, attrs.Size), attrs.Size)
+}
+
+// corrupt returns an ErrCorrupt error for a file in format.
+func corrupt(format string, reason string, args ...any) error {
+	return fmt.Errorf("%w: %s: %s", ErrCorrupt, format, fmt.Sprintf(reason, args...))
+}
+
+// readAt reads up to n bytes at off. It only returns fewer bytes if the file
+// ends first, and an error if there are none.
+func readAt(r io.ReaderAt, size int64, off int64, n int) ([]byte, error) {
+	if off < 0 || off >= size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, min(int64(n), size-off))
+	read, err := r.ReadAt(buf, off)
+	if read == len(buf) {
+		return buf, nil
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// readFull is readAt, but fails unless all n bytes could be read.
+func readFull(r io.ReaderAt, size int64, off int64, n int) ([]byte, error) {
+	buf, err := readAt(r, size, off, n)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf, nil
+}
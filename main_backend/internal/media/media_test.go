@@ -0,0 +1,255 @@
+package media_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/localstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/media"
+)
+
+func write(buf *bytes.Buffer, order binary.ByteOrder, fields ...any) {
+	for _, field := range fields {
+		binary.Write(buf, order, field)
+	}
+}
+
+// testWAV returns a 16-bit mono WAV file at sampleRate.
+func testWAV(sampleRate int, seconds int) []byte {
+	dataSize := 2 * sampleRate * seconds
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	write(&buf, binary.LittleEndian, uint32(4+24+8+dataSize))
+	buf.WriteString("WAVEfmt ")
+	write(&buf, binary.LittleEndian, uint32(16), uint16(1), uint16(1), uint32(sampleRate), uint32(2*sampleRate), uint16(2), uint16(16))
+	buf.WriteString("data")
+	write(&buf, binary.LittleEndian, uint32(dataSize))
+	buf.Write(make([]byte, dataSize))
+	return buf.Bytes()
+}
+
+// testFLAC returns the header of a 10 second 44.1 kHz stereo FLAC file.
+func testFLAC() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	// The last metadata block, STREAMINFO, 34 bytes.
+	buf.Write([]byte{0x80, 0, 0, 34})
+	buf.Write(make([]byte, 10))
+	// 44100 Hz, 2 channels, 16 bits per sample, 441000 samples.
+	buf.Write([]byte{0x0a, 0xc4, 0x42, 0xf0})
+	write(&buf, binary.BigEndian, uint32(441000))
+	buf.Write(make([]byte, 16))
+	return buf.Bytes()
+}
+
+// testMP3 returns frames of 128 kbit/s 44.1 kHz stereo MPEG-1 Layer III
+// after an ID3 tag. If xingFrames is set, the first frame holds a Xing
+// header.
+func testMP3(frames int, xingFrames uint32) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("ID3\x03\x00\x00")
+	buf.Write([]byte{0, 0, 0, 90})
+	buf.Write(make([]byte, 90))
+
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, 417)
+		copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+		if i == 0 && xingFrames > 0 {
+			copy(frame[36:], "Xing")
+			binary.BigEndian.PutUint32(frame[40:], 1)
+			binary.BigEndian.PutUint32(frame[44:], xingFrames)
+		}
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+func oggPage(granule int64, headerType byte, payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("OggS")
+	buf.Write([]byte{0, headerType})
+	write(&buf, binary.LittleEndian, granule, uint32(1234), uint32(0), uint32(0))
+	buf.Write([]byte{1, byte(len(payload))})
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// testOpus returns an Ogg Opus file of 5 seconds of stereo audio.
+func testOpus() []byte {
+	var head bytes.Buffer
+	head.WriteString("OpusHead")
+	head.WriteByte(1)
+	head.WriteByte(2)
+	write(&head, binary.LittleEndian, uint16(312), uint32(16000), uint16(0))
+	head.WriteByte(0)
+
+	var buf bytes.Buffer
+	buf.Write(oggPage(0, 0x02, head.Bytes()))
+	buf.Write(oggPage(0, 0, []byte("OpusTags")))
+	buf.Write(make([]byte, 1000))
+	buf.Write(oggPage(48000*5+312, 0x04, make([]byte, 100)))
+	return buf.Bytes()
+}
+
+func box(typ string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	var buf bytes.Buffer
+	write(&buf, binary.BigEndian, uint32(8+len(body)))
+	buf.WriteString(typ)
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// testMP4 returns an M4A file of 7 seconds of 44.1 kHz stereo AAC, with its
+// metadata after the media data as many encoders write it.
+func testMP4(handler string) []byte {
+	var mdhd bytes.Buffer
+	write(&mdhd, binary.BigEndian, uint32(0), uint32(0), uint32(0), uint32(44100), uint32(7*44100), uint32(0))
+
+	var hdlr bytes.Buffer
+	write(&hdlr, binary.BigEndian, uint32(0), uint32(0))
+	hdlr.WriteString(handler)
+	hdlr.Write(make([]byte, 13))
+
+	var sample bytes.Buffer
+	sample.Write(make([]byte, 16))
+	write(&sample, binary.BigEndian, uint16(2), uint16(16), uint32(0), uint32(44100<<16))
+
+	var stsd bytes.Buffer
+	write(&stsd, binary.BigEndian, uint32(0), uint32(1))
+	stsd.Write(box("mp4a", sample.Bytes()))
+
+	moov := box("moov",
+		box("trak", box("mdia",
+			box("mdhd", mdhd.Bytes()),
+			box("hdlr", hdlr.Bytes()),
+			box("minf", box("stbl", box("stsd", stsd.Bytes()))),
+		)),
+	)
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("M4A \x00\x00\x00\x00")),
+		box("mdat", make([]byte, 100000)),
+		moov,
+	}, nil)
+}
+
+func ebml(id uint32, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	var buf bytes.Buffer
+	idBytes := binary.BigEndian.AppendUint32(nil, id)
+	buf.Write(bytes.TrimLeft(idBytes, "\x00"))
+	// An eight byte size.
+	buf.WriteByte(0x01)
+	buf.Write(binary.BigEndian.AppendUint64(nil, uint64(len(body)))[1:])
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func float64Bytes(f float64) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(f))
+}
+
+// testWebM returns a WebM file of 12.345 seconds of 48 kHz mono Opus, in a
+// segment of unknown size like a live recording.
+func testWebM() []byte {
+	var buf bytes.Buffer
+	buf.Write(ebml(0x1a45dfa3, ebml(0x4282, []byte("webm"))))
+	buf.Write([]byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	buf.Write(ebml(0x1549a966, ebml(0x2ad7b1, []byte{0x0f, 0x42, 0x40}), ebml(0x4489, float64Bytes(12345))))
+	buf.Write(ebml(0x1654ae6b,
+		ebml(0xae, ebml(0x83, []byte{1}), ebml(0x86, []byte("V_VP8"))),
+		ebml(0xae, ebml(0x83, []byte{2}), ebml(0x86, []byte("A_OPUS")),
+			ebml(0xe1, ebml(0xb5, float64Bytes(48000)), ebml(0x9f, []byte{1}))),
+	))
+	buf.Write(ebml(0x1f43b675, make([]byte, 1000)))
+	return buf.Bytes()
+}
+
+func TestProbe(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  []byte
+		expected media.Info
+	}{
+		{"wav", testWAV(16000, 3), media.Info{Format: media.FormatWAV, Codec: "pcm", DurationSeconds: 3, SampleRate: 16000, Channels: 1}},
+		{"flac", testFLAC(), media.Info{Format: media.FormatFLAC, Codec: "flac", DurationSeconds: 10, SampleRate: 44100, Channels: 2}},
+		{"cbr mp3", testMP3(100, 0), media.Info{Format: media.FormatMP3, Codec: "mp3", DurationSeconds: 100 * 417 * 8 / 128000.0, SampleRate: 44100, Channels: 2}},
+		{"vbr mp3", testMP3(10, 441), media.Info{Format: media.FormatMP3, Codec: "mp3", DurationSeconds: 441 * 1152 / 44100.0, SampleRate: 44100, Channels: 2}},
+		{"opus", testOpus(), media.Info{Format: media.FormatOgg, Codec: "opus", DurationSeconds: 5, SampleRate: 16000, Channels: 2}},
+		{"m4a", testMP4("soun"), media.Info{Format: media.FormatMP4, Codec: "aac", DurationSeconds: 7, SampleRate: 44100, Channels: 2}},
+		{"webm", testWebM(), media.Info{Format: media.FormatWebM, Codec: "opus", DurationSeconds: 12.345, SampleRate: 48000, Channels: 1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := media.Probe(bytes.NewReader(tc.content), int64(len(tc.content)))
+			if err != nil {
+				t.Fatalf("Failed to probe: %v", err)
+			}
+			if math.Abs(info.DurationSeconds-tc.expected.DurationSeconds) > 1e-9 {
+				t.Errorf("Expected duration %v, got %v", tc.expected.DurationSeconds, info.DurationSeconds)
+			}
+			info.DurationSeconds = tc.expected.DurationSeconds
+			if *info != tc.expected {
+				t.Errorf("Expected %+v, got %+v", tc.expected, *info)
+			}
+		})
+	}
+}
+
+func TestProbeRejects(t *testing.T) {
+	wav := testWAV(16000, 1)
+	testCases := []struct {
+		name     string
+		content  []byte
+		expected error
+	}{
+		{"pdf", []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj"), media.ErrUnsupported},
+		{"empty", nil, media.ErrUnsupported},
+		{"video only mp4", testMP4("vide"), media.ErrUnsupported},
+		{"truncated wav", wav[:30], media.ErrCorrupt},
+		{"mp3 without frames", append(testMP3(0, 0), bytes.Repeat([]byte{0xff, 0x00}, 1000)...), media.ErrCorrupt},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := media.Probe(bytes.NewReader(tc.content), int64(len(tc.content)))
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestProbeObject(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewTestStore(t)
+
+	for key, content := range map[string][]byte{"recording.wav": testWAV(8000, 10), "recording.m4a": testMP4("soun")} {
+		err := store.Write(key, bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("Failed to write %s: %v", key, err)
+		}
+	}
+
+	info, err := media.ProbeObject(ctx, store, "recording.wav")
+	if err != nil {
+		t.Fatalf("Failed to probe WAV object: %v", err)
+	}
+	if info.Format != media.FormatWAV || info.Duration().Seconds() != 10 {
+		t.Errorf("Expected 10 seconds of WAV, got %+v", info)
+	}
+
+	// The moov box is at the end, past the first block fetched.
+	info, err = media.ProbeObject(ctx, store, "recording.m4a")
+	if err != nil {
+		t.Fatalf("Failed to probe M4A object: %v", err)
+	}
+	if info.Format != media.FormatMP4 || info.Duration().Seconds() != 7 {
+		t.Errorf("Expected 7 seconds of MP4, got %+v", info)
+	}
+}
@@ -0,0 +1,174 @@
+package media
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// mp3SyncSearch is how far past the ID3 tag we look for the first frame.
+const mp3SyncSearch = 64 * 1024
+
+var (
+	// Layer III bitrates in kbit/s by index, for MPEG-1 and for MPEG-2 and 2.5.
+	mp3BitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	// MPEG-1 sample rates by index, which MPEG-2 halves and MPEG-2.5 quarters.
+	mp3SampleRates = [4]int{44100, 48000, 32000, 0}
+)
+
+// mp3Frame is a parsed MPEG audio Layer III frame header.
+type mp3Frame struct {
+	mpeg1      bool
+	bitrate    int
+	sampleRate int
+	channels   int
+	// length is the size of the frame in bytes, including its header.
+	length int
+}
+
+func (f *mp3Frame) samples() int {
+	if f.mpeg1 {
+		return 1152
+	}
+	return 576
+}
+
+// sideInfoSize returns the size of the side information that follows the
+// header, which is where a Xing header would start.
+func (f *mp3Frame) sideInfoSize() int {
+	switch {
+	case f.mpeg1 && f.channels == 1:
+		return 17
+	case f.mpeg1:
+		return 32
+	case f.channels == 1:
+		return 9
+	default:
+		return 17
+	}
+}
+
+func parseMP3Frame(h []byte) (*mp3Frame, bool) {
+	if len(h) < 4 || h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return nil, false
+	}
+	version := h[1] >> 3 & 0x03
+	layer := h[1] >> 1 & 0x03
+	bitrateIndex := h[2] >> 4
+	sampleRateIndex := h[2] >> 2 & 0x03
+	// Version 1 is reserved, and layer 1 is Layer III.
+	if version == 1 || layer != 1 {
+		return nil, false
+	}
+
+	frame := &mp3Frame{mpeg1: version == 3, channels: 2}
+	if frame.mpeg1 {
+		frame.bitrate = mp3BitratesV1[bitrateIndex] * 1000
+	} else {
+		frame.bitrate = mp3BitratesV2[bitrateIndex] * 1000
+	}
+	frame.sampleRate = mp3SampleRates[sampleRateIndex]
+	switch version {
+	case 2:
+		frame.sampleRate /= 2
+	case 0:
+		frame.sampleRate /= 4
+	}
+	// Free format streams have no bitrate in their headers; they are rare
+	// enough not to support.
+	if frame.bitrate == 0 || frame.sampleRate == 0 {
+		return nil, false
+	}
+	if h[3]>>6 == 3 {
+		frame.channels = 1
+	}
+
+	padding := int(h[2] >> 1 & 0x01)
+	frame.length = frame.samples()/8*frame.bitrate/frame.sampleRate + padding
+	return frame, true
+}
+
+// id3Size returns the size of the ID3v2 tag at the start of b, or 0 if
+// there is none.
+func id3Size(b []byte) int64 {
+	if len(b) < 10 || string(b[0:3]) != "ID3" {
+		return 0
+	}
+	// The size is syncsafe: seven bits per byte.
+	size := int64(b[6])<<21 | int64(b[7])<<14 | int64(b[8])<<7 | int64(b[9])
+	size += 10
+	if b[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	return size
+}
+
+func isMP3(head []byte) bool {
+	if id3Size(head) > 0 {
+		return true
+	}
+	_, ok := parseMP3Frame(head)
+	return ok
+}
+
+func probeMP3(r io.ReaderAt, size int64) (*Info, error) {
+	head, err := readAt(r, size, 0, 10)
+	if err != nil {
+		return nil, corrupt(FormatMP3, "file is too short")
+	}
+	start := id3Size(head)
+	buf, err := readAt(r, size, start, mp3SyncSearch)
+	if err != nil {
+		return nil, corrupt(FormatMP3, "no audio after ID3 tag")
+	}
+
+	// A frame only counts if another frame follows it, so that stray sync
+	// bits in leftover tag data are not mistaken for audio.
+	for i := 0; i+4 <= len(buf); i++ {
+		frame, ok := parseMP3Frame(buf[i:])
+		if !ok {
+			continue
+		}
+		next := i + frame.length
+		if next+4 <= len(buf) {
+			if _, ok := parseMP3Frame(buf[next:]); !ok {
+				continue
+			}
+		} else if start+int64(next) < size {
+			continue
+		}
+		return mp3Info(frame, buf[i:], size-start-int64(i)), nil
+	}
+	return nil, corrupt(FormatMP3, "no MPEG audio frames found")
+}
+
+// mp3Info describes a stream of audioSize bytes starting with frame. The
+// duration comes from a Xing or VBRI header if there is one, and is
+// otherwise estimated from the bitrate, which is exact for constant bitrate
+// files.
+func mp3Info(frame *mp3Frame, b []byte, audioSize int64) *Info {
+	info := &Info{
+		Format:          FormatMP3,
+		Codec:           "mp3",
+		SampleRate:      frame.sampleRate,
+		Channels:        frame.channels,
+		DurationSeconds: float64(audioSize) * 8 / float64(frame.bitrate),
+	}
+
+	frames := 0
+	xing := 4 + frame.sideInfoSize()
+	if len(b) >= xing+12 && (string(b[xing:xing+4]) == "Xing" || string(b[xing:xing+4]) == "Info") {
+		flags := binary.BigEndian.Uint32(b[xing+4 : xing+8])
+		if flags&0x01 != 0 {
+			frames = int(binary.BigEndian.Uint32(b[xing+8 : xing+12]))
+		}
+	}
+	vbri := 4 + 32
+	if len(b) >= vbri+18 && string(b[vbri:vbri+4]) == "VBRI" {
+		frames = int(binary.BigEndian.Uint32(b[vbri+14 : vbri+18]))
+	}
+	if frames > 0 {
+		info.DurationSeconds = float64(frames*frame.samples()) / float64(frame.sampleRate)
+	}
+	return info
+}
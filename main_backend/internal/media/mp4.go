@@ -0,0 +1,200 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxMoovSize bounds how much of an MP4 file's metadata is read into
+// memory. Its sample tables grow with the length of the recording, to a few
+// megabytes for a full day of AAC.
+const maxMoovSize = 64 * 1024 * 1024
+
+// mp4Codecs maps sample entry types to codec names.
+var mp4Codecs = map[string]string{
+	"mp4a": "aac",
+	"Opus": "opus",
+	"fLaC": "flac",
+	"alac": "alac",
+	".mp3": "mp3",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+}
+
+// mp4Box is an ISO base media box. Offsets are relative to the data the box
+// was found in.
+type mp4Box struct {
+	typ        string
+	dataOffset int64
+	end        int64
+}
+
+// readBoxHeader reads the header of the box at offset in a region ending at
+// end.
+func readBoxHeader(b []byte, offset int64, end int64) (mp4Box, bool) {
+	if len(b) < 8 {
+		return mp4Box{}, false
+	}
+	box := mp4Box{typ: string(b[4:8]), dataOffset: offset + 8}
+	size := int64(binary.BigEndian.Uint32(b[0:4]))
+	switch size {
+	case 0:
+		// The box extends to the end of its parent.
+		size = end - offset
+	case 1:
+		if len(b) < 16 {
+			return mp4Box{}, false
+		}
+		size = int64(binary.BigEndian.Uint64(b[8:16]))
+		box.dataOffset += 8
+	}
+	box.end = offset + size
+	if box.end < box.dataOffset || box.end > end {
+		return mp4Box{}, false
+	}
+	return box, true
+}
+
+// mp4Children returns the boxes in b, which holds the content of a box.
+func mp4Children(b []byte) map[string][]mp4Box {
+	children := make(map[string][]mp4Box)
+	for offset := int64(0); offset < int64(len(b)); {
+		box, ok := readBoxHeader(b[offset:], offset, int64(len(b)))
+		if !ok {
+			break
+		}
+		children[box.typ] = append(children[box.typ], box)
+		offset = box.end
+	}
+	return children
+}
+
+// mp4Child returns the content of the first box of type typ in b.
+func mp4Child(b []byte, typ string) ([]byte, bool) {
+	boxes := mp4Children(b)[typ]
+	if len(boxes) == 0 {
+		return nil, false
+	}
+	return b[boxes[0].dataOffset:boxes[0].end], true
+}
+
+// mp4Path follows a path of box types down from b.
+func mp4Path(b []byte, path ...string) ([]byte, bool) {
+	for _, typ := range path {
+		var ok bool
+		b, ok = mp4Child(b, typ)
+		if !ok {
+			return nil, false
+		}
+	}
+	return b, true
+}
+
+// parseMediaHeader returns the duration in an mvhd or mdhd box, which share
+// their layout up to it.
+func parseMediaHeader(b []byte) (float64, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var timescale uint32
+	var duration uint64
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return 0, false
+		}
+		timescale = binary.BigEndian.Uint32(b[20:24])
+		duration = binary.BigEndian.Uint64(b[24:32])
+	} else {
+		if len(b) < 20 {
+			return 0, false
+		}
+		timescale = binary.BigEndian.Uint32(b[12:16])
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+	// Fragmented files leave the duration unset.
+	if timescale == 0 || duration == 0 || duration == 1<<64-1 || duration == 1<<32-1 {
+		return 0, false
+	}
+	return float64(duration) / float64(timescale), true
+}
+
+func probeMP4(r io.ReaderAt, size int64) (*Info, error) {
+	moov, err := readMoov(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, trak := range mp4Children(moov)["trak"] {
+		mdia, ok := mp4Child(moov[trak.dataOffset:trak.end], "mdia")
+		if !ok {
+			continue
+		}
+		hdlr, ok := mp4Child(mdia, "hdlr")
+		if !ok || len(hdlr) < 12 || string(hdlr[8:12]) != "soun" {
+			continue
+		}
+		stsd, ok := mp4Path(mdia, "minf", "stbl", "stsd")
+		// The version, flags and entry count come before the first entry.
+		if !ok || len(stsd) < 8 {
+			return nil, corrupt(FormatMP4, "audio track has no sample description")
+		}
+		entry, ok := readBoxHeader(stsd[8:], 0, int64(len(stsd)-8))
+		if !ok || entry.end < 36 {
+			return nil, corrupt(FormatMP4, "audio sample description is truncated")
+		}
+		sample := stsd[8 : 8+entry.end]
+
+		codec, ok := mp4Codecs[entry.typ]
+		if !ok {
+			codec = strings.TrimSpace(entry.typ)
+		}
+		info := &Info{
+			Format:     FormatMP4,
+			Codec:      codec,
+			Channels:   int(binary.BigEndian.Uint16(sample[24:26])),
+			SampleRate: int(binary.BigEndian.Uint32(sample[32:36]) >> 16),
+		}
+
+		if mdhd, ok := mp4Child(mdia, "mdhd"); ok {
+			info.DurationSeconds, _ = parseMediaHeader(mdhd)
+		}
+		if info.DurationSeconds == 0 {
+			if mvhd, ok := mp4Child(moov, "mvhd"); ok {
+				info.DurationSeconds, _ = parseMediaHeader(mvhd)
+			}
+		}
+		return info, nil
+	}
+	return nil, fmt.Errorf("%w: MP4 file has no audio track", ErrUnsupported)
+}
+
+// readMoov walks the top level boxes of the file for the moov box, which may
+// come before or after the media data, and returns its content.
+func readMoov(r io.ReaderAt, size int64) ([]byte, error) {
+	for offset := int64(0); offset < size; {
+		header, err := readAt(r, size, offset, 16)
+		if err != nil {
+			return nil, corrupt(FormatMP4, "box at %d is truncated", offset)
+		}
+		box, ok := readBoxHeader(header, offset, size)
+		if !ok {
+			return nil, corrupt(FormatMP4, "box at %d is invalid", offset)
+		}
+		if box.typ != "moov" {
+			offset = box.end
+			continue
+		}
+
+		if box.end-box.dataOffset > maxMoovSize {
+			return nil, corrupt(FormatMP4, "moov box is too large")
+		}
+		moov, err := readFull(r, size, box.dataOffset, int(box.end-box.dataOffset))
+		if err != nil {
+			return nil, corrupt(FormatMP4, "moov box is truncated")
+		}
+		return moov, nil
+	}
+	return nil, corrupt(FormatMP4, "file has no moov box")
+}
@@ -0,0 +1,83 @@
+package media
+
+import (
+	"context"
+	"io"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+)
+
+// blockSize is the granularity objectReader fetches and caches objects in.
+const blockSize = 64 * 1024
+
+// objectReader reads an object through ranged requests, caching what it has
+// fetched, so that parsers can read small pieces of it at a time.
+type objectReader struct {
+	ctx    context.Context
+	store  objectstore.ObjectStore
+	key    string
+	size   int64
+	blocks map[int64][]byte
+}
+
+func newObjectReader(ctx context.Context, store objectstore.ObjectStore, key string, size int64) *objectReader {
+	return &objectReader{ctx: ctx, store: store, key: key, size: size, blocks: make(map[int64][]byte)}
+}
+
+func (o *objectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= o.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), o.size)
+
+	// Fetch every block from the first to the last missing one in a single
+	// request.
+	first, last := int64(-1), int64(-1)
+	for block := off / blockSize; block <= (end-1)/blockSize; block++ {
+		if _, ok := o.blocks[block]; !ok {
+			if first < 0 {
+				first = block
+			}
+			last = block
+		}
+	}
+	if first >= 0 {
+		err := o.fetch(first, last)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	for pos := off; pos < end; {
+		block := o.blocks[pos/blockSize]
+		copied := copy(p[n:end-off], block[pos%blockSize:])
+		n += copied
+		pos += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (o *objectReader) fetch(first int64, last int64) error {
+	start := first * blockSize
+	end := min((last+1)*blockSize, o.size)
+	body, err := objectstore.GetRange(o.ctx, o.store, o.key, start, end-start)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	buf := make([]byte, end-start)
+	_, err = io.ReadFull(body, buf)
+	if err != nil {
+		return err
+	}
+	for block := first; block <= last; block++ {
+		offset := (block - first) * blockSize
+		o.blocks[block] = buf[offset:min(offset+blockSize, int64(len(buf)))]
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// oggPageHeaderSize is the size of an Ogg page header before its segment
+	// table.
+	oggPageHeaderSize = 27
+	// oggTailSize is how much of the end of a file is searched for the last
+	// page, which holds the final granule position.
+	oggTailSize = 64 * 1024
+	// opusGranuleRate is the rate of Opus granule positions, whatever the
+	// rate of the input was.
+	opusGranuleRate = 48000
+)
+
+func probeOgg(r io.ReaderAt, size int64) (*Info, error) {
+	header, err := readFull(r, size, 0, oggPageHeaderSize)
+	if err != nil {
+		return nil, corrupt(FormatOgg, "first page is truncated")
+	}
+	serial := header[14:18]
+	segments, err := readFull(r, size, oggPageHeaderSize, int(header[26]))
+	if err != nil {
+		return nil, corrupt(FormatOgg, "first page is truncated")
+	}
+	// The first packet of a stream identifies its codec, and ends with the
+	// first lacing value below 255.
+	packetSize := 0
+	for _, lacing := range segments {
+		packetSize += int(lacing)
+		if lacing < 255 {
+			break
+		}
+	}
+	packet, err := readFull(r, size, oggPageHeaderSize+int64(len(segments)), packetSize)
+	if err != nil {
+		return nil, corrupt(FormatOgg, "first packet is truncated")
+	}
+
+	var info *Info
+	granuleRate, preSkip := 0, 0
+	switch {
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 19:
+		info = &Info{
+			Format:     FormatOgg,
+			Codec:      "opus",
+			SampleRate: int(binary.LittleEndian.Uint32(packet[12:16])),
+			Channels:   int(packet[9]),
+		}
+		if info.SampleRate == 0 {
+			info.SampleRate = opusGranuleRate
+		}
+		granuleRate = opusGranuleRate
+		preSkip = int(binary.LittleEndian.Uint16(packet[10:12]))
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 16:
+		info = &Info{
+			Format:     FormatOgg,
+			Codec:      "vorbis",
+			SampleRate: int(binary.LittleEndian.Uint32(packet[12:16])),
+			Channels:   int(packet[11]),
+		}
+		granuleRate = info.SampleRate
+	case bytes.HasPrefix(packet, []byte("\x7fFLAC")) && len(packet) >= 17:
+		// The mapping header is followed by "fLaC" and a STREAMINFO block.
+		info, err = parseStreamInfo(FormatOgg, packet[17:])
+		if err != nil {
+			return nil, err
+		}
+		granuleRate = info.SampleRate
+	default:
+		return nil, fmt.Errorf("%w: Ogg stream is not Opus, Vorbis or FLAC", ErrUnsupported)
+	}
+
+	granule, ok := lastGranule(r, size, serial)
+	if ok && granuleRate > 0 && granule > int64(preSkip) {
+		info.DurationSeconds = float64(granule-int64(preSkip)) / float64(granuleRate)
+	}
+	return info, nil
+}
+
+// lastGranule returns the granule position of the last complete page of the
+// stream with the given serial number, which is its length in samples.
+func lastGranule(r io.ReaderAt, size int64, serial []byte) (int64, bool) {
+	offset := max(size-oggTailSize, 0)
+	tail, err := readAt(r, size, offset, oggTailSize)
+	if err != nil {
+		return 0, false
+	}
+
+	for end := len(tail); ; {
+		i := bytes.LastIndex(tail[:end], []byte("OggS"))
+		if i < 0 {
+			return 0, false
+		}
+		end = i
+		page := tail[i:]
+		if len(page) < oggPageHeaderSize || !bytes.Equal(page[14:18], serial) {
+			continue
+		}
+		// A granule position of -1 marks a page on which no packet ends.
+		granule := int64(binary.LittleEndian.Uint64(page[6:14]))
+		if granule >= 0 {
+			return granule, true
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/chunking"
+)
+
+// wavCodecs names the WAVE format tags we expect to see.
+var wavCodecs = map[uint16]string{
+	0x0001: "pcm",
+	0x0003: "pcm_float",
+	0x0006: "alaw",
+	0x0007: "mulaw",
+	0xfffe: "pcm",
+}
+
+func probeWAV(r io.ReaderAt, size int64) (*Info, error) {
+	header, err := chunking.ParseWAVHeader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, corrupt(FormatWAV, "%v", err)
+	}
+
+	tag := binary.LittleEndian.Uint16(header.Format[0:2])
+	codec, ok := wavCodecs[tag]
+	if !ok {
+		codec = fmt.Sprintf("0x%04x", tag)
+	}
+
+	// As in chunking.ProbeWAV, trust the file size over the header.
+	dataSize := min(header.DataSize, size-header.DataOffset)
+	return &Info{
+		Format:          FormatWAV,
+		Codec:           codec,
+		DurationSeconds: float64(dataSize) / float64(header.ByteRate),
+		SampleRate:      int(binary.LittleEndian.Uint32(header.Format[4:8])),
+		Channels:        int(binary.LittleEndian.Uint16(header.Format[2:4])),
+	}, nil
+}
@@ -0,0 +1,245 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+const ebmlMagic = "\x1a\x45\xdf\xa3"
+
+// Matroska element IDs, with their length markers.
+const (
+	ebmlIDHeader            = 0x1a45dfa3
+	ebmlIDDocType           = 0x4282
+	ebmlIDSegment           = 0x18538067
+	ebmlIDInfo              = 0x1549a966
+	ebmlIDTimecodeScale     = 0x2ad7b1
+	ebmlIDDuration          = 0x4489
+	ebmlIDTracks            = 0x1654ae6b
+	ebmlIDTrackEntry        = 0xae
+	ebmlIDTrackType         = 0x83
+	ebmlIDCodecID           = 0x86
+	ebmlIDAudio             = 0xe1
+	ebmlIDSamplingFrequency = 0xb5
+	ebmlIDChannels          = 0x9f
+	ebmlIDCluster           = 0x1f43b675
+)
+
+const (
+	// matroskaTrackTypeAudio is the TrackType of audio tracks.
+	matroskaTrackTypeAudio = 2
+	// defaultTimecodeScale is the TimecodeScale, in nanoseconds, of files
+	// that do not set one.
+	defaultTimecodeScale = 1000000
+	// maxWebMElementSize bounds the Info and Tracks elements read into
+	// memory.
+	maxWebMElementSize = 1024 * 1024
+)
+
+// ebmlUnknownSize marks elements, like the Segment of a live recording, whose
+// size was not known when they were written.
+const ebmlUnknownSize = -1
+
+// readVint reads an EBML variable length integer from b. IDs keep their
+// length marker, sizes do not.
+func readVint(b []byte, keepMarker bool) (value int64, length int, ok bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	length = 1
+	for mask := byte(0x80); b[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if len(b) < length {
+		return 0, 0, false
+	}
+
+	first := int64(b[0])
+	if !keepMarker {
+		first &= int64(0xff >> length)
+	}
+	value = first
+	allOnes := first == int64(0xff>>length)
+	for _, c := range b[1:length] {
+		value = value<<8 | int64(c)
+		allOnes = allOnes && c == 0xff
+	}
+	if !keepMarker && allOnes {
+		return ebmlUnknownSize, length, true
+	}
+	return value, length, true
+}
+
+// ebmlElement is an element header. Offsets are relative to the data the
+// element was found in.
+type ebmlElement struct {
+	id         int64
+	dataOffset int64
+	// size is ebmlUnknownSize if the element extends to the end of its
+	// parent.
+	size int64
+}
+
+func readElementHeader(b []byte, offset int64) (ebmlElement, bool) {
+	id, idLength, ok := readVint(b, true)
+	if !ok {
+		return ebmlElement{}, false
+	}
+	size, sizeLength, ok := readVint(b[idLength:], false)
+	if !ok {
+		return ebmlElement{}, false
+	}
+	return ebmlElement{id: id, dataOffset: offset + int64(idLength+sizeLength), size: size}, true
+}
+
+// ebmlChildren calls fn with the content of each element in b.
+func ebmlChildren(b []byte, fn func(id int64, data []byte)) {
+	for offset := int64(0); offset < int64(len(b)); {
+		element, ok := readElementHeader(b[offset:], offset)
+		if !ok || element.size == ebmlUnknownSize || element.dataOffset+element.size > int64(len(b)) {
+			return
+		}
+		fn(element.id, b[element.dataOffset:element.dataOffset+element.size])
+		offset = element.dataOffset + element.size
+	}
+}
+
+func ebmlUint(b []byte) uint64 {
+	var value uint64
+	for _, c := range b {
+		value = value<<8 | uint64(c)
+	}
+	return value
+}
+
+func ebmlFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	default:
+		return 0
+	}
+}
+
+// readElement reads the header of the element at offset, with its content
+// if it is smaller than limit.
+func readElement(r io.ReaderAt, size int64, offset int64, limit int64) (ebmlElement, []byte, error) {
+	header, err := readAt(r, size, offset, 12)
+	if err != nil {
+		return ebmlElement{}, nil, err
+	}
+	element, ok := readElementHeader(header, offset)
+	if !ok {
+		return ebmlElement{}, nil, fmt.Errorf("element at %d is invalid", offset)
+	}
+	if element.size == ebmlUnknownSize || element.size > limit {
+		return element, nil, nil
+	}
+	data, err := readFull(r, size, element.dataOffset, int(element.size))
+	if err != nil && element.size > 0 {
+		return ebmlElement{}, nil, fmt.Errorf("element at %d is truncated", offset)
+	}
+	return element, data, nil
+}
+
+func probeWebM(r io.ReaderAt, size int64) (*Info, error) {
+	header, data, err := readElement(r, size, 0, maxWebMElementSize)
+	if err != nil || header.id != ebmlIDHeader || data == nil {
+		return nil, corrupt(FormatWebM, "invalid EBML header")
+	}
+	docType := ""
+	ebmlChildren(data, func(id int64, data []byte) {
+		if id == ebmlIDDocType {
+			docType = strings.TrimRight(string(data), "\x00")
+		}
+	})
+	if docType != "webm" && docType != "matroska" {
+		return nil, fmt.Errorf("%w: EBML document type %q", ErrUnsupported, docType)
+	}
+
+	segment, _, err := readElement(r, size, header.dataOffset+header.size, 0)
+	if err != nil || segment.id != ebmlIDSegment {
+		return nil, corrupt(FormatWebM, "no segment after EBML header")
+	}
+	segmentEnd := size
+	if segment.size != ebmlUnknownSize {
+		segmentEnd = min(segment.dataOffset+segment.size, size)
+	}
+
+	// Info and Tracks come before the first Cluster in files written by
+	// browsers and by common muxers.
+	var info, tracks []byte
+	for offset := segment.dataOffset; offset < segmentEnd && (info == nil || tracks == nil); {
+		element, data, err := readElement(r, size, offset, maxWebMElementSize)
+		if err != nil || element.id == ebmlIDCluster || element.size == ebmlUnknownSize {
+			break
+		}
+		switch element.id {
+		case ebmlIDInfo:
+			info = data
+		case ebmlIDTracks:
+			tracks = data
+		}
+		offset = element.dataOffset + element.size
+	}
+	if tracks == nil {
+		return nil, corrupt(FormatWebM, "no tracks before the first cluster")
+	}
+
+	result, ok := parseMatroskaTracks(tracks)
+	if !ok {
+		return nil, fmt.Errorf("%w: WebM file has no audio track", ErrUnsupported)
+	}
+	timecodeScale := uint64(defaultTimecodeScale)
+	ebmlChildren(info, func(id int64, data []byte) {
+		switch id {
+		case ebmlIDTimecodeScale:
+			timecodeScale = ebmlUint(data)
+		case ebmlIDDuration:
+			result.DurationSeconds = ebmlFloat(data)
+		}
+	})
+	result.DurationSeconds *= float64(timecodeScale) / 1e9
+	return result, nil
+}
+
+// parseMatroskaTracks describes the first audio track in the content of a
+// Tracks element.
+func parseMatroskaTracks(tracks []byte) (*Info, bool) {
+	var result *Info
+	ebmlChildren(tracks, func(id int64, entry []byte) {
+		if id != ebmlIDTrackEntry || result != nil {
+			return
+		}
+		var trackType uint64
+		info := &Info{Format: FormatWebM}
+		ebmlChildren(entry, func(id int64, data []byte) {
+			switch id {
+			case ebmlIDTrackType:
+				trackType = ebmlUint(data)
+			case ebmlIDCodecID:
+				info.Codec = strings.ToLower(strings.TrimPrefix(string(data), "A_"))
+			case ebmlIDAudio:
+				// Matroska defaults to 8 kHz mono.
+				info.SampleRate, info.Channels = 8000, 1
+				ebmlChildren(data, func(id int64, data []byte) {
+					switch id {
+					case ebmlIDSamplingFrequency:
+						info.SampleRate = int(ebmlFloat(data))
+					case ebmlIDChannels:
+						info.Channels = int(ebmlUint(data))
+					}
+				})
+			}
+		})
+		if trackType == matroskaTrackTypeAudio {
+			result = info
+		}
+	})
+	return result, result != nil
+}
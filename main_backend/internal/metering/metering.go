@@ -0,0 +1,314 @@
+// Package metering tracks how much transcription each user consumes and
+// enforces the limits of their plan.
+//
+// Usage is derived from the jobs store: a job's audio length counts against
+// its owner's quota for the month it was started in, unless the job failed.
+// Cancelled and timed-out jobs count for the audio they had started to
+// transcribe, and jobs whose length is not known yet reserve a fixed amount
+// of quota. RunPod time is reported alongside, counting every RunPod job that
+// was run, including the chunks of long recordings.
+package metering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+const (
+	DefaultFreeMonthlyMinutes = 60
+	DefaultPaidMonthlyMinutes = 3000
+	// DefaultUnknownAudioMinutes is how much quota a job reserves until its
+	// length is known, e.g. for audio given by URL.
+	DefaultUnknownAudioMinutes = 60
+)
+
+var (
+	ErrQuotaExceeded   = errors.New("monthly transcription quota exceeded")
+	ErrModelNotAllowed = errors.New("model is not available on your plan")
+)
+
+type Plan struct {
+	Name           string
+	MonthlyMinutes float64
+	// UnknownAudioMinutes is how much quota a job reserves until its length
+	// is known.
+	UnknownAudioMinutes float64
+	// Models lists the models the plan may use. A nil list allows all models.
+	Models []string
+}
+
+// GetPlans returns the available plans. FREE_MONTHLY_MINUTES and
+// PAID_MONTHLY_MINUTES override the default quotas, and UNKNOWN_AUDIO_MINUTES
+// how much of them jobs of unknown length reserve.
+var GetPlans = sync.OnceValue(func() map[string]Plan {
+	unknownAudioMinutes := utils.GetEnvFloat("UNKNOWN_AUDIO_MINUTES", DefaultUnknownAudioMinutes)
+	return map[string]Plan{
+		auth.PlanFree: {
+			Name:                auth.PlanFree,
+			MonthlyMinutes:      utils.GetEnvFloat("FREE_MONTHLY_MINUTES", DefaultFreeMonthlyMinutes),
+			UnknownAudioMinutes: unknownAudioMinutes,
+			Models: []string{
+				whisper.WhisperModelTiny,
+				whisper.WhisperModelBase,
+				whisper.WhisperModelSmall,
+				whisper.WhisperModelMedium,
+			},
+		},
+		auth.PlanPaid: {
+			Name:                auth.PlanPaid,
+			MonthlyMinutes:      utils.GetEnvFloat("PAID_MONTHLY_MINUTES", DefaultPaidMonthlyMinutes),
+			UnknownAudioMinutes: unknownAudioMinutes,
+		},
+	}
+})
+
+// GetPlan returns the plan a user is on. Unknown plans are treated as free.
+func GetPlan(user *auth.User) Plan {
+	plans := GetPlans()
+	plan, ok := plans[user.Plan]
+	if !ok {
+		return plans[auth.PlanFree]
+	}
+	return plan
+}
+
+// AllowsModel reports whether the plan may use model. An empty model is
+// whisper's default, which every plan may use.
+func (p Plan) AllowsModel(model string) bool {
+	return p.Models == nil || model == "" || slices.Contains(p.Models, model)
+}
+
+// PeriodStart returns the start of the billing period containing t, which is
+// the start of its calendar month in UTC.
+func PeriodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+type JobUsage struct {
+	JobID        string    `json:"job_id"`
+	Status       string    `json:"status"`
+	Model        string    `json:"model,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	AudioSeconds float64   `json:"audio_seconds"`
+	// ChargedSeconds is how much of the audio counts against the quota.
+	ChargedSeconds float64 `json:"charged_seconds"`
+	// DelayTime and ExecutionTime are in milliseconds, summed over the
+	// RunPod jobs the job was split into.
+	DelayTime     int `json:"delay_time"`
+	ExecutionTime int `json:"execution_time"`
+}
+
+type Usage struct {
+	Plan             string     `json:"plan"`
+	PeriodStart      time.Time  `json:"period_start"`
+	PeriodEnd        time.Time  `json:"period_end"`
+	QuotaMinutes     float64    `json:"quota_minutes"`
+	UsedMinutes      float64    `json:"used_minutes"`
+	RemainingMinutes float64    `json:"remaining_minutes"`
+	DelayTime        int        `json:"delay_time"`
+	ExecutionTime    int        `json:"execution_time"`
+	Jobs             []JobUsage `json:"jobs"`
+}
+
+// GetUsage reports user's usage in the billing period containing now.
+func GetUsage(ctx context.Context, store jobs.Store, user *auth.User, now time.Time) (*Usage, error) {
+	plan := GetPlan(user)
+	periodStart := PeriodStart(now)
+	usage := &Usage{
+		Plan:         plan.Name,
+		PeriodStart:  periodStart,
+		PeriodEnd:    periodStart.AddDate(0, 1, 0),
+		QuotaMinutes: plan.MonthlyMinutes,
+		Jobs:         []JobUsage{},
+	}
+
+	ownerJobs, err := store.ListByOwner(ctx, user.ID, periodStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	// Chunks are reported as part of their parent.
+	children := make(map[string][]jobs.Job)
+	for _, job := range ownerJobs {
+		if job.ParentID != "" {
+			children[job.ParentID] = append(children[job.ParentID], job)
+		}
+	}
+	index := make(map[string]int)
+	for _, job := range ownerJobs {
+		if job.ParentID != "" {
+			continue
+		}
+		charged, err := chargedSeconds(ctx, store, plan, &job, children[job.ID])
+		if err != nil {
+			return nil, err
+		}
+		index[job.ID] = len(usage.Jobs)
+		usage.Jobs = append(usage.Jobs, JobUsage{
+			JobID:          job.ID,
+			Status:         job.Status,
+			Model:          job.Input.Model,
+			CreatedAt:      job.CreatedAt,
+			AudioSeconds:   job.AudioSeconds,
+			ChargedSeconds: charged,
+		})
+		usage.UsedMinutes += charged / 60
+	}
+
+	for _, job := range ownerJobs {
+		if job.Chunks > 0 {
+			continue
+		}
+		i, ok := index[job.ID]
+		if job.ParentID != "" {
+			i, ok = index[job.ParentID]
+		}
+		if ok {
+			usage.Jobs[i].DelayTime += job.DelayTime
+			usage.Jobs[i].ExecutionTime += job.ExecutionTime
+		}
+		usage.DelayTime += job.DelayTime
+		usage.ExecutionTime += job.ExecutionTime
+	}
+
+	usage.RemainingMinutes = max(usage.QuotaMinutes-usage.UsedMinutes, 0)
+	return usage, nil
+}
+
+// chargedSeconds returns how much of job's audio counts against its owner's
+// quota. Failed jobs are free. Cancelled and timed-out jobs are charged for
+// the audio they had started to transcribe: all of it, or, for a chunked
+// job, all of each chunk that had started. Jobs that have not finished and
+// whose length is not known reserve the plan's unknown audio minutes.
+func chargedSeconds(ctx context.Context, store jobs.Store, plan Plan, job *jobs.Job, children []jobs.Job) (float64, error) {
+	switch job.Status {
+	case jobs.StatusFailed:
+		return 0, nil
+	case jobs.StatusCanceled, jobs.StatusTimeout:
+		if job.Chunks == 0 {
+			return consumedSeconds(ctx, store, job)
+		}
+		var total float64
+		for _, child := range children {
+			consumed, err := consumedSeconds(ctx, store, &child)
+			if err != nil {
+				return 0, err
+			}
+			total += consumed
+		}
+		return total, nil
+	}
+	if job.AudioSeconds == 0 && !jobs.IsTerminal(job.Status) {
+		return plan.UnknownAudioMinutes * 60, nil
+	}
+	return job.AudioSeconds, nil
+}
+
+// consumedSeconds returns how much audio a job that did not complete had
+// started to transcribe: none if it was never run, and otherwise its length,
+// or its execution time if its length is not known.
+func consumedSeconds(ctx context.Context, store jobs.Store, job *jobs.Job) (float64, error) {
+	started := job.Status == jobs.StatusComplete || job.ExecutionTime > 0
+	if !started {
+		transitions, err := store.Transitions(ctx, job.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get transitions of job %s: %w", job.ID, err)
+		}
+		for _, transition := range transitions {
+			for _, status := range []string{transition.From, transition.To} {
+				if status == jobs.StatusProgress || status == jobs.StatusDiarizing {
+					started = true
+				}
+			}
+		}
+	}
+	if !started {
+		return 0, nil
+	}
+	if job.AudioSeconds > 0 {
+		return job.AudioSeconds, nil
+	}
+	return float64(job.ExecutionTime) / 1000, nil
+}
+
+// Check returns an error if user may not start a job with model on audio of
+// the given length. An audioSeconds of 0 means the length is not known yet,
+// in which case the job must fit the plan's unknown audio minutes.
+func Check(usage *Usage, user *auth.User, model string, audioSeconds float64) error {
+	plan := GetPlan(user)
+	if !plan.AllowsModel(model) {
+		return fmt.Errorf("%w: %s", ErrModelNotAllowed, model)
+	}
+	if audioSeconds == 0 {
+		audioSeconds = plan.UnknownAudioMinutes * 60
+	}
+	if usage.RemainingMinutes <= 0 || audioSeconds/60 > usage.RemainingMinutes {
+		return fmt.Errorf("%w: %.1f of %.0f minutes used", ErrQuotaExceeded, usage.UsedMinutes, usage.QuotaMinutes)
+	}
+	return nil
+}
+
+// Admit records job for user in store if Check allows it, and returns Check's
+// error otherwise. Admissions are serialized per owner, so concurrent jobs
+// cannot all be admitted against the same remaining quota. They are only
+// serialized within a process, which is all the SQLite store supports.
+func Admit(ctx context.Context, store jobs.Store, user *auth.User, job *jobs.Job, now time.Time) error {
+	unlock := admissions.lock(user.ID)
+	defer unlock()
+
+	usage, err := GetUsage(ctx, store, user, now)
+	if err != nil {
+		return fmt.Errorf("failed to get usage: %w", err)
+	}
+	err = Check(usage, user, job.Input.Model, job.AudioSeconds)
+	if err != nil {
+		return err
+	}
+	return store.Create(ctx, job)
+}
+
+var admissions = &ownerLocks{locks: make(map[string]*ownerLock)}
+
+// ownerLocks holds a mutex for each owner with an admission in progress.
+type ownerLocks struct {
+	mu    sync.Mutex
+	locks map[string]*ownerLock
+}
+
+type ownerLock struct {
+	sync.Mutex
+	// holders is the number of admissions holding or waiting for the lock.
+	holders int
+}
+
+func (l *ownerLocks) lock(owner string) (unlock func()) {
+	l.mu.Lock()
+	lock, ok := l.locks[owner]
+	if !ok {
+		lock = &ownerLock{}
+		l.locks[owner] = lock
+	}
+	lock.holders++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(l.locks, owner)
+		}
+		l.mu.Unlock()
+	}
+}
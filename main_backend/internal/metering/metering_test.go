@@ -0,0 +1,220 @@
+package metering_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/metering"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+func newTestStore(t *testing.T) *jobs.SQLiteStore {
+	store, err := jobs.NewSQLiteStore(database.OpenTest(t))
+	if err != nil {
+		t.Fatalf("Failed to create job store: %v", err)
+	}
+	return store
+}
+
+func TestGetUsage(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := &auth.User{ID: "user-1", Plan: auth.PlanFree}
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC)
+	thisMonth := now.Add(-time.Hour)
+	lastMonth := now.AddDate(0, -1, 0)
+
+	testJobs := []*jobs.Job{
+		// A single job: 10 minutes.
+		{ID: "single", Owner: user.ID, Status: jobs.StatusComplete, AudioSeconds: 600, DelayTime: 100, ExecutionTime: 1000, CreatedAt: thisMonth},
+		// A chunked job: 20 minutes, with RunPod time taken from its chunks.
+		{ID: "parent", Owner: user.ID, Status: jobs.StatusComplete, AudioSeconds: 1200, Chunks: 2, ExecutionTime: 3000, CreatedAt: thisMonth},
+		{ID: "chunk-0", Owner: user.ID, ParentID: "parent", Status: jobs.StatusComplete, AudioSeconds: 610, DelayTime: 200, ExecutionTime: 2000, CreatedAt: thisMonth},
+		{ID: "chunk-1", Owner: user.ID, ParentID: "parent", Status: jobs.StatusComplete, AudioSeconds: 600, DelayTime: 300, ExecutionTime: 3000, CreatedAt: thisMonth},
+		// Failed jobs don't count against the quota, but their RunPod time is reported.
+		{ID: "failed", Owner: user.ID, Status: jobs.StatusFailed, AudioSeconds: 600, DelayTime: 50, ExecutionTime: 500, CreatedAt: thisMonth},
+		// Jobs from other periods and other users are not counted.
+		{ID: "old", Owner: user.ID, Status: jobs.StatusComplete, AudioSeconds: 6000, CreatedAt: lastMonth},
+		{ID: "other", Owner: "user-2", Status: jobs.StatusComplete, AudioSeconds: 6000, CreatedAt: thisMonth},
+	}
+	for _, job := range testJobs {
+		err := store.Create(ctx, job)
+		if err != nil {
+			t.Fatalf("Failed to create job %s: %v", job.ID, err)
+		}
+	}
+
+	usage, err := metering.GetUsage(ctx, store, user, now)
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+
+	if !usage.PeriodStart.Equal(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected period to start on March 1st, got %v", usage.PeriodStart)
+	}
+	if usage.QuotaMinutes != metering.DefaultFreeMonthlyMinutes {
+		t.Errorf("Expected quota of %d minutes, got %v", metering.DefaultFreeMonthlyMinutes, usage.QuotaMinutes)
+	}
+	if usage.UsedMinutes != 30 {
+		t.Errorf("Expected 30 minutes used, got %v", usage.UsedMinutes)
+	}
+	if usage.RemainingMinutes != 30 {
+		t.Errorf("Expected 30 minutes remaining, got %v", usage.RemainingMinutes)
+	}
+	if usage.DelayTime != 650 || usage.ExecutionTime != 6500 {
+		t.Errorf("Expected 650ms delay and 6500ms execution, got %d and %d", usage.DelayTime, usage.ExecutionTime)
+	}
+
+	if len(usage.Jobs) != 3 {
+		t.Fatalf("Expected 3 jobs, got %d", len(usage.Jobs))
+	}
+	parent := usage.Jobs[1]
+	if parent.JobID != "parent" || parent.DelayTime != 500 || parent.ExecutionTime != 5000 {
+		t.Errorf("Expected chunk time to be attributed to parent, got %+v", parent)
+	}
+}
+
+func TestGetUsageUnfinished(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	user := &auth.User{ID: "user-1", Plan: auth.PlanFree}
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC)
+	thisMonth := now.Add(-time.Hour)
+
+	testJobs := []*jobs.Job{
+		// Cancelled while being transcribed: 10 minutes.
+		{ID: "cancelled", Owner: user.ID, Status: jobs.StatusProgress, AudioSeconds: 600, CreatedAt: thisMonth},
+		// Cancelled before it was run: free.
+		{ID: "queued", Owner: user.ID, Status: jobs.StatusQueue, AudioSeconds: 600, CreatedAt: thisMonth},
+		// Timed out with one of two chunks started: 5 minutes.
+		{ID: "parent", Owner: user.ID, Status: jobs.StatusTimeout, AudioSeconds: 1200, Chunks: 2, CreatedAt: thisMonth},
+		{ID: "chunk-0", Owner: user.ID, ParentID: "parent", Status: jobs.StatusComplete, AudioSeconds: 300, ExecutionTime: 1000, CreatedAt: thisMonth},
+		{ID: "chunk-1", Owner: user.ID, ParentID: "parent", Status: jobs.StatusTimeout, AudioSeconds: 900, CreatedAt: thisMonth},
+		// Of unknown length and still running: reserves the unknown audio minutes.
+		{ID: "url", Owner: user.ID, Status: jobs.StatusProgress, CreatedAt: thisMonth},
+	}
+	for _, job := range testJobs {
+		err := store.Create(ctx, job)
+		if err != nil {
+			t.Fatalf("Failed to create job %s: %v", job.ID, err)
+		}
+	}
+	for _, id := range []string{"cancelled", "queued"} {
+		_, err := store.UpdateStatus(ctx, id, jobs.StatusUpdate{Status: jobs.StatusCanceled})
+		if err != nil {
+			t.Fatalf("Failed to cancel job %s: %v", id, err)
+		}
+	}
+
+	usage, err := metering.GetUsage(ctx, store, user, now)
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	expected := map[string]float64{"cancelled": 600, "queued": 0, "parent": 300, "url": metering.DefaultUnknownAudioMinutes * 60}
+	for _, job := range usage.Jobs {
+		if job.ChargedSeconds != expected[job.JobID] {
+			t.Errorf("Expected %s to be charged %v seconds, got %v", job.JobID, expected[job.JobID], job.ChargedSeconds)
+		}
+	}
+	if usage.UsedMinutes != 75 || usage.RemainingMinutes != 0 {
+		t.Errorf("Expected 75 minutes used and none remaining, got %+v", usage)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	free := &auth.User{ID: "user-1", Plan: auth.PlanFree}
+	paid := &auth.User{ID: "user-2", Plan: auth.PlanPaid}
+	usage := &metering.Usage{QuotaMinutes: 60, UsedMinutes: 50, RemainingMinutes: 10}
+
+	err := metering.Check(usage, free, whisper.WhisperModelSmall, 5*60)
+	if err != nil {
+		t.Errorf("Expected job within quota to be allowed, got %v", err)
+	}
+
+	err = metering.Check(usage, free, whisper.WhisperModelLargeV3, 60)
+	if !errors.Is(err, metering.ErrModelNotAllowed) {
+		t.Errorf("Expected %v for free user, got %v", metering.ErrModelNotAllowed, err)
+	}
+
+	err = metering.Check(usage, paid, whisper.WhisperModelLargeV3, 60)
+	if err != nil {
+		t.Errorf("Expected paid user to use %s, got %v", whisper.WhisperModelLargeV3, err)
+	}
+
+	err = metering.Check(usage, free, whisper.WhisperModelSmall, 15*60)
+	if !errors.Is(err, metering.ErrQuotaExceeded) {
+		t.Errorf("Expected %v for job longer than remaining quota, got %v", metering.ErrQuotaExceeded, err)
+	}
+
+	err = metering.Check(usage, free, whisper.WhisperModelSmall, 0)
+	if !errors.Is(err, metering.ErrQuotaExceeded) {
+		t.Errorf("Expected %v for job of unknown length longer than remaining quota, got %v", metering.ErrQuotaExceeded, err)
+	}
+
+	exhausted := &metering.Usage{QuotaMinutes: 60, UsedMinutes: 60}
+	err = metering.Check(exhausted, free, whisper.WhisperModelSmall, 0)
+	if !errors.Is(err, metering.ErrQuotaExceeded) {
+		t.Errorf("Expected %v for job of unknown length with no quota left, got %v", metering.ErrQuotaExceeded, err)
+	}
+}
+
+// slowStore widens the window between reading a user's usage and creating
+// their job.
+type slowStore struct {
+	*jobs.SQLiteStore
+}
+
+func (s slowStore) ListByOwner(ctx context.Context, owner string, since time.Time) ([]jobs.Job, error) {
+	ownerJobs, err := s.SQLiteStore.ListByOwner(ctx, owner, since)
+	time.Sleep(10 * time.Millisecond)
+	return ownerJobs, err
+}
+
+func TestAdmitConcurrent(t *testing.T) {
+	ctx := context.Background()
+	store := slowStore{newTestStore(t)}
+	user := &auth.User{ID: "user-1", Plan: auth.PlanFree}
+
+	// Each job of unknown length reserves the whole free quota, so only one of
+	// them may be admitted.
+	const attempts = 10
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job := &jobs.Job{ID: fmt.Sprintf("job-%d", i), Owner: user.ID, Input: whisper.WhisperInput{Model: whisper.WhisperModelSmall}}
+			errs[i] = metering.Admit(ctx, store, user, job, time.Now())
+		}()
+	}
+	wg.Wait()
+
+	admitted := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			admitted++
+		case !errors.Is(err, metering.ErrQuotaExceeded):
+			t.Errorf("Expected %v, got %v", metering.ErrQuotaExceeded, err)
+		}
+	}
+	if admitted != 1 {
+		t.Errorf("Expected 1 job to be admitted, got %d", admitted)
+	}
+
+	ownerJobs, err := store.ListByOwner(ctx, user.ID, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(ownerJobs) != 1 {
+		t.Errorf("Expected 1 job to be created, got %d", len(ownerJobs))
+	}
+}
@@ -0,0 +1,172 @@
+package objectstore
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+var (
+	ErrInvalidChecksum  = errors.New("invalid checksum")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksum holds checksums of an object's content, base64 encoded as in the
+// Content-MD5 header and in GCS object metadata. CRC32C is big-endian.
+// Either may be empty if it is not known.
+type Checksum struct {
+	MD5    string `json:"md5,omitempty"`
+	CRC32C string `json:"crc32c,omitempty"`
+}
+
+func (c Checksum) IsZero() bool {
+	return c.MD5 == "" && c.CRC32C == ""
+}
+
+// Validate returns ErrInvalidChecksum if either checksum is malformed.
+func (c Checksum) Validate() error {
+	if c.MD5 != "" {
+		sum, err := base64.StdEncoding.DecodeString(c.MD5)
+		if err != nil || len(sum) != md5.Size {
+			return fmt.Errorf("%w: md5 %q", ErrInvalidChecksum, c.MD5)
+		}
+	}
+	if c.CRC32C != "" {
+		_, err := DecodeCRC32C(c.CRC32C)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify returns ErrChecksumMismatch if actual contradicts c. Checksums
+// missing from either side are not compared.
+func (c Checksum) Verify(actual Checksum) error {
+	if c.MD5 != "" && actual.MD5 != "" && c.MD5 != actual.MD5 {
+		return fmt.Errorf("%w: expected md5 %s, got %s", ErrChecksumMismatch, c.MD5, actual.MD5)
+	}
+	if c.CRC32C != "" && actual.CRC32C != "" && c.CRC32C != actual.CRC32C {
+		return fmt.Errorf("%w: expected crc32c %s, got %s", ErrChecksumMismatch, c.CRC32C, actual.CRC32C)
+	}
+	return nil
+}
+
+// ComputeChecksum reads r to the end and returns its checksums and length.
+func ComputeChecksum(r io.Reader) (Checksum, int64, error) {
+	md5Hash := md5.New()
+	crcHash := crc32.New(castagnoli)
+	n, err := io.Copy(io.MultiWriter(md5Hash, crcHash), r)
+	if err != nil {
+		return Checksum{}, n, err
+	}
+	return Checksum{
+		MD5:    base64.StdEncoding.EncodeToString(md5Hash.Sum(nil)),
+		CRC32C: EncodeCRC32C(crcHash.Sum32()),
+	}, n, nil
+}
+
+// MD5FromHex converts a hex MD5, such as the ETag of a non-multipart S3
+// object, to base64. It returns "" if etag is not a hex MD5.
+func MD5FromHex(etag string) string {
+	sum, err := hex.DecodeString(etag)
+	if err != nil || len(sum) != md5.Size {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
+func EncodeCRC32C(crc uint32) string {
+	return base64.StdEncoding.EncodeToString(binary.BigEndian.AppendUint32(nil, crc))
+}
+
+func DecodeCRC32C(s string) (uint32, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return 0, fmt.Errorf("%w: crc32c %q", ErrInvalidChecksum, s)
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// ChecksumPart is the CRC32C and length of one piece of a composed object.
+type ChecksumPart struct {
+	CRC32C string
+	Size   int64
+}
+
+// CompositeCRC32C returns the CRC32C of the concatenation of parts, which is
+// what a store reports for an object composed from them.
+func CompositeCRC32C(parts []ChecksumPart) (string, error) {
+	var crc uint32
+	for i, part := range parts {
+		partCRC, err := DecodeCRC32C(part.CRC32C)
+		if err != nil {
+			return "", fmt.Errorf("part %d: %w", i, err)
+		}
+		crc = combineCRC32C(crc, partCRC, part.Size)
+	}
+	return EncodeCRC32C(crc), nil
+}
+
+// combineCRC32C returns the CRC32C of A+B given the CRC32Cs of A and B and
+// the length of B, without reading either. It is zlib's crc32_combine: the
+// CRC of A is advanced over len2 zero bytes by repeatedly squaring the
+// operator for a single zero bit, then combined with the CRC of B.
+func combineCRC32C(crc1 uint32, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1
+	}
+
+	var even, odd [32]uint32
+	odd[0] = crc32.Castagnoli
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	gf2MatrixSquare(&even, &odd) // two zero bits
+	gf2MatrixSquare(&odd, &even) // four zero bits
+
+	for {
+		gf2MatrixSquare(&even, &odd)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(&odd, &even)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat *[32]uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square *[32]uint32, mat *[32]uint32) {
+	for n := range 32 {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
@@ -0,0 +1,351 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Multipart uploads are emulated on top of any ObjectStore: each part is
+// uploaded as its own object, and the parts are composed into the final
+// object once they are all present.
+//
+// Stores that implement MultipartStore use their native multipart upload
+// instead. The object key is then fixed when the upload is started, so it is
+// encoded into the upload ID handed to the client.
+
+const (
+	// MaxParts is the most parts an upload may have, which is the S3 limit.
+	MaxParts = 10000
+	// MaxComposeSources is the most objects a single Compose may concatenate,
+	// which is the GCS limit. Emulated uploads with more parts are composed
+	// in tiers.
+	MaxComposeSources = 32
+)
+
+// MultipartStore is implemented by stores with native multipart upload
+// support. Part numbers are zero-based, like in the emulated flow.
+type MultipartStore interface {
+	ObjectStore
+	CreateMultipartUpload(ctx context.Context, key string) (uploadID string, err error)
+	// PresignUploadPart presigns the upload of a part. If checksum is not
+	// zero, the upload is rejected unless the part matches it, and the client
+	// must send the returned headers.
+	PresignUploadPart(ctx context.Context, key string, uploadID string, partNumber int, duration time.Duration, checksum Checksum) (string, http.Header, error)
+	CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts int) error
+	AbortMultipartUpload(ctx context.Context, key string, uploadID string) error
+	// ListParts returns the parts of the upload that have been uploaded.
+	ListParts(ctx context.Context, key string, uploadID string) ([]Part, error)
+}
+
+// Part is a part of a multipart upload that has been uploaded.
+type Part struct {
+	PartNumber int      `json:"part_number"`
+	Size       int64    `json:"size"`
+	ETag       string   `json:"etag,omitempty"`
+	Checksum   Checksum `json:"checksum,omitempty"`
+}
+
+var ErrInvalidUploadID = errors.New("invalid upload id")
+
+// emulatedUploadIDBytes is the number of random bytes in an emulated upload
+// ID, which is hex encoded.
+const emulatedUploadIDBytes = 16
+
+func encodeNativeUploadID(key string, nativeUploadID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key)) + "." + nativeUploadID
+}
+
+func decodeNativeUploadID(uploadID string) (key string, nativeUploadID string, err error) {
+	encodedKey, nativeUploadID, ok := strings.Cut(uploadID, ".")
+	if !ok || nativeUploadID == "" {
+		return "", "", ErrInvalidUploadID
+	}
+	decodedKey, err := base64.RawURLEncoding.DecodeString(encodedKey)
+	if err != nil || len(decodedKey) == 0 {
+		return "", "", ErrInvalidUploadID
+	}
+	return string(decodedKey), nativeUploadID, nil
+}
+
+func StartMultipartUpload(ctx context.Context, store ObjectStore, key string) (uploadID string, err error) {
+	if native, ok := store.(MultipartStore); ok {
+		nativeUploadID, err := native.CreateMultipartUpload(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		return encodeNativeUploadID(key, nativeUploadID), nil
+	}
+
+	randomBytes := make([]byte, emulatedUploadIDBytes)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(randomBytes), nil
+}
+
+func GeneratePartKey(uploadID string, partNumber int) (string, error) {
+	if partNumber < 0 || partNumber >= MaxParts {
+		return "", fmt.Errorf("part number must be between 0 and %d, got %d", MaxParts-1, partNumber)
+	}
+	return fmt.Sprintf("%s-part%d", uploadID, partNumber), nil
+}
+
+// composeKey returns the key of the i-th intermediate object in a tier of an
+// emulated upload's compose.
+func composeKey(uploadID string, tier int, i int) string {
+	return fmt.Sprintf("%s-compose%d-%d", uploadID, tier, i)
+}
+
+// ListUploadedParts returns the parts of an upload that have been uploaded so
+// far, ordered by part number, so an interrupted upload can be resumed.
+func ListUploadedParts(ctx context.Context, store ObjectStore, uploadID string) ([]Part, error) {
+	var parts []Part
+	if native, ok := store.(MultipartStore); ok {
+		key, nativeUploadID, err := decodeNativeUploadID(uploadID)
+		if err != nil {
+			return nil, err
+		}
+		parts, err = native.ListParts(ctx, key, nativeUploadID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		prefix := uploadID + "-part"
+		objects, err := store.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			partNumber, err := strconv.Atoi(strings.TrimPrefix(object.Key, prefix))
+			if err != nil {
+				continue
+			}
+			parts = append(parts, Part{PartNumber: partNumber, Size: object.Size, ETag: object.ETag, Checksum: object.Checksum})
+		}
+	}
+
+	slices.SortFunc(parts, func(a, b Part) int {
+		return a.PartNumber - b.PartNumber
+	})
+	return parts, nil
+}
+
+// ParsePartKey returns the upload ID and part number of an emulated upload's
+// part object, or false if key is not a part key.
+func ParsePartKey(key string) (uploadID string, partNumber int, ok bool) {
+	uploadID, partStr, ok := strings.Cut(key, "-part")
+	if !ok || !isEmulatedUploadID(uploadID) {
+		return "", 0, false
+	}
+	partNumber, err := strconv.Atoi(partStr)
+	if err != nil || partNumber < 0 {
+		return "", 0, false
+	}
+	return uploadID, partNumber, true
+}
+
+// ParseUploadObjectKey returns the upload ID of the temporary objects of an
+// emulated upload: its parts and the intermediate objects composed from
+// them. It returns false for any other key.
+func ParseUploadObjectKey(key string) (uploadID string, ok bool) {
+	if uploadID, _, ok := ParsePartKey(key); ok {
+		return uploadID, true
+	}
+	uploadID, _, ok = strings.Cut(key, "-compose")
+	if !ok || !isEmulatedUploadID(uploadID) {
+		return "", false
+	}
+	return uploadID, true
+}
+
+func isEmulatedUploadID(uploadID string) bool {
+	if len(uploadID) != 2*emulatedUploadIDBytes {
+		return false
+	}
+	_, err := hex.DecodeString(uploadID)
+	return err == nil
+}
+
+// AbortMultipartUpload discards the parts uploaded so far.
+func AbortMultipartUpload(ctx context.Context, store ObjectStore, uploadID string) error {
+	if native, ok := store.(MultipartStore); ok {
+		key, nativeUploadID, err := decodeNativeUploadID(uploadID)
+		if err != nil {
+			return err
+		}
+		return native.AbortMultipartUpload(ctx, key, nativeUploadID)
+	}
+
+	parts, err := store.List(ctx, uploadID+"-part")
+	if err != nil {
+		return err
+	}
+	var partKeys []string
+	for _, part := range parts {
+		if id, _, ok := ParsePartKey(part.Key); ok && id == uploadID {
+			partKeys = append(partKeys, part.Key)
+		}
+	}
+	_, err = DeleteObjects(ctx, store, partKeys)
+	return err
+}
+
+func GetUploadPartURL(ctx context.Context, store ObjectStore, uploadID string, partNumber int, duration time.Duration) (url string, err error) {
+	url, _, err = GetUploadPartURLWithChecksum(ctx, store, uploadID, partNumber, duration, Checksum{})
+	return url, err
+}
+
+// GetUploadPartURLWithChecksum is like GetUploadPartURL, but the upload is
+// rejected unless the part matches checksum, where the store supports it.
+// The client must send the returned headers with the upload.
+func GetUploadPartURLWithChecksum(ctx context.Context, store ObjectStore, uploadID string, partNumber int, duration time.Duration, checksum Checksum) (url string, headers http.Header, err error) {
+	partKey, err := GeneratePartKey(uploadID, partNumber)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if native, ok := store.(MultipartStore); ok {
+		key, nativeUploadID, err := decodeNativeUploadID(uploadID)
+		if err != nil {
+			return "", nil, err
+		}
+		return native.PresignUploadPart(ctx, key, nativeUploadID, partNumber, duration, checksum)
+	}
+
+	if presigner, ok := store.(ChecksumPresigner); ok && !checksum.IsZero() {
+		return presigner.PresignPutChecksum(ctx, partKey, duration, checksum)
+	}
+
+	url, err = store.PresignPut(ctx, partKey, duration)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return url, http.Header{}, nil
+}
+
+func CompleteMultipartUpload(ctx context.Context, store ObjectStore, key string, uploadID string, parts int) error {
+	if native, ok := store.(MultipartStore); ok {
+		return completeNativeMultipartUpload(ctx, native, key, uploadID, parts)
+	}
+
+	if parts < 1 || parts > MaxParts {
+		return fmt.Errorf("number of parts must be between 1 and %d, got %d", MaxParts, parts)
+	}
+
+	// 1. Check that all parts are uploaded
+	uploaded, err := ListUploadedParts(ctx, store, uploadID)
+	if err != nil {
+		return fmt.Errorf("failed to list parts: %v", err)
+	}
+	present := make(map[int]bool, len(uploaded))
+	for _, part := range uploaded {
+		present[part.PartNumber] = true
+	}
+	var partKeys []string
+	for partNumber := 0; partNumber < parts; partNumber++ {
+		if !present[partNumber] {
+			return fmt.Errorf("part %d not found", partNumber)
+		}
+		partKey, err := GeneratePartKey(uploadID, partNumber)
+		if err != nil {
+			return fmt.Errorf("failed to generate part key: %v", err)
+		}
+		partKeys = append(partKeys, partKey)
+	}
+
+	// 2. Compose all objects into one object
+	err = composeTiers(ctx, store, key, uploadID, partKeys)
+	if err != nil {
+		return fmt.Errorf("failed to compose objects: %v", err)
+	}
+
+	// 3. Delete all parts. Any left behind are collected by the upload
+	// janitor.
+	_, err = DeleteObjects(ctx, store, partKeys)
+	if err != nil {
+		slog.Error("Failed to delete parts", "uploadID", uploadID, "error", err)
+	}
+
+	return nil
+}
+
+// composeTiers composes srcs into dst, in tiers of at most MaxComposeSources
+// objects: each group of sources is composed into an intermediate object,
+// and the intermediate objects are composed in turn until few enough are
+// left for a single compose. Intermediate objects are deleted afterwards,
+// whether or not the compose succeeded.
+func composeTiers(ctx context.Context, store ObjectStore, dst string, uploadID string, srcs []string) error {
+	var intermediates []string
+	defer func() {
+		_, err := DeleteObjects(ctx, store, intermediates)
+		if err != nil {
+			slog.Error("Failed to delete intermediate objects", "uploadID", uploadID, "error", err)
+		}
+	}()
+
+	for tier := 0; len(srcs) > MaxComposeSources; tier++ {
+		var next []string
+		for i := 0; i*MaxComposeSources < len(srcs); i++ {
+			group := srcs[i*MaxComposeSources : min((i+1)*MaxComposeSources, len(srcs))]
+			if len(group) == 1 {
+				next = append(next, group[0])
+				continue
+			}
+			intermediate := composeKey(uploadID, tier, i)
+			intermediates = append(intermediates, intermediate)
+			err := store.Compose(ctx, intermediate, group)
+			if err != nil {
+				return fmt.Errorf("failed to compose %s: %v", intermediate, err)
+			}
+			next = append(next, intermediate)
+		}
+		srcs = next
+	}
+
+	return store.Compose(ctx, dst, srcs)
+}
+
+func completeNativeMultipartUpload(ctx context.Context, store MultipartStore, key string, uploadID string, parts int) error {
+	if parts < 1 || parts > MaxParts {
+		return fmt.Errorf("number of parts must be between 1 and %d, got %d", MaxParts, parts)
+	}
+
+	uploadKey, nativeUploadID, err := decodeNativeUploadID(uploadID)
+	if err != nil {
+		return err
+	}
+
+	err = store.CompleteMultipartUpload(ctx, uploadKey, nativeUploadID, parts)
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+
+	if key == uploadKey {
+		return nil
+	}
+
+	// The upload was started under a different key, so move it into place.
+	err = store.Compose(ctx, key, []string{uploadKey})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %v", uploadKey, key, err)
+	}
+	err = store.Delete(ctx, uploadKey)
+	if err != nil {
+		slog.Error("Failed to delete uploaded object", "key", uploadKey, "error", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// deleteConcurrency is how many objects DeleteObjects deletes at once.
+	deleteConcurrency = 8
+	// rangeURLDuration is how long the URLs GetRange fetches through are
+	// valid for.
+	rangeURLDuration = 15 * time.Minute
+)
+
+var ErrObjectNotExist = errors.New("object does not exist")
+
+type ObjectAttrs struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	Updated     time.Time `json:"updated"`
+	// ETag is the store's checksum of the object, which changes whenever its
+	// content does. How it is computed depends on the store.
+	ETag string `json:"etag,omitempty"`
+	// Checksum holds whichever standard checksums the store reports.
+	Checksum Checksum `json:"checksum,omitempty"`
+}
+
+// ObjectStore is the storage layer used by the upload and download flows.
+// Implementations hand out presigned URLs so that clients move object bytes
+// directly to and from the store, without going through the backend.
+type ObjectStore interface {
+	PresignPut(ctx context.Context, key string, duration time.Duration) (string, error)
+	PresignGet(ctx context.Context, key string, duration time.Duration) (string, error)
+	// Stat returns ErrObjectNotExist if there is no object at key.
+	Stat(ctx context.Context, key string) (*ObjectAttrs, error)
+	// Compose concatenates srcs, in order, into a new object at dst. Callers
+	// must not pass more than MaxComposeSources sources.
+	Compose(ctx context.Context, dst string, srcs []string) error
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectAttrs, error)
+}
+
+// ChecksumPresigner is implemented by stores that can presign uploads which
+// are rejected unless their content matches a checksum. The client must send
+// the returned headers with the upload.
+type ChecksumPresigner interface {
+	PresignPutChecksum(ctx context.Context, key string, duration time.Duration, checksum Checksum) (string, http.Header, error)
+}
+
+func Exists(ctx context.Context, store ObjectStore, key string) (bool, error) {
+	_, err := store.Stat(ctx, key)
+	if errors.Is(err, ErrObjectNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DeleteObjects deletes keys in parallel. It returns the keys that were
+// deleted, and an error joining the failures for the rest. Keys that are
+// already gone count as deleted.
+func DeleteObjects(ctx context.Context, store ObjectStore, keys []string) (deleted []string, err error) {
+	semaphore := make(chan struct{}, deleteConcurrency)
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			err := store.Delete(ctx, key)
+			if err != nil && !errors.Is(err, ErrObjectNotExist) {
+				errs[i] = fmt.Errorf("failed to delete %s: %w", key, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, key := range keys {
+		if errs[i] == nil {
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// GetRange fetches size bytes of the object at key, starting at offset,
+// through a presigned URL.
+func GetRange(ctx context.Context, store ObjectStore, key string, offset int64, size int64) (io.ReadCloser, error) {
+	url, err := store.PresignGet(ctx, key, rangeURLDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+size-1))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusOK && offset == 0:
+		// The server ignored the range; the prefix we want is still first.
+		return resp.Body, nil
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("download failed with status %s", resp.Status)
+	}
+}
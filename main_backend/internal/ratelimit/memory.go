@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBuckets is the number of buckets a MemoryLimiter holds before it
+// discards the ones that have refilled, or, if none have, the one that will
+// refill soonest.
+const DefaultMaxBuckets = 10000
+
+// MemoryLimiter is a Limiter that keeps its buckets in memory, so each replica
+// enforces its limits separately.
+type MemoryLimiter struct {
+	now        func() time.Time
+	maxBuckets int
+
+	// buckets holds the time at which each bucket will be full again, which
+	// is all that is needed to know how many requests it has left.
+	mu      sync.Mutex
+	buckets map[string]time.Time
+}
+
+type MemoryLimiterOption func(*MemoryLimiter)
+
+// WithClock sets the function used to get the current time.
+func WithClock(now func() time.Time) MemoryLimiterOption {
+	return func(l *MemoryLimiter) {
+		l.now = now
+	}
+}
+
+func WithMaxBuckets(maxBuckets int) MemoryLimiterOption {
+	return func(l *MemoryLimiter) {
+		l.maxBuckets = maxBuckets
+	}
+}
+
+func NewMemoryLimiter(options ...MemoryLimiterOption) *MemoryLimiter {
+	l := &MemoryLimiter{
+		now:        time.Now,
+		maxBuckets: DefaultMaxBuckets,
+		buckets:    make(map[string]time.Time),
+	}
+	for _, option := range options {
+		option(l)
+	}
+	return l
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	full, ok := l.buckets[key]
+	if !ok && len(l.buckets) >= l.maxBuckets {
+		l.prune(now)
+	}
+
+	// Taking a request pushes the time the bucket is full back by one
+	// interval. The bucket is empty when that is more than a period away.
+	if full.Before(now) {
+		full = now
+	}
+	full = full.Add(limit.interval())
+	if wait := full.Sub(now) - limit.Period; wait > 0 {
+		return false, wait, nil
+	}
+	l.buckets[key] = full
+	return true, 0, nil
+}
+
+// prune discards buckets that are full, as they are the same as no bucket.
+// If none are, it discards the bucket that will be full soonest, which lets
+// that client make a few more requests than its limit but keeps a flood of
+// new clients from growing the buckets without bound.
+func (l *MemoryLimiter) prune(now time.Time) {
+	var soonestKey string
+	var soonest time.Time
+	for key, full := range l.buckets {
+		if !full.After(now) {
+			delete(l.buckets, key)
+			continue
+		}
+		if soonestKey == "" || full.Before(soonest) {
+			soonestKey, soonest = key, full
+		}
+	}
+	if len(l.buckets) >= l.maxBuckets {
+		delete(l.buckets, soonestKey)
+	}
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+)
+
+// KeyFunc identifies the client making a request, or returns "" if it cannot.
+type KeyFunc func(r *http.Request) string
+
+// ByUser identifies clients by the user they authenticated as, so it must be
+// used behind auth.RequireUser. Keying by the credentials presented instead
+// would let clients fill the limiter with made-up ones.
+func ByUser(r *http.Request) string {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		return ""
+	}
+	return "user:" + user.ID
+}
+
+// ByIP identifies clients by the address the request came from.
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ByForwardedIP is like ByIP, but behind a proxy it uses the address the
+// proxy received the request from: the last entry of X-Forwarded-For. It must
+// only be used behind a proxy that sets the header, as clients can.
+func ByForwardedIP(r *http.Request) string {
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" {
+		return ByIP(r)
+	}
+	hops := strings.Split(forwarded, ",")
+	return "ip:" + strings.TrimSpace(hops[len(hops)-1])
+}
+
+// Middleware returns a wrapper that rejects requests to route with 429 Too
+// Many Requests once the client has used up limit. A client is limited under
+// each key that keys returns for it, so limiting by both user and IP stops a
+// client from getting around the limit by switching either one.
+//
+// If the limiter fails, requests are let through rather than taking the
+// routes down with it.
+func Middleware(limiter Limiter, route string, limit Limit, keys ...KeyFunc) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, keyFunc := range keys {
+				key := keyFunc(r)
+				if key == "" {
+					continue
+				}
+				allowed, retryAfter, err := limiter.Allow(r.Context(), route+"|"+key, limit)
+				if err != nil {
+					slog.Error("Failed to check rate limit", "route", route, "error", err)
+					continue
+				}
+				if !allowed {
+					slog.Info("Rate limited request", "route", route, "key", key, "retryAfter", retryAfter)
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+					http.Error(w, "too many requests", http.StatusTooManyRequests)
+					return
+				}
+			}
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Package ratelimit limits how often clients may call expensive routes, such
+// as those that sign URLs or start RunPod jobs.
+//
+// Limits are token buckets: a client may make Burst requests at once, and
+// regains one request every Period/Burst after that.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit parses a limit of the form "<burst>/<period>", e.g. "60/1m".
+func ParseLimit(s string) (Limit, error) {
+	burstStr, periodStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, s)
+	}
+	burst, err := strconv.Atoi(burstStr)
+	if err != nil || burst <= 0 {
+		return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, s)
+	}
+	period, err := time.ParseDuration(periodStr)
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, s)
+	}
+	return Limit{Burst: burst, Period: period}, nil
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// interval returns how long it takes to regain one request.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Burst)
+}
+
+// Limiter decides whether a request identified by key may go ahead under
+// limit. Keys are only compared with each other, so callers should include
+// the route in them. Implementations may keep their state in memory or in a
+// store shared between replicas.
+type Limiter interface {
+	// Allow takes a request from key's bucket. If the bucket is empty, it
+	// returns false and how long until a request will be allowed.
+	Allow(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
@@ -0,0 +1,182 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/ratelimit"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ratelimit.ParseLimit("60/1m")
+	if err != nil {
+		t.Fatalf("Failed to parse limit: %v", err)
+	}
+	if limit.Burst != 60 || limit.Period != time.Minute {
+		t.Errorf("Expected 60/1m, got %v", limit)
+	}
+
+	for _, s := range []string{"60", "0/1m", "ten/1m", "10/soon", "10/0s"} {
+		_, err := ratelimit.ParseLimit(s)
+		if !errors.Is(err, ratelimit.ErrInvalidLimit) {
+			t.Errorf("Expected %v for %q, got %v", ratelimit.ErrInvalidLimit, s, err)
+		}
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := ratelimit.NewMemoryLimiter(ratelimit.WithClock(clock.Now))
+	limit := ratelimit.Limit{Burst: 3, Period: 3 * time.Second}
+
+	for i := range 3 {
+		allowed, _, err := limiter.Allow(ctx, "a", limit)
+		if err != nil || !allowed {
+			t.Fatalf("Expected request %d to be allowed, got %v, %v", i, allowed, err)
+		}
+	}
+
+	allowed, retryAfter, err := limiter.Allow(ctx, "a", limit)
+	if err != nil || allowed {
+		t.Fatalf("Expected request to be limited, got %v, %v", allowed, err)
+	}
+	if retryAfter != time.Second {
+		t.Errorf("Expected to retry after 1s, got %v", retryAfter)
+	}
+
+	allowed, _, _ = limiter.Allow(ctx, "b", limit)
+	if !allowed {
+		t.Errorf("Expected other key to have its own bucket")
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	allowed, _, _ = limiter.Allow(ctx, "a", limit)
+	if !allowed {
+		t.Errorf("Expected one request to be allowed after 1s")
+	}
+	allowed, _, _ = limiter.Allow(ctx, "a", limit)
+	if allowed {
+		t.Errorf("Expected only one request to be allowed after 1s")
+	}
+
+	// Buckets don't fill beyond their burst.
+	clock.now = clock.now.Add(time.Hour)
+	for i := range 4 {
+		allowed, _, _ := limiter.Allow(ctx, "a", limit)
+		if allowed != (i < 3) {
+			t.Errorf("Expected request %d after refilling to be allowed: %v, got %v", i, i < 3, allowed)
+		}
+	}
+}
+
+func TestMemoryLimiterPrunesFullBuckets(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := ratelimit.NewMemoryLimiter(ratelimit.WithClock(clock.Now), ratelimit.WithMaxBuckets(1))
+	limit := ratelimit.Limit{Burst: 1, Period: time.Minute}
+
+	limiter.Allow(ctx, "a", limit)
+	clock.now = clock.now.Add(time.Minute)
+	limiter.Allow(ctx, "b", limit)
+
+	// a was discarded when it refilled, so it starts with a full bucket.
+	allowed, _, _ := limiter.Allow(ctx, "a", limit)
+	if !allowed {
+		t.Errorf("Expected pruned bucket to be full")
+	}
+}
+
+func TestMemoryLimiterEvictsWhenFull(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := ratelimit.NewMemoryLimiter(ratelimit.WithClock(clock.Now), ratelimit.WithMaxBuckets(2))
+	limit := ratelimit.Limit{Burst: 1, Period: time.Minute}
+
+	// None of the buckets refill before the limiter is full, so the one that
+	// refills soonest, a's, is discarded to make room for c.
+	for _, key := range []string{"a", "b", "c"} {
+		allowed, _, _ := limiter.Allow(ctx, key, limit)
+		if !allowed {
+			t.Fatalf("Expected first request of %s to be allowed", key)
+		}
+		clock.now = clock.now.Add(time.Second)
+	}
+
+	allowed, _, _ := limiter.Allow(ctx, "b", limit)
+	if allowed {
+		t.Errorf("Expected bucket that was kept to still be empty")
+	}
+	allowed, _, _ = limiter.Allow(ctx, "a", limit)
+	if !allowed {
+		t.Errorf("Expected discarded bucket to be full")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter()
+	limit := ratelimit.Limit{Burst: 1, Period: time.Minute}
+	handler := ratelimit.Middleware(limiter, "TEST", limit, ratelimit.ByUser, ratelimit.ByIP)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	request := func(userID string, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/test", nil)
+		r.RemoteAddr = remoteAddr
+		if userID != "" {
+			r = r.WithContext(auth.WithUser(r.Context(), &auth.User{ID: userID}))
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := request("user-1", "192.0.2.1:1234")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected first request to succeed, got %d", w.Code)
+	}
+
+	w = request("user-1", "192.0.2.2:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected user to be limited from another IP, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected Retry-After of 60, got %q", w.Header().Get("Retry-After"))
+	}
+
+	w = request("user-2", "192.0.2.1:5678")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected IP to be limited as another user, got %d", w.Code)
+	}
+
+	w = request("user-3", "192.0.2.3:1234")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected new client to succeed, got %d", w.Code)
+	}
+}
+
+func TestByForwardedIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	if got := ratelimit.ByForwardedIP(r); got != "ip:10.0.0.1" {
+		t.Errorf("Expected remote address without X-Forwarded-For, got %q", got)
+	}
+
+	r.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+	if got := ratelimit.ByForwardedIP(r); got != "ip:198.51.100.7" {
+		t.Errorf("Expected last forwarded address, got %q", got)
+	}
+}
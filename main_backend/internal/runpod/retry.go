@@ -0,0 +1,170 @@
+package runpod
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRetries is how many times a failed request is retried.
+	DefaultRetries = 3
+	// DefaultBackoff is the longest wait before the first retry. The wait
+	// doubles with each retry, up to DefaultMaxBackoff.
+	DefaultBackoff    = 500 * time.Millisecond
+	DefaultMaxBackoff = 10 * time.Second
+
+	// maxErrorBodySize bounds how much of an error response is kept.
+	maxErrorBodySize = 4096
+)
+
+// WithRetries sets how many times a failed request is retried. Zero turns
+// retries off.
+func WithRetries(retries int) RunpodClientOption {
+	return func(c *RunpodClient) {
+		c.retries = max(retries, 0)
+	}
+}
+
+// WithBackoff sets the longest wait before the first retry, and the longest
+// wait before any retry. Waits are jittered.
+func WithBackoff(backoff time.Duration, maxBackoff time.Duration) RunpodClientOption {
+	return func(c *RunpodClient) {
+		c.backoff = backoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// APIError is a response from RunPod with a status other than 2xx.
+type APIError struct {
+	StatusCode int
+	Body       string
+	// Retryable is set for responses that may succeed if the request is
+	// sent again: 429 and 5xx.
+	Retryable bool
+	// RetryAfter is how long RunPod asked us to wait, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	body := e.Body
+	if body == "" {
+		body = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("runpod returned status %d: %s", e.StatusCode, body)
+}
+
+func newAPIError(resp *http.Response, now time.Time) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+		Retryable:  resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), now),
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, which holds either a number of
+// seconds or a date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// retryPolicy says which failed requests may be sent again.
+type retryPolicy int
+
+const (
+	// retryIdempotent retries requests that can be repeated safely after
+	// network errors, 429 and 5xx.
+	retryIdempotent retryPolicy = iota
+	// retryRejected retries requests that must not be repeated only after
+	// 429, which RunPod answers without acting on the request.
+	retryRejected
+)
+
+func (p retryPolicy) shouldRetry(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if p == retryRejected {
+			return apiErr.StatusCode == http.StatusTooManyRequests
+		}
+		return apiErr.Retryable
+	}
+	return p == retryIdempotent
+}
+
+// do sends a request with body, if any, and returns the body of the
+// response. Failed requests are retried as policy allows, with jittered
+// exponential backoff, or after as long as RunPod asks if it says. A request
+// RunPod asks us to wait longer than the maximum backoff for is not retried.
+func (c *RunpodClient) do(ctx context.Context, method string, url string, body []byte, policy retryPolicy) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		respBody, err := c.send(ctx, method, url, body)
+		if err == nil {
+			return respBody, nil
+		}
+		if attempt >= c.retries || ctx.Err() != nil || !policy.shouldRetry(err) {
+			return nil, err
+		}
+
+		wait := rand.N(min(c.backoff<<attempt, c.maxBackoff) + 1)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			if apiErr.RetryAfter > c.maxBackoff {
+				return nil, err
+			}
+			wait = apiErr.RetryAfter
+		}
+		slog.Warn("Retrying runpod request", "method", method, "url", url, "attempt", attempt+1, "wait", wait, "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *RunpodClient) send(ctx context.Context, method string, url string, body []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.RunpodAPIKey))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newAPIError(resp, time.Now())
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -1,15 +1,14 @@
 package runpod
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
-
-	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+	"strings"
+	"time"
 )
 
 const (
@@ -21,15 +20,35 @@ const (
 	StatusTimeout  = "TIMED_OUT"   // Job expired before processing or worker failed to report result in time
 )
 
-var RUNPOD_API_KEY = utils.GetEnvAssert("RUNPOD_API_KEY")
-
 type WebHook string
+
+// RunPod's defaults for unset ExecutionPolicy fields.
+const (
+	DefaultExecutionTimeout = 10 * time.Minute
+	DefaultTimeToLive       = 24 * time.Hour
+)
+
+// ExecutionPolicy durations are in milliseconds.
 type ExecutionPolicy struct {
 	Timeout    int `json:"executionTimeout,omitempty"`
 	Priority   int `json:"priority,omitempty"`
 	TimeToLive int `json:"ttl,omitempty"`
 }
 
+// MaxJobDuration returns how long a job run under the policy may wait in the
+// queue and then execute before RunPod gives up on it.
+func (p ExecutionPolicy) MaxJobDuration() time.Duration {
+	timeToLive := DefaultTimeToLive
+	if p.TimeToLive > 0 {
+		timeToLive = time.Duration(p.TimeToLive) * time.Millisecond
+	}
+	timeout := DefaultExecutionTimeout
+	if p.Timeout > 0 {
+		timeout = time.Duration(p.Timeout) * time.Millisecond
+	}
+	return timeToLive + timeout
+}
+
 type S3Config struct {
 	AccessId     string `json:"accessId,omitempty"`
 	AccessSecret string `json:"accessSecret,omitempty"`
@@ -61,48 +80,96 @@ type SyncRunResponse struct {
 	Output map[string]interface{} `json:"output"`
 }
 
+const (
+	// DefaultBaseURL is where endpoints given by ID are found.
+	DefaultBaseURL = "https://api.runpod.ai/v2"
+	// DefaultTimeout bounds each request unless an HTTP client is given. It
+	// leaves room for RunSync, which holds the request open while the job
+	// runs.
+	DefaultTimeout = 2 * time.Minute
+)
+
+// RunpodClient calls RunPod serverless endpoints. Methods take the endpoint
+// as a URL, or as an ID to be found under the base URL.
 type RunpodClient struct {
 	RunpodAPIKey string
+	httpClient   *http.Client
+	baseURL      string
+	retries      int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+}
+
+type RunpodClientOption func(*RunpodClient)
+
+// WithHTTPClient sends requests with client, under its own timeout unless
+// WithTimeout follows.
+func WithHTTPClient(client *http.Client) RunpodClientOption {
+	return func(c *RunpodClient) {
+		c.httpClient = client
+	}
+}
+
+func WithBaseURL(baseURL string) RunpodClientOption {
+	return func(c *RunpodClient) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithTimeout bounds each request, in place of the HTTP client's timeout.
+// Zero leaves requests bounded only by their context.
+func WithTimeout(timeout time.Duration) RunpodClientOption {
+	return func(c *RunpodClient) {
+		client := *c.httpClient
+		client.Timeout = timeout
+		c.httpClient = &client
+	}
 }
 
 var ErrMissingAPIKey = errors.New("no runpod api key provided")
 
-func NewRunpodClient(RunpodAPIKey string) (*RunpodClient, error) {
+func NewRunpodClient(RunpodAPIKey string, options ...RunpodClientOption) (*RunpodClient, error) {
 	if RunpodAPIKey == "" {
 		return nil, ErrMissingAPIKey
 	}
-	return &RunpodClient{
+	c := &RunpodClient{
 		RunpodAPIKey: RunpodAPIKey,
-	}, nil
+		httpClient:   &http.Client{Timeout: DefaultTimeout},
+		baseURL:      DefaultBaseURL,
+		retries:      DefaultRetries,
+		backoff:      DefaultBackoff,
+		maxBackoff:   DefaultMaxBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// endpointURL returns the URL of an endpoint given its URL or its ID.
+func (c *RunpodClient) endpointURL(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+	return c.baseURL + "/" + endpoint
 }
 
 func (c *RunpodClient) Run(workerURL string, runRequest RunRequest) (*AsyncRunResponse, error) {
+	return c.RunContext(context.Background(), workerURL, runRequest)
+}
+
+func (c *RunpodClient) RunContext(ctx context.Context, workerURL string, runRequest RunRequest) (*AsyncRunResponse, error) {
 	jsonData, err := json.Marshal(runRequest)
 	slog.Info("Running job", "workerURL", workerURL, "jsonData", jsonData)
 	if err != nil {
 		slog.Error("Error marshalling run request", "error", err)
 		return nil, err
 	}
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/run", workerURL), bytes.NewBuffer(jsonData))
-	if err != nil {
-		slog.Error("Error creating run request", "error", err)
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.RunpodAPIKey))
-
-	resp, err := http.DefaultClient.Do(req)
+	body, err := c.do(ctx, "POST", fmt.Sprintf("%s/run", c.endpointURL(workerURL)), jsonData, retryRejected)
 	if err != nil {
 		slog.Error("Error running job", "error", err)
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Error("Error reading run response", "error", err)
-		return nil, err
-	}
 
 	var runResponse AsyncRunResponse
 	err = json.Unmarshal(body, &runResponse)
@@ -117,6 +184,10 @@ func (c *RunpodClient) Run(workerURL string, runRequest RunRequest) (*AsyncRunRe
 }
 
 func (c *RunpodClient) RunSync(workerURL string, runRequest RunRequest) (*SyncRunResponse, error) {
+	return c.RunSyncContext(context.Background(), workerURL, runRequest)
+}
+
+func (c *RunpodClient) RunSyncContext(ctx context.Context, workerURL string, runRequest RunRequest) (*SyncRunResponse, error) {
 	slog.Info("Running job synchronously", "workerURL", workerURL)
 	jsonData, err := json.Marshal(runRequest)
 	if err != nil {
@@ -124,26 +195,11 @@ func (c *RunpodClient) RunSync(workerURL string, runRequest RunRequest) (*SyncRu
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/runsync", workerURL), bytes.NewBuffer(jsonData))
-	if err != nil {
-		slog.Error("Error creating run request", "error", err)
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.RunpodAPIKey))
-
-	resp, err := http.DefaultClient.Do(req)
+	body, err := c.do(ctx, "POST", fmt.Sprintf("%s/runsync", c.endpointURL(workerURL)), jsonData, retryRejected)
 	if err != nil {
 		slog.Error("Error running job", "error", err)
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Error("Error reading run response", "error", err)
-		return nil, err
-	}
 
 	var runResponse SyncRunResponse
 	err = json.Unmarshal(body, &runResponse)
@@ -157,15 +213,51 @@ func (c *RunpodClient) RunSync(workerURL string, runRequest RunRequest) (*SyncRu
 	return &runResponse, nil
 }
 
-// func Stream(workerURL string, jobId string) (string, error) {
+// StreamOutput is one of the outputs a job has yielded.
+type StreamOutput struct {
+	Output json.RawMessage `json:"output"`
+}
+
+type StreamResponse struct {
+	Status string         `json:"status"`
+	Stream []StreamOutput `json:"stream"`
+	Error  string         `json:"error,omitempty"`
+}
+
+func (c *RunpodClient) Stream(workerURL string, jobId string) (*StreamResponse, error) {
+	return c.StreamContext(context.Background(), workerURL, jobId)
+}
 
-// }
+// StreamContext returns the outputs a job's worker has yielded since the
+// last call, for workers whose handlers are generators. RunPod hands each
+// output out once, so a request that fails after RunPod answered loses them.
+func (c *RunpodClient) StreamContext(ctx context.Context, workerURL string, jobId string) (*StreamResponse, error) {
+	slog.Info("Streaming job", "workerURL", workerURL, "jobId", jobId)
+	body, err := c.do(ctx, "GET", fmt.Sprintf("%s/stream/%s", c.endpointURL(workerURL), jobId), nil, retryRejected)
+	if err != nil {
+		slog.Error("Error streaming job", "error", err)
+		return nil, err
+	}
+
+	var streamResponse StreamResponse
+	err = json.Unmarshal(body, &streamResponse)
+	if err != nil {
+		slog.Error("Error unmarshalling stream response", "error", err)
+		return nil, err
+	}
+	if streamResponse.Status == "" {
+		return nil, ErrEmtpyStatus
+	}
+
+	return &streamResponse, nil
+}
 
 type BaseStatusResponse struct {
 	DelayTime     int    `json:"delayTime,omitempty"`
 	ExecutionTime int    `json:"executionTime,omitempty"`
 	JobId         string `json:"id"`
 	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
 }
 
 type StatusResponse struct {
@@ -176,26 +268,16 @@ type StatusResponse struct {
 var ErrEmtpyStatus = errors.New("empty status received")
 
 func (c *RunpodClient) Status(workerURL string, jobId string) (*StatusResponse, error) {
-	slog.Info("Getting status", "workerURL", workerURL, "jobId", jobId)
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/status/%s", workerURL, jobId), nil)
-	if err != nil {
-		slog.Error("Error creating status request", "error", err)
-		return nil, err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.RunpodAPIKey))
+	return c.StatusContext(context.Background(), workerURL, jobId)
+}
 
-	resp, err := http.DefaultClient.Do(req)
+func (c *RunpodClient) StatusContext(ctx context.Context, workerURL string, jobId string) (*StatusResponse, error) {
+	slog.Info("Getting status", "workerURL", workerURL, "jobId", jobId)
+	body, err := c.do(ctx, "GET", fmt.Sprintf("%s/status/%s", c.endpointURL(workerURL), jobId), nil, retryIdempotent)
 	if err != nil {
 		slog.Error("Error getting status", "error", err)
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Error("Error reading status response", "error", err)
-		return nil, err
-	}
 
 	var statusResponse StatusResponse
 	err = json.Unmarshal(body, &statusResponse)
@@ -226,26 +308,16 @@ type CancelResponse struct {
 }
 
 func (c *RunpodClient) Cancel(workerURL string, jobId string) (*CancelResponse, error) {
-	slog.Info("Cancelling job", "workerURL", workerURL, "jobId", jobId)
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/cancel/%s", workerURL, jobId), nil)
-	if err != nil {
-		slog.Error("Error creating cancel request", "error", err)
-		return nil, err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.RunpodAPIKey))
+	return c.CancelContext(context.Background(), workerURL, jobId)
+}
 
-	resp, err := http.DefaultClient.Do(req)
+func (c *RunpodClient) CancelContext(ctx context.Context, workerURL string, jobId string) (*CancelResponse, error) {
+	slog.Info("Cancelling job", "workerURL", workerURL, "jobId", jobId)
+	body, err := c.do(ctx, "POST", fmt.Sprintf("%s/cancel/%s", c.endpointURL(workerURL), jobId), nil, retryIdempotent)
 	if err != nil {
 		slog.Error("Error cancelling job", "error", err)
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Error("Error reading cancel response", "error", err)
-		return nil, err
-	}
 
 	var cancelResponse CancelResponse
 	err = json.Unmarshal(body, &cancelResponse)
@@ -278,25 +350,16 @@ type HealthCheckResponse struct {
 }
 
 func (c *RunpodClient) HealthCheck(workerURL string) (*HealthCheckResponse, error) {
-	slog.Info("Checking health", "workerURL", workerURL)
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/health", workerURL), nil)
-	if err != nil {
-		slog.Error("Error creating health check request", "error", err)
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.RunpodAPIKey))
+	return c.HealthCheckContext(context.Background(), workerURL)
+}
 
-	resp, err := http.DefaultClient.Do(req)
+func (c *RunpodClient) HealthCheckContext(ctx context.Context, workerURL string) (*HealthCheckResponse, error) {
+	slog.Info("Checking health", "workerURL", workerURL)
+	body, err := c.do(ctx, "GET", fmt.Sprintf("%s/health", c.endpointURL(workerURL)), nil, retryIdempotent)
 	if err != nil {
 		slog.Error("Error checking health", "error", err)
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Error("Error reading health response", "error", err)
-		return nil, err
-	}
 
 	var healthCheckResponse HealthCheckResponse
 	err = json.Unmarshal(body, &healthCheckResponse)
@@ -316,23 +379,14 @@ type PurgeQueueResponse struct {
 }
 
 func (c *RunpodClient) PurgeQueue(workerURL string) (*PurgeQueueResponse, error) {
-	slog.Info("Purging queue", "workerURL", workerURL)
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/purge-queue", workerURL), nil)
-	if err != nil {
-		slog.Error("Error creating purge queue request", "error", err)
-		return nil, err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.RunpodAPIKey))
+	return c.PurgeQueueContext(context.Background(), workerURL)
+}
 
-	resp, err := http.DefaultClient.Do(req)
+func (c *RunpodClient) PurgeQueueContext(ctx context.Context, workerURL string) (*PurgeQueueResponse, error) {
+	slog.Info("Purging queue", "workerURL", workerURL)
+	body, err := c.do(ctx, "POST", fmt.Sprintf("%s/purge-queue", c.endpointURL(workerURL)), nil, retryRejected)
 	if err != nil {
 		slog.Error("Error purging queue", "error", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Error("Error reading purge queue response", "error", err)
 		return nil, err
 	}
 
@@ -0,0 +1,296 @@
+package s3store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// GetStore returns an S3Store configured from the environment:
+//   - S3_ENDPOINT: host[:port] of the S3 API, e.g. s3.amazonaws.com or localhost:9000 for MinIO
+//   - S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY
+//   - S3_REGION: optional, detected from the bucket if unset
+//   - S3_USE_SSL: defaults to true
+var GetStore = sync.OnceValues(func() (*S3Store, error) {
+	useSSL := true
+	if value := os.Getenv("S3_USE_SSL"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_USE_SSL: %v", err)
+		}
+		useSSL = parsed
+	}
+
+	return NewS3Store(Config{
+		Endpoint:        utils.GetEnvAssert("S3_ENDPOINT"),
+		Bucket:          utils.GetEnvAssert("S3_BUCKET"),
+		AccessKeyID:     utils.GetEnvAssert("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: utils.GetEnvAssert("S3_SECRET_ACCESS_KEY"),
+		Region:          os.Getenv("S3_REGION"),
+		UseSSL:          useSSL,
+	})
+})
+
+type Config struct {
+	Endpoint        string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+	UseSSL          bool
+}
+
+// S3Store is an objectstore.ObjectStore backed by an S3-compatible bucket.
+// Presigned URLs use SigV4, and multipart uploads use the native S3
+// multipart API rather than composing part objects.
+type S3Store struct {
+	client *minio.Client
+	core   *minio.Core
+	bucket string
+}
+
+var (
+	_ objectstore.MultipartStore    = (*S3Store)(nil)
+	_ objectstore.ChecksumPresigner = (*S3Store)(nil)
+)
+
+func NewS3Store(config Config) (*S3Store, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Store{
+		client: client,
+		core:   &minio.Core{Client: client},
+		bucket: config.Bucket,
+	}, nil
+}
+
+func isNotExist(err error) bool {
+	resp := minio.ToErrorResponse(err)
+	return resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound
+}
+
+func (s *S3Store) PresignPut(ctx context.Context, key string, duration time.Duration) (string, error) {
+	u, err := s.client.PresignedPutObject(ctx, s.bucket, key, duration)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *S3Store) PresignGet(ctx context.Context, key string, duration time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, duration, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// checksumHeaders returns the headers that make S3 reject an upload unless
+// it matches checksum.
+func checksumHeaders(checksum objectstore.Checksum) http.Header {
+	headers := http.Header{}
+	if checksum.MD5 != "" {
+		headers.Set("Content-MD5", checksum.MD5)
+	}
+	if checksum.CRC32C != "" {
+		headers.Set("X-Amz-Checksum-Crc32c", checksum.CRC32C)
+	}
+	return headers
+}
+
+func (s *S3Store) PresignPutChecksum(ctx context.Context, key string, duration time.Duration, checksum objectstore.Checksum) (string, http.Header, error) {
+	headers := checksumHeaders(checksum)
+	u, err := s.client.PresignHeader(ctx, http.MethodPut, s.bucket, key, duration, nil, headers)
+	if err != nil {
+		return "", nil, err
+	}
+	return u.String(), headers, nil
+}
+
+func toObjectAttrs(info minio.ObjectInfo) objectstore.ObjectAttrs {
+	// Objects completed from parts on stores without full object checksums
+	// have a checksum of the part checksums, suffixed with the number of
+	// parts, rather than a CRC32C of the content. Listed objects have no
+	// checksum.
+	crc32c := info.ChecksumCRC32C
+	if strings.Contains(crc32c, "-") {
+		crc32c = ""
+	}
+	return objectstore.ObjectAttrs{
+		Key:         info.Key,
+		Size:        info.Size,
+		ContentType: info.ContentType,
+		Updated:     info.LastModified,
+		ETag:        info.ETag,
+		// The ETag of an object that was not uploaded in parts is its MD5.
+		Checksum: objectstore.Checksum{
+			MD5:    objectstore.MD5FromHex(strings.Trim(info.ETag, `"`)),
+			CRC32C: crc32c,
+		},
+	}
+}
+
+// Stat asks for the object's checksums, which S3 only returns when asked.
+func (s *S3Store) Stat(ctx context.Context, key string) (*objectstore.ObjectAttrs, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{Checksum: true})
+	if isNotExist(err) {
+		return nil, objectstore.ErrObjectNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := toObjectAttrs(info)
+	return &attrs, nil
+}
+
+func (s *S3Store) Compose(ctx context.Context, dst string, srcs []string) error {
+	destination := minio.CopyDestOptions{Bucket: s.bucket, Object: dst}
+
+	var sources []minio.CopySrcOptions
+	for _, src := range srcs {
+		sources = append(sources, minio.CopySrcOptions{Bucket: s.bucket, Object: src})
+	}
+
+	// A plain copy is cheaper than a multipart copy when there is nothing to
+	// concatenate.
+	if len(sources) == 1 {
+		_, err := s.client.CopyObject(ctx, destination, sources[0])
+		return err
+	}
+
+	_, err := s.client.ComposeObject(ctx, destination, sources...)
+	return err
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]objectstore.ObjectAttrs, error) {
+	var objects []objectstore.ObjectAttrs
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		objects = append(objects, toObjectAttrs(info))
+	}
+
+	return objects, nil
+}
+
+// CreateMultipartUpload declares CRC32C as the upload's checksum algorithm,
+// so that S3 keeps the CRC32C each part is uploaded with, and asks for a full
+// object checksum, so that the completed object has the CRC32C of its
+// content.
+func (s *S3Store) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	return s.core.NewMultipartUpload(ctx, s.bucket, key, minio.PutObjectOptions{
+		UserMetadata: map[string]string{
+			"X-Amz-Checksum-Algorithm": minio.ChecksumCRC32C.String(),
+			"X-Amz-Checksum-Type":      "FULL_OBJECT",
+		},
+	})
+}
+
+// S3 part numbers start at 1, ours start at 0.
+func s3PartNumber(partNumber int) int {
+	return partNumber + 1
+}
+
+func (s *S3Store) PresignUploadPart(ctx context.Context, key string, uploadID string, partNumber int, duration time.Duration, checksum objectstore.Checksum) (string, http.Header, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(s3PartNumber(partNumber)))
+	params.Set("uploadId", uploadID)
+
+	headers := checksumHeaders(checksum)
+	u, err := s.client.PresignHeader(ctx, http.MethodPut, s.bucket, key, duration, params, headers)
+	if err != nil {
+		return "", nil, err
+	}
+	return u.String(), headers, nil
+}
+
+func (s *S3Store) listParts(ctx context.Context, key string, uploadID string) (map[int]minio.ObjectPart, error) {
+	parts := make(map[int]minio.ObjectPart)
+	marker := 0
+	for {
+		result, err := s.core.ListObjectParts(ctx, s.bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.ObjectParts {
+			parts[part.PartNumber] = part
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (s *S3Store) ListParts(ctx context.Context, key string, uploadID string) ([]objectstore.Part, error) {
+	uploaded, err := s.listParts(ctx, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []objectstore.Part
+	for _, part := range uploaded {
+		etag := strings.Trim(part.ETag, `"`)
+		parts = append(parts, objectstore.Part{
+			PartNumber: part.PartNumber - 1,
+			Size:       part.Size,
+			ETag:       etag,
+			Checksum: objectstore.Checksum{
+				MD5:    objectstore.MD5FromHex(etag),
+				CRC32C: part.ChecksumCRC32C,
+			},
+		})
+	}
+	return parts, nil
+}
+
+func (s *S3Store) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts int) error {
+	uploaded, err := s.listParts(ctx, key, uploadID)
+	if err != nil {
+		return fmt.Errorf("failed to list parts: %v", err)
+	}
+
+	var completeParts []minio.CompletePart
+	for partNumber := 0; partNumber < parts; partNumber++ {
+		part, ok := uploaded[s3PartNumber(partNumber)]
+		if !ok {
+			return fmt.Errorf("part %d not found", partNumber)
+		}
+		completeParts = append(completeParts, minio.CompletePart{
+			PartNumber:     part.PartNumber,
+			ETag:           part.ETag,
+			ChecksumCRC32C: part.ChecksumCRC32C,
+		})
+	}
+
+	_, err = s.core.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, completeParts, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *S3Store) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	return s.core.AbortMultipartUpload(ctx, s.bucket, key, uploadID)
+}
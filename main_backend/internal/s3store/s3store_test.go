@@ -0,0 +1,365 @@
+package s3store_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/s3store"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+const PRESIGNED_URL_DURATION = 5 * time.Minute
+
+const testBucket = "test-bucket"
+
+// newTestStore returns a store talking to an in-memory S3 stand-in.
+func newTestStore(t *testing.T) *s3store.S3Store {
+	return newTestStoreWithHandler(t, func(handler http.Handler) http.Handler {
+		return handler
+	})
+}
+
+// newTestStoreWithHandler returns a store talking to an in-memory S3
+// stand-in behind the handler returned by wrap.
+func newTestStoreWithHandler(t *testing.T, wrap func(http.Handler) http.Handler) *s3store.S3Store {
+	backend := s3mem.New()
+	err := backend.CreateBucket(testBucket)
+	if err != nil {
+		t.Fatalf("Failed to create bucket: %v", err)
+	}
+	server := httptest.NewServer(wrap(gofakes3.New(backend).Server()))
+	t.Cleanup(server.Close)
+
+	store, err := s3store.NewS3Store(s3store.Config{
+		Endpoint:        strings.TrimPrefix(server.URL, "http://"),
+		Bucket:          testBucket,
+		AccessKeyID:     "test-access-key",
+		SecretAccessKey: "test-secret-key",
+		Region:          "us-east-1",
+		UseSSL:          false,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create s3 store: %v", err)
+	}
+
+	return store
+}
+
+func put(t *testing.T, url string, content []byte) *http.Response {
+	return putHeaders(t, url, nil, content)
+}
+
+func putHeaders(t *testing.T, url string, headers http.Header, content []byte) *http.Response {
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func get(t *testing.T, url string) []byte {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Failed to download: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Download failed with status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response body: %v", err)
+	}
+	return body
+}
+
+func TestPresignUploadDownload(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	key := "test-file.txt"
+	testContent := []byte("This is a test file content")
+
+	_, err := store.Stat(ctx, key)
+	if !errors.Is(err, objectstore.ErrObjectNotExist) {
+		t.Fatalf("Expected ErrObjectNotExist before upload, got %v", err)
+	}
+
+	uploadURL, err := store.PresignPut(ctx, key, PRESIGNED_URL_DURATION)
+	if err != nil {
+		t.Fatalf("Failed to generate presigned upload URL: %v", err)
+	}
+	if !strings.Contains(uploadURL, "X-Amz-Signature=") {
+		t.Fatalf("Expected a SigV4 presigned URL, got %s", uploadURL)
+	}
+	resp := put(t, uploadURL, testContent)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Upload failed with status code: %d", resp.StatusCode)
+	}
+
+	attrs, err := store.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Failed to stat object: %v", err)
+	}
+	if attrs.Size != int64(len(testContent)) {
+		t.Fatalf("Unexpected object size. Expected: %d, Got: %d", len(testContent), attrs.Size)
+	}
+
+	downloadURL, err := store.PresignGet(ctx, key, PRESIGNED_URL_DURATION)
+	if err != nil {
+		t.Fatalf("Failed to generate presigned download URL: %v", err)
+	}
+	if body := get(t, downloadURL); !bytes.Equal(body, testContent) {
+		t.Fatalf("Downloaded content does not match. Expected: %s, Got: %s", testContent, body)
+	}
+
+	err = store.Delete(ctx, key)
+	if err != nil {
+		t.Fatalf("Failed to delete object: %v", err)
+	}
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+	if len(objects) != 0 {
+		t.Fatalf("Expected no objects after delete, got %v", objects)
+	}
+}
+
+func TestNativeMultipartUpload(t *testing.T) {
+	testCases := []struct {
+		name     string
+		numParts int
+		key      string
+	}{
+		{"SinglePart", 1, "gettysburg.wav"},
+		{"ThreeParts", 3, "gettysburg.wav"},
+		{"RenamedOnComplete", 3, "renamed.wav"},
+	}
+
+	fileContent, err := os.ReadFile("../../resources/gettysburg.wav")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newTestStore(t)
+
+			uploadID, err := objectstore.StartMultipartUpload(ctx, store, "gettysburg.wav")
+			if err != nil {
+				t.Fatalf("Failed to start multipart upload: %v", err)
+			}
+
+			partSize := len(fileContent) / tc.numParts
+			for i := 0; i < tc.numParts; i++ {
+				start := i * partSize
+				end := (i + 1) * partSize
+				if i == tc.numParts-1 {
+					end = len(fileContent)
+				}
+
+				partURL, err := objectstore.GetUploadPartURL(ctx, store, uploadID, i, PRESIGNED_URL_DURATION)
+				if err != nil {
+					t.Fatalf("Failed to get upload URL for part %d: %v", i, err)
+				}
+				resp := put(t, partURL, fileContent[start:end])
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("Upload of part %d failed with status code: %d", i, resp.StatusCode)
+				}
+			}
+
+			err = objectstore.CompleteMultipartUpload(ctx, store, tc.key, uploadID, tc.numParts)
+			if err != nil {
+				t.Fatalf("Failed to complete multipart upload: %v", err)
+			}
+
+			objects, err := store.List(ctx, "")
+			if err != nil {
+				t.Fatalf("Failed to list objects: %v", err)
+			}
+			if len(objects) != 1 || objects[0].Key != tc.key {
+				t.Fatalf("Expected only %s to exist, got %v", tc.key, objects)
+			}
+
+			downloadURL, err := store.PresignGet(ctx, tc.key, PRESIGNED_URL_DURATION)
+			if err != nil {
+				t.Fatalf("Failed to get download URL: %v", err)
+			}
+			if !bytes.Equal(get(t, downloadURL), fileContent) {
+				t.Fatalf("Downloaded content does not match original file")
+			}
+		})
+	}
+}
+
+func TestNativeMultipartUploadMissingPart(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	uploadID, err := objectstore.StartMultipartUpload(ctx, store, "incomplete.wav")
+	if err != nil {
+		t.Fatalf("Failed to start multipart upload: %v", err)
+	}
+
+	partURL, err := objectstore.GetUploadPartURL(ctx, store, uploadID, 0, PRESIGNED_URL_DURATION)
+	if err != nil {
+		t.Fatalf("Failed to get upload URL: %v", err)
+	}
+	put(t, partURL, []byte("only the first part"))
+
+	err = objectstore.CompleteMultipartUpload(ctx, store, "incomplete.wav", uploadID, 2)
+	if err == nil {
+		t.Fatalf("Expected completing an upload with a missing part to fail")
+	}
+
+	_, err = objectstore.GetUploadPartURL(ctx, store, "not-a-native-upload-id", 0, PRESIGNED_URL_DURATION)
+	if !errors.Is(err, objectstore.ErrInvalidUploadID) {
+		t.Fatalf("Expected ErrInvalidUploadID, got %v", err)
+	}
+}
+
+func TestListUploadedParts(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	uploadID, err := objectstore.StartMultipartUpload(ctx, store, "resumed.wav")
+	if err != nil {
+		t.Fatalf("Failed to start multipart upload: %v", err)
+	}
+
+	parts, err := objectstore.ListUploadedParts(ctx, store, uploadID)
+	if err != nil {
+		t.Fatalf("Failed to list parts: %v", err)
+	}
+	if len(parts) != 0 {
+		t.Fatalf("Expected no parts before uploading, got %v", parts)
+	}
+
+	contents := map[int][]byte{
+		2: []byte("the third part"),
+		0: []byte("the first"),
+	}
+	for _, partNumber := range []int{2, 0} {
+		partURL, err := objectstore.GetUploadPartURL(ctx, store, uploadID, partNumber, PRESIGNED_URL_DURATION)
+		if err != nil {
+			t.Fatalf("Failed to get upload URL for part %d: %v", partNumber, err)
+		}
+		resp := put(t, partURL, contents[partNumber])
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Upload of part %d failed with status code: %d", partNumber, resp.StatusCode)
+		}
+	}
+
+	parts, err = objectstore.ListUploadedParts(ctx, store, uploadID)
+	if err != nil {
+		t.Fatalf("Failed to list parts: %v", err)
+	}
+	if len(parts) != 2 || parts[0].PartNumber != 0 || parts[1].PartNumber != 2 {
+		t.Fatalf("Expected parts 0 and 2 in order, got %v", parts)
+	}
+	for _, part := range parts {
+		if part.Size != int64(len(contents[part.PartNumber])) {
+			t.Errorf("Expected part %d to have size %d, got %d", part.PartNumber, len(contents[part.PartNumber]), part.Size)
+		}
+		if part.ETag == "" {
+			t.Errorf("Expected part %d to have an ETag", part.PartNumber)
+		}
+	}
+}
+
+func TestChecksumUploadPart(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	content := []byte("the only part")
+
+	uploadID, err := objectstore.StartMultipartUpload(ctx, store, "checked.wav")
+	if err != nil {
+		t.Fatalf("Failed to start multipart upload: %v", err)
+	}
+
+	checksum, _, err := objectstore.ComputeChecksum(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to compute checksum: %v", err)
+	}
+	partURL, headers, err := objectstore.GetUploadPartURLWithChecksum(ctx, store, uploadID, 0, PRESIGNED_URL_DURATION, checksum)
+	if err != nil {
+		t.Fatalf("Failed to get upload URL: %v", err)
+	}
+	if headers.Get("Content-MD5") != checksum.MD5 || headers.Get("X-Amz-Checksum-Crc32c") != checksum.CRC32C {
+		t.Fatalf("Expected checksum headers for %+v, got %v", checksum, headers)
+	}
+
+	resp := putHeaders(t, partURL, headers, []byte("the only pawt"))
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("Expected corrupted part to be rejected")
+	}
+	resp = putHeaders(t, partURL, headers, content)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Upload failed with status code: %d", resp.StatusCode)
+	}
+
+	parts, err := objectstore.ListUploadedParts(ctx, store, uploadID)
+	if err != nil {
+		t.Fatalf("Failed to list parts: %v", err)
+	}
+	if len(parts) != 1 || parts[0].Checksum.MD5 != checksum.MD5 {
+		t.Fatalf("Expected one part with md5 %s, got %+v", checksum.MD5, parts)
+	}
+
+	err = objectstore.CompleteMultipartUpload(ctx, store, "checked.wav", uploadID, 1)
+	if err != nil {
+		t.Fatalf("Failed to complete multipart upload: %v", err)
+	}
+}
+
+func TestChecksumHeaders(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	requests := make(map[string]http.Header)
+	store := newTestStoreWithHandler(t, func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[r.Method] = r.Header.Clone()
+			mu.Unlock()
+			handler.ServeHTTP(w, r)
+		})
+	})
+
+	_, err := store.CreateMultipartUpload(ctx, "uploads/file.bin")
+	if err != nil {
+		t.Fatalf("Failed to create multipart upload: %v", err)
+	}
+	_, err = store.Stat(ctx, "uploads/file.bin")
+	if !errors.Is(err, objectstore.ErrObjectNotExist) {
+		t.Fatalf("Expected ErrObjectNotExist, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := requests[http.MethodPost].Get("X-Amz-Checksum-Type"); got != "FULL_OBJECT" {
+		t.Errorf("Expected multipart uploads to ask for full object checksums, got %q", got)
+	}
+	if got := requests[http.MethodHead].Get("X-Amz-Checksum-Mode"); got != "ENABLED" {
+		t.Errorf("Expected Stat to ask for checksums, got %q", got)
+	}
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/gcloud"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/localstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/s3store"
+)
+
+const (
+	BackendGCS   = "gcs"
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// GetObjectStore returns the object store selected by STORAGE_BACKEND.
+// Defaults to GCS.
+var GetObjectStore = sync.OnceValues(func() (objectstore.ObjectStore, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", BackendGCS:
+		store, err := gcloud.GetStore()
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case BackendLocal:
+		store, err := localstore.GetStore()
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case BackendS3:
+		store, err := s3store.GetStore()
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", backend)
+	}
+})
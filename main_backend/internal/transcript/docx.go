@@ -0,0 +1,90 @@
+package transcript
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+// A DOCX file is a zip archive of WordprocessingML parts. These are the
+// minimum parts Word needs to open a document.
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+</Types>`
+
+const docxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+</Relationships>`
+
+const docxDocumentStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`
+
+const docxDocumentEnd = `</w:body></w:document>`
+
+func renderDOCX(w io.Writer, output *whisper.WhisperOutput) error {
+	zw := zip.NewWriter(w)
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxRels},
+	}
+	for _, part := range parts {
+		pw, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(pw, part.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	var document strings.Builder
+	document.WriteString(docxDocumentStart)
+	if len(output.Segments) == 0 {
+		writeDOCXParagraph(&document, "", strings.TrimSpace(output.Transcription))
+	}
+	for _, segment := range output.Segments {
+		prefix := "[" + formatClock(segment.Start) + "] "
+		if segment.Speaker != "" {
+			prefix += segment.Speaker + ": "
+		}
+		writeDOCXParagraph(&document, prefix, segmentText(segment))
+	}
+	document.WriteString(docxDocumentEnd)
+
+	dw, err := zw.Create("word/document.xml")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(dw, document.String())
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// writeDOCXParagraph writes a paragraph with an optional bold prefix.
+func writeDOCXParagraph(document *strings.Builder, prefix string, text string) {
+	document.WriteString("<w:p>")
+	if prefix != "" {
+		document.WriteString(`<w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">`)
+		xml.EscapeText(document, []byte(prefix))
+		document.WriteString("</w:t></w:r>")
+	}
+	document.WriteString(`<w:r><w:t xml:space="preserve">`)
+	xml.EscapeText(document, []byte(text))
+	document.WriteString("</w:t></w:r></w:p>")
+}
@@ -0,0 +1,154 @@
+// Package transcript renders transcription results into downloadable formats.
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+const (
+	FormatSRT      = "srt"
+	FormatVTT      = "vtt"
+	FormatTXT      = "txt"
+	FormatJSON     = "json"
+	FormatDOCX     = "docx"
+	FormatMarkdown = "md"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported transcript format")
+
+var contentTypes = map[string]string{
+	FormatSRT:      "application/x-subrip; charset=utf-8",
+	FormatVTT:      "text/vtt; charset=utf-8",
+	FormatTXT:      "text/plain; charset=utf-8",
+	FormatJSON:     "application/json",
+	FormatDOCX:     "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	FormatMarkdown: "text/markdown; charset=utf-8",
+}
+
+// ContentType returns the MIME type of format, or ErrUnsupportedFormat.
+func ContentType(format string) (string, error) {
+	contentType, ok := contentTypes[format]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+	return contentType, nil
+}
+
+// Render writes output to w in the given format.
+func Render(w io.Writer, format string, output *whisper.WhisperOutput) error {
+	switch format {
+	case FormatSRT:
+		return renderSRT(w, output)
+	case FormatVTT:
+		return renderVTT(w, output)
+	case FormatTXT:
+		return renderTXT(w, output)
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	case FormatDOCX:
+		return renderDOCX(w, output)
+	case FormatMarkdown:
+		return renderMarkdown(w, output)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+}
+
+// splitTimestamp splits seconds into hours, minutes, seconds and milliseconds.
+func splitTimestamp(seconds float64) (h, m, s, ms int64) {
+	total := int64(math.Round(math.Max(seconds, 0) * 1000))
+	return total / 3_600_000, total / 60_000 % 60, total / 1000 % 60, total % 1000
+}
+
+// formatTimestamp formats seconds as HH:MM:SS<sep>mmm, as used by subtitles.
+func formatTimestamp(seconds float64, sep string) string {
+	h, m, s, ms := splitTimestamp(seconds)
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, s, sep, ms)
+}
+
+// formatClock formats seconds as HH:MM:SS, as used by text transcripts.
+func formatClock(seconds float64) string {
+	h, m, s, _ := splitTimestamp(seconds)
+	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+}
+
+// segmentText returns the text of segment on a single line.
+func segmentText(segment whisper.Segment) string {
+	return strings.Join(strings.Fields(segment.Text), " ")
+}
+
+// speakerText returns the text of segment prefixed by its speaker, if any.
+func speakerText(segment whisper.Segment) string {
+	if segment.Speaker == "" {
+		return segmentText(segment)
+	}
+	return segment.Speaker + ": " + segmentText(segment)
+}
+
+func renderSRT(w io.Writer, output *whisper.WhisperOutput) error {
+	bw := bufio.NewWriter(w)
+	for i, segment := range output.Segments {
+		fmt.Fprintf(bw, "%d\n%s --> %s\n%s\n\n", i+1,
+			formatTimestamp(segment.Start, ","), formatTimestamp(segment.End, ","), speakerText(segment))
+	}
+	return bw.Flush()
+}
+
+// vttEscaper escapes characters that would otherwise be read as cue markup.
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func renderVTT(w io.Writer, output *whisper.WhisperOutput) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n\n")
+	for _, segment := range output.Segments {
+		text := vttEscaper.Replace(segmentText(segment))
+		if segment.Speaker != "" {
+			text = "<v " + vttEscaper.Replace(segment.Speaker) + ">" + text
+		}
+		fmt.Fprintf(bw, "%s --> %s\n%s\n\n",
+			formatTimestamp(segment.Start, "."), formatTimestamp(segment.End, "."), text)
+	}
+	return bw.Flush()
+}
+
+func renderTXT(w io.Writer, output *whisper.WhisperOutput) error {
+	bw := bufio.NewWriter(w)
+	if len(output.Segments) == 0 {
+		bw.WriteString(strings.TrimSpace(output.Transcription))
+		bw.WriteString("\n")
+	}
+	for _, segment := range output.Segments {
+		bw.WriteString(speakerText(segment))
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// markdownEscaper escapes characters that would otherwise be read as
+// markdown formatting in transcribed text.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, "#", `\#`,
+)
+
+func renderMarkdown(w io.Writer, output *whisper.WhisperOutput) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# Transcript\n\n")
+	if len(output.Segments) == 0 {
+		bw.WriteString(markdownEscaper.Replace(strings.TrimSpace(output.Transcription)))
+		bw.WriteString("\n")
+	}
+	for _, segment := range output.Segments {
+		fmt.Fprintf(bw, "**[%s]** %s\n\n", formatClock(segment.Start), markdownEscaper.Replace(speakerText(segment)))
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,139 @@
+package transcript_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/transcript"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+func testOutput() *whisper.WhisperOutput {
+	return &whisper.WhisperOutput{
+		Segments: []whisper.Segment{
+			{ID: 0, Start: 0, End: 2.5, Text: " Four score and seven years ago"},
+			{ID: 1, Start: 2.5, End: 3661.0456, Text: " our fathers brought forth <on> this continent"},
+		},
+		DetectedLanguage: "en",
+		Transcription:    "Four score and seven years ago our fathers brought forth <on> this continent",
+	}
+}
+
+func render(t *testing.T, format string) string {
+	var buf bytes.Buffer
+	err := transcript.Render(&buf, format, testOutput())
+	if err != nil {
+		t.Fatalf("Failed to render %s: %v", format, err)
+	}
+	return buf.String()
+}
+
+func TestRenderSRT(t *testing.T) {
+	expected := "1\n00:00:00,000 --> 00:00:02,500\nFour score and seven years ago\n\n" +
+		"2\n00:00:02,500 --> 01:01:01,046\nour fathers brought forth <on> this continent\n\n"
+	got := render(t, transcript.FormatSRT)
+	if got != expected {
+		t.Fatalf("Unexpected SRT:\n%s", got)
+	}
+}
+
+func TestRenderVTT(t *testing.T) {
+	expected := "WEBVTT\n\n" +
+		"00:00:00.000 --> 00:00:02.500\nFour score and seven years ago\n\n" +
+		"00:00:02.500 --> 01:01:01.046\nour fathers brought forth &lt;on&gt; this continent\n\n"
+	got := render(t, transcript.FormatVTT)
+	if got != expected {
+		t.Fatalf("Unexpected VTT:\n%s", got)
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	got := render(t, transcript.FormatTXT)
+	if got != "Four score and seven years ago\nour fathers brought forth <on> this continent\n" {
+		t.Fatalf("Unexpected text:\n%s", got)
+	}
+
+	got = render(t, transcript.FormatMarkdown)
+	if !strings.Contains(got, "**[00:00:00]** Four score and seven years ago\n\n") ||
+		!strings.Contains(got, "**[00:00:02]** our fathers brought forth \\<on> this continent\n\n") {
+		t.Fatalf("Unexpected markdown:\n%s", got)
+	}
+}
+
+func TestRenderSpeakers(t *testing.T) {
+	output := testOutput()
+	output.Segments[0].Speaker = "Abraham"
+	output.Segments[1].Speaker = "Edward"
+
+	expected := map[string]string{
+		transcript.FormatSRT:      "1\n00:00:00,000 --> 00:00:02,500\nAbraham: Four score and seven years ago\n\n",
+		transcript.FormatVTT:      "00:00:00.000 --> 00:00:02.500\n<v Abraham>Four score and seven years ago\n\n",
+		transcript.FormatTXT:      "Abraham: Four score and seven years ago\nEdward: our fathers",
+		transcript.FormatMarkdown: "**[00:00:02]** Edward: our fathers",
+	}
+	for format, want := range expected {
+		var buf bytes.Buffer
+		err := transcript.Render(&buf, format, output)
+		if err != nil {
+			t.Fatalf("Failed to render %s: %v", format, err)
+		}
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("Expected %s to contain %q, got:\n%s", format, want, buf.String())
+		}
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	var output whisper.WhisperOutput
+	err := json.Unmarshal([]byte(render(t, transcript.FormatJSON)), &output)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JSON transcript: %v", err)
+	}
+	if len(output.Segments) != 2 || output.Segments[1].End != 3661.0456 {
+		t.Fatalf("Unexpected JSON transcript: %+v", output)
+	}
+}
+
+func TestRenderDOCX(t *testing.T) {
+	docx := render(t, transcript.FormatDOCX)
+	zr, err := zip.NewReader(strings.NewReader(docx), int64(len(docx)))
+	if err != nil {
+		t.Fatalf("Failed to open DOCX: %v", err)
+	}
+
+	var document string
+	for _, file := range zr.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("Failed to open document.xml: %v", err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed to read document.xml: %v", err)
+		}
+		document = string(content)
+	}
+	if !strings.Contains(document, "our fathers brought forth &lt;on&gt; this continent") {
+		t.Fatalf("Unexpected document.xml:\n%s", document)
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	_, err := transcript.ContentType("pdf")
+	if !errors.Is(err, transcript.ErrUnsupportedFormat) {
+		t.Fatalf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+	err = transcript.Render(io.Discard, "pdf", testOutput())
+	if !errors.Is(err, transcript.ErrUnsupportedFormat) {
+		t.Fatalf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/chunking"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/storage"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+)
+
+const (
+	DefaultCollectInterval = time.Hour
+	DefaultMaxPartAge      = 24 * time.Hour
+)
+
+// Janitor reclaims the storage of abandoned uploads, and of the chunks long
+// recordings are split into for transcription once their jobs have finished.
+//
+// Uploads whose session expired before they were completed are aborted. For
+// stores without native multipart uploads, the part objects and intermediate
+// compose objects of closed sessions are deleted once they are older than the
+// maximum part age, which also catches objects left behind by failed deletes.
+// A session's objects are looked up by its upload ID, so objects of uploads
+// without a session are left alone.
+type Janitor struct {
+	objects  objectstore.ObjectStore
+	sessions Store
+	jobs     jobs.Store
+	interval time.Duration
+	maxAge   time.Duration
+	now      func() time.Time
+
+	// mu keeps scheduled and on-demand collections from overlapping.
+	mu sync.Mutex
+}
+
+// Report describes what a collection reclaimed.
+type Report struct {
+	// Sessions is the number of expired sessions that were aborted.
+	Sessions int `json:"sessions"`
+	// Parts and Bytes are the number and total size of part objects deleted.
+	Parts int   `json:"parts"`
+	Bytes int64 `json:"bytes"`
+	// Chunks is the number of chunk objects of finished jobs deleted.
+	Chunks int `json:"chunks"`
+	// Failed is the number of sessions or parts that could not be cleaned
+	// up. They are retried by the next collection.
+	Failed int `json:"failed"`
+}
+
+type JanitorOption func(*Janitor)
+
+// WithCollectInterval sets how often Run collects abandoned uploads.
+func WithCollectInterval(interval time.Duration) JanitorOption {
+	return func(j *Janitor) {
+		j.interval = interval
+	}
+}
+
+// WithMaxPartAge sets how old a part object must be to be collected.
+func WithMaxPartAge(maxAge time.Duration) JanitorOption {
+	return func(j *Janitor) {
+		j.maxAge = maxAge
+	}
+}
+
+// WithJobs lets the janitor delete the chunk objects of finished jobs in
+// store.
+func WithJobs(store jobs.Store) JanitorOption {
+	return func(j *Janitor) {
+		j.jobs = store
+	}
+}
+
+// WithJanitorClock sets the function used to get the current time.
+func WithJanitorClock(now func() time.Time) JanitorOption {
+	return func(j *Janitor) {
+		j.now = now
+	}
+}
+
+func NewJanitor(objects objectstore.ObjectStore, sessions Store, options ...JanitorOption) *Janitor {
+	j := &Janitor{
+		objects:  objects,
+		sessions: sessions,
+		interval: DefaultCollectInterval,
+		maxAge:   DefaultMaxPartAge,
+		now:      time.Now,
+	}
+	for _, option := range options {
+		option(j)
+	}
+	return j
+}
+
+// GetJanitor returns the janitor for the configured object store.
+// UPLOAD_GC_INTERVAL and UPLOAD_GC_MAX_AGE override the janitor defaults.
+var GetJanitor = sync.OnceValues(func() (*Janitor, error) {
+	objects, err := storage.GetObjectStore()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := GetStore()
+	if err != nil {
+		return nil, err
+	}
+	jobStore, err := jobs.GetStore()
+	if err != nil {
+		return nil, err
+	}
+	return NewJanitor(objects, sessions,
+		WithJobs(jobStore),
+		WithCollectInterval(utils.GetEnvDuration("UPLOAD_GC_INTERVAL", DefaultCollectInterval)),
+		WithMaxPartAge(utils.GetEnvDuration("UPLOAD_GC_MAX_AGE", DefaultMaxPartAge)),
+	), nil
+})
+
+// Run collects abandoned uploads until ctx is cancelled.
+func (j *Janitor) Run(ctx context.Context) {
+	slog.Info("Starting upload janitor", "interval", j.interval, "maxPartAge", j.maxAge)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := j.Collect(ctx)
+		if err != nil {
+			slog.Error("Failed to collect abandoned uploads", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping upload janitor")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect makes a single pass over abandoned uploads.
+func (j *Janitor) Collect(ctx context.Context) (*Report, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := j.now()
+	report := &Report{}
+
+	err := j.abortExpired(ctx, now, report)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := j.objects.(objectstore.MultipartStore); !ok {
+		err = j.deleteParts(ctx, now, report)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if j.jobs != nil {
+		err = j.deleteChunks(ctx, report)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Info("Collected abandoned uploads", "sessions", report.Sessions, "parts", report.Parts, "bytes", report.Bytes, "chunks", report.Chunks, "failed", report.Failed)
+	return report, nil
+}
+
+func (j *Janitor) abortExpired(ctx context.Context, now time.Time, report *Report) error {
+	expired, err := j.sessions.ListExpired(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range expired {
+		// The session is closed before its upload is aborted, so that it
+		// cannot be claimed by a request completing it in the meantime.
+		err := j.sessions.TransitionStatus(ctx, session.ID, StatusUploading, StatusAborted)
+		if errors.Is(err, ErrSessionClosed) {
+			continue
+		}
+		if err != nil {
+			slog.Error("Failed to mark upload session as aborted", "uploadID", session.ID, "error", err)
+			report.Failed++
+			continue
+		}
+		// Parts of emulated uploads are left for deleteParts, once they are
+		// old enough.
+		if _, ok := j.objects.(objectstore.MultipartStore); ok {
+			err := objectstore.AbortMultipartUpload(ctx, j.objects, session.ID)
+			if err != nil {
+				slog.Error("Failed to abort upload", "uploadID", session.ID, "error", err)
+				report.Failed++
+				// Reopen the session so that aborting it is retried.
+				err = j.sessions.TransitionStatus(ctx, session.ID, StatusAborted, StatusUploading)
+				if err != nil {
+					slog.Error("Failed to reopen upload session", "uploadID", session.ID, "error", err)
+				}
+				continue
+			}
+		}
+		report.Sessions++
+	}
+	return nil
+}
+
+// deleteParts deletes the objects of closed sessions that are old enough, and
+// marks the sessions as collected once none are left.
+func (j *Janitor) deleteParts(ctx context.Context, now time.Time, report *Report) error {
+	closed, err := j.sessions.ListUncollected(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range closed {
+		var objects []objectstore.ObjectAttrs
+		for _, prefix := range []string{session.ID + "-part", session.ID + "-compose"} {
+			found, err := j.objects.List(ctx, prefix)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, found...)
+		}
+
+		sizes := make(map[string]int64)
+		var keys []string
+		pending := false
+		for _, object := range objects {
+			uploadID, ok := objectstore.ParseUploadObjectKey(object.Key)
+			if !ok || uploadID != session.ID {
+				continue
+			}
+			if now.Sub(object.Updated) < j.maxAge {
+				pending = true
+				continue
+			}
+			keys = append(keys, object.Key)
+			sizes[object.Key] = object.Size
+		}
+
+		deleted, err := objectstore.DeleteObjects(ctx, j.objects, keys)
+		report.Parts += len(deleted)
+		for _, key := range deleted {
+			report.Bytes += sizes[key]
+		}
+		if err != nil {
+			slog.Error("Failed to delete parts", "uploadID", session.ID, "error", err)
+			report.Failed += len(keys) - len(deleted)
+			continue
+		}
+		if pending {
+			continue
+		}
+		err = j.sessions.MarkPartsCollected(ctx, session.ID)
+		if err != nil {
+			slog.Error("Failed to mark parts as collected", "uploadID", session.ID, "error", err)
+			report.Failed++
+		}
+	}
+	return nil
+}
+
+// deleteChunks deletes the chunk objects of parent jobs that have finished,
+// along with all of their children, so that no chunk is still being
+// transcribed.
+func (j *Janitor) deleteChunks(ctx context.Context, report *Report) error {
+	parents, err := j.jobs.ListFinishedParents(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, parent := range parents {
+		keys := make([]string, parent.Chunks)
+		for i := range keys {
+			keys[i] = chunking.ChunkKey(parent.UploadKey, parent.ID, i)
+		}
+		deleted, err := objectstore.DeleteObjects(ctx, j.objects, keys)
+		report.Chunks += len(deleted)
+		if err != nil {
+			slog.Error("Failed to delete chunks", "jobId", parent.ID, "error", err)
+			report.Failed += len(keys) - len(deleted)
+			continue
+		}
+		err = j.jobs.MarkChunksCollected(ctx, parent.ID)
+		if err != nil {
+			slog.Error("Failed to mark chunks as collected", "jobId", parent.ID, "error", err)
+			report.Failed++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package uploads_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/chunking"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/localstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/uploads"
+)
+
+func TestJanitorCollect(t *testing.T) {
+	ctx := context.Background()
+	sessions := newTestStore(t)
+	objects := localstore.NewTestStore(t)
+
+	now := time.Now()
+	const (
+		openID    = "00000000000000000000000000000001"
+		expiredID = "00000000000000000000000000000002"
+		orphanID  = "00000000000000000000000000000003"
+		doneID    = "00000000000000000000000000000004"
+		// Claimed by a request completing it just before it expired.
+		completingID = "00000000000000000000000000000005"
+	)
+	for _, session := range []*uploads.Session{
+		{ID: openID, Owner: "user-1", Status: uploads.StatusUploading, NumParts: 2, CreatedAt: now, ExpiresAt: now.Add(72 * time.Hour)},
+		{ID: expiredID, Owner: "user-1", Status: uploads.StatusUploading, NumParts: 2, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: doneID, Owner: "user-1", Status: uploads.StatusComplete, NumParts: 40, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: completingID, Owner: "user-1", Status: uploads.StatusCompleting, NumParts: 1, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	} {
+		err := sessions.Create(ctx, session)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+
+	keys := []string{
+		openID + "-part0", openID + "-part1",
+		expiredID + "-part0", expiredID + "-part1",
+		orphanID + "-part0",
+		// Left behind by failed deletes after the upload was completed.
+		doneID + "-part39", doneID + "-compose0-0",
+		completingID + "-part0",
+		"users/user-1/meeting-part1",
+	}
+	for _, key := range keys {
+		err := objects.Write(key, strings.NewReader("0123456789"))
+		if err != nil {
+			t.Fatalf("Failed to write %s: %v", key, err)
+		}
+	}
+
+	// Too young to be collected, but the expired session is aborted anyway.
+	// Objects of uploads without a session are never collected.
+	janitor := uploads.NewJanitor(objects, sessions, uploads.WithMaxPartAge(24*time.Hour), uploads.WithJanitorClock(func() time.Time {
+		return now.Add(2 * time.Hour)
+	}))
+	report, err := janitor.Collect(ctx)
+	if err != nil {
+		t.Fatalf("Failed to collect: %v", err)
+	}
+	if report.Sessions != 1 || report.Parts != 0 {
+		t.Errorf("Expected 1 session and no parts to be collected, got %+v", report)
+	}
+	expired, err := sessions.Get(ctx, expiredID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if expired.Status != uploads.StatusAborted {
+		t.Errorf("Expected expired session to be %s, got %s", uploads.StatusAborted, expired.Status)
+	}
+	completing, err := sessions.Get(ctx, completingID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if completing.Status != uploads.StatusCompleting {
+		t.Errorf("Expected session being completed to stay %s, got %s", uploads.StatusCompleting, completing.Status)
+	}
+
+	janitor = uploads.NewJanitor(objects, sessions, uploads.WithMaxPartAge(24*time.Hour), uploads.WithJanitorClock(func() time.Time {
+		return now.Add(48 * time.Hour)
+	}))
+	report, err = janitor.Collect(ctx)
+	if err != nil {
+		t.Fatalf("Failed to collect: %v", err)
+	}
+	if report.Sessions != 0 || report.Parts != 4 || report.Bytes != 40 || report.Failed != 0 {
+		t.Errorf("Expected 4 parts of 40 bytes to be collected, got %+v", report)
+	}
+	uncollected, err := sessions.ListUncollected(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list uncollected sessions: %v", err)
+	}
+	if len(uncollected) != 0 {
+		t.Errorf("Expected all closed sessions to be collected, got %+v", uncollected)
+	}
+
+	remaining, err := objects.List(ctx, "")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+	var remainingKeys []string
+	for _, object := range remaining {
+		remainingKeys = append(remainingKeys, object.Key)
+	}
+	expected := []string{openID + "-part0", openID + "-part1", orphanID + "-part0", completingID + "-part0", "users/user-1/meeting-part1"}
+	if strings.Join(remainingKeys, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v to remain, got %v", expected, remainingKeys)
+	}
+}
+
+func TestJanitorCollectChunks(t *testing.T) {
+	ctx := context.Background()
+	jobStore, err := jobs.NewSQLiteStore(database.OpenTest(t))
+	if err != nil {
+		t.Fatalf("Failed to create job store: %v", err)
+	}
+	objects := localstore.NewTestStore(t)
+
+	const key = "users/user-1/meeting.wav"
+	testJobs := []*jobs.Job{
+		{ID: "finished", UploadKey: key, Chunks: 2, Status: jobs.StatusComplete},
+		{ID: "finished-0", ParentID: "finished", UploadKey: chunking.ChunkKey(key, "finished", 0), Status: jobs.StatusComplete},
+		{ID: "finished-1", ParentID: "finished", UploadKey: chunking.ChunkKey(key, "finished", 1), Status: jobs.StatusComplete},
+		// Another job on the same recording is still running.
+		{ID: "running", UploadKey: key, Chunks: 2, Status: jobs.StatusProgress},
+		{ID: "running-0", ParentID: "running", UploadKey: chunking.ChunkKey(key, "running", 0), Status: jobs.StatusProgress},
+		{ID: "running-1", ParentID: "running", UploadKey: chunking.ChunkKey(key, "running", 1), Status: jobs.StatusProgress},
+		// A chunk of a failed job is still being transcribed.
+		{ID: "failed", UploadKey: "other.wav", Chunks: 2, Status: jobs.StatusFailed},
+		{ID: "failed-0", ParentID: "failed", UploadKey: chunking.ChunkKey("other.wav", "failed", 0), Status: jobs.StatusFailed},
+		{ID: "failed-1", ParentID: "failed", UploadKey: chunking.ChunkKey("other.wav", "failed", 1), Status: jobs.StatusProgress},
+	}
+	for _, job := range testJobs {
+		err := jobStore.Create(ctx, job)
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+	for _, key := range []string{key,
+		chunking.ChunkKey(key, "finished", 0), chunking.ChunkKey(key, "finished", 1),
+		chunking.ChunkKey(key, "running", 0), chunking.ChunkKey(key, "running", 1),
+		chunking.ChunkKey("other.wav", "failed", 0), chunking.ChunkKey("other.wav", "failed", 1),
+	} {
+		err := objects.Write(key, strings.NewReader("0123456789"))
+		if err != nil {
+			t.Fatalf("Failed to write %s: %v", key, err)
+		}
+	}
+
+	janitor := uploads.NewJanitor(objects, newTestStore(t), uploads.WithJobs(jobStore))
+	report, err := janitor.Collect(ctx)
+	if err != nil {
+		t.Fatalf("Failed to collect: %v", err)
+	}
+	if report.Chunks != 2 || report.Failed != 0 {
+		t.Errorf("Expected 2 chunks to be collected, got %+v", report)
+	}
+
+	remaining, err := objects.List(ctx, "")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+	var remainingKeys []string
+	for _, object := range remaining {
+		remainingKeys = append(remainingKeys, object.Key)
+	}
+	expected := []string{
+		chunking.ChunkKey("other.wav", "failed", 0), chunking.ChunkKey("other.wav", "failed", 1),
+		key, chunking.ChunkKey(key, "running", 0), chunking.ChunkKey(key, "running", 1),
+	}
+	if strings.Join(remainingKeys, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v to remain, got %v", expected, remainingKeys)
+	}
+
+	// Chunks are only collected once.
+	parents, err := jobStore.ListFinishedParents(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list finished parents: %v", err)
+	}
+	if len(parents) != 0 {
+		t.Errorf("Expected no parents left to collect, got %+v", parents)
+	}
+}
@@ -0,0 +1,256 @@
+package uploads
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/media"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+)
+
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS upload_sessions (
+	id              TEXT PRIMARY KEY,
+	owner           TEXT NOT NULL,
+	key             TEXT NOT NULL,
+	filename        TEXT NOT NULL,
+	file_size_bytes INTEGER NOT NULL,
+	num_parts       INTEGER NOT NULL,
+	status          TEXT NOT NULL,
+	created_at      INTEGER NOT NULL,
+	expires_at      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS upload_sessions_status_expires_at ON upload_sessions (status, expires_at);`,
+	`ALTER TABLE upload_sessions ADD COLUMN part_size_bytes INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE IF NOT EXISTS upload_parts (
+	upload_id   TEXT NOT NULL,
+	part_number INTEGER NOT NULL,
+	md5         TEXT NOT NULL,
+	crc32c      TEXT NOT NULL,
+	PRIMARY KEY (upload_id, part_number)
+);`,
+	`ALTER TABLE upload_sessions ADD COLUMN media TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS upload_sessions_key ON upload_sessions (key, status);`,
+	`ALTER TABLE upload_sessions ADD COLUMN parts_collected INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS upload_sessions_parts_collected ON upload_sessions (parts_collected, status);`,
+}
+
+// SQLiteStore is the default Store implementation.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	err := database.Migrate(db, "uploads", migrations)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, session *Session) error {
+	mediaJSON, err := marshalMedia(session.Media)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO upload_sessions (`+sessionColumns+`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.Owner, session.Key, session.Filename, session.FileSizeBytes, session.NumParts, session.Status,
+		session.CreatedAt.UnixMilli(), session.ExpiresAt.UnixMilli(), session.PartSizeBytes, mediaJSON)
+	return err
+}
+
+const sessionColumns = `id, owner, key, filename, file_size_bytes, num_parts, status, created_at, expires_at, part_size_bytes, media`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// marshalMedia stores a missing description as an empty string.
+func marshalMedia(info *media.Info) (string, error) {
+	if info == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal media info: %w", err)
+	}
+	return string(b), nil
+}
+
+func scanSession(row scanner) (*Session, error) {
+	var session Session
+	var createdAt, expiresAt int64
+	var mediaJSON string
+	err := row.Scan(&session.ID, &session.Owner, &session.Key, &session.Filename, &session.FileSizeBytes, &session.NumParts, &session.Status,
+		&createdAt, &expiresAt, &session.PartSizeBytes, &mediaJSON)
+	if err != nil {
+		return nil, err
+	}
+	session.CreatedAt = time.UnixMilli(createdAt)
+	session.ExpiresAt = time.UnixMilli(expiresAt)
+	if mediaJSON != "" {
+		err = json.Unmarshal([]byte(mediaJSON), &session.Media)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal media info: %w", err)
+		}
+	}
+	return &session, nil
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, id string) (*Session, error) {
+	session, err := scanSession(s.db.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM upload_sessions WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (s *SQLiteStore) GetCompleted(ctx context.Context, key string) (*Session, error) {
+	session, err := scanSession(s.db.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM upload_sessions WHERE key = ? AND status = ?
+ORDER BY created_at DESC LIMIT 1`, key, StatusComplete))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (s *SQLiteStore) ListExpired(ctx context.Context, now time.Time) ([]Session, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+sessionColumns+` FROM upload_sessions WHERE status = ? AND expires_at <= ? ORDER BY expires_at`,
+		StatusUploading, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLiteStore) ListUncollected(ctx context.Context) ([]Session, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+sessionColumns+` FROM upload_sessions WHERE parts_collected = 0 AND status NOT IN (?, ?) ORDER BY created_at`,
+		StatusUploading, StatusCompleting)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLiteStore) MarkPartsCollected(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE upload_sessions SET parts_collected = 1 WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) SetStatus(ctx context.Context, id string, status string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE upload_sessions SET status = ? WHERE id = ?`, status, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) TransitionStatus(ctx context.Context, id string, from string, to string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE upload_sessions SET status = ? WHERE id = ? AND status = ?`, to, id, from)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		_, err = s.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		return ErrSessionClosed
+	}
+	return nil
+}
+
+func (s *SQLiteStore) SetMedia(ctx context.Context, id string, info *media.Info) error {
+	mediaJSON, err := marshalMedia(info)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, `UPDATE upload_sessions SET media = ? WHERE id = ?`, mediaJSON, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) SetPartChecksum(ctx context.Context, id string, partNumber int, checksum objectstore.Checksum) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO upload_parts (upload_id, part_number, md5, crc32c) VALUES (?, ?, ?, ?)
+ON CONFLICT (upload_id, part_number) DO UPDATE SET md5 = excluded.md5, crc32c = excluded.crc32c`,
+		id, partNumber, checksum.MD5, checksum.CRC32C)
+	return err
+}
+
+func (s *SQLiteStore) ListPartChecksums(ctx context.Context, id string) (map[int]objectstore.Checksum, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT part_number, md5, crc32c FROM upload_parts WHERE upload_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checksums := make(map[int]objectstore.Checksum)
+	for rows.Next() {
+		var partNumber int
+		var checksum objectstore.Checksum
+		err := rows.Scan(&partNumber, &checksum.MD5, &checksum.CRC32C)
+		if err != nil {
+			return nil, err
+		}
+		checksums[partNumber] = checksum
+	}
+	return checksums, rows.Err()
+}
@@ -0,0 +1,166 @@
+// Package uploads tracks multipart upload sessions, so the upload routes can
+// check part numbers, owners and sizes against what was declared when the
+// upload was started.
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/media"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+)
+
+const DefaultSessionDuration = 24 * time.Hour
+
+const (
+	// DefaultPartSize is the size of the parts files are uploaded in, unless
+	// that would take more than objectstore.MaxParts parts.
+	DefaultPartSize = 64 * 1024 * 1024
+	// partSizeAlignment is what larger part sizes are rounded up to.
+	partSizeAlignment = 1024 * 1024
+)
+
+const (
+	StatusUploading = "UPLOADING"
+	// StatusCompleting is held by the request completing the upload, while
+	// its parts are composed and the result is verified.
+	StatusCompleting = "COMPLETING"
+	StatusComplete   = "COMPLETED"
+	StatusAborted    = "ABORTED"
+)
+
+var (
+	ErrSessionNotFound = errors.New("upload session not found")
+	ErrSessionExpired  = errors.New("upload session has expired")
+	ErrSessionClosed   = errors.New("upload session is already closed")
+	ErrInvalidPart     = errors.New("part number out of range")
+	ErrSizeMismatch    = errors.New("uploaded size does not match declared size")
+	ErrMissingPart     = errors.New("part has not been uploaded")
+)
+
+// Session is a multipart upload in progress. Its ID is the upload ID handed
+// to the client.
+type Session struct {
+	ID            string `json:"upload_id"`
+	Owner         string `json:"owner"`
+	Key           string `json:"key"`
+	Filename      string `json:"filename"`
+	FileSizeBytes int64  `json:"file_size_bytes"`
+	NumParts      int    `json:"num_parts"`
+	// Every part is PartSizeBytes long, except the last, which holds the
+	// rest of the file.
+	PartSizeBytes int64     `json:"part_size_bytes"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	// Media describes the uploaded file once the upload is complete.
+	Media *media.Info `json:"media,omitempty"`
+}
+
+// PlanParts returns the size of the parts a file should be uploaded in, and
+// how many there are. Parts are DefaultPartSize long, or larger if that is
+// needed to stay within objectstore.MaxParts.
+func PlanParts(fileSizeBytes int64) (numParts int, partSizeBytes int64) {
+	partSizeBytes = DefaultPartSize
+	if fileSizeBytes > partSizeBytes*objectstore.MaxParts {
+		partSizeBytes = ceilDiv(fileSizeBytes, objectstore.MaxParts)
+		partSizeBytes = ceilDiv(partSizeBytes, partSizeAlignment) * partSizeAlignment
+	}
+	return int(max(ceilDiv(fileSizeBytes, partSizeBytes), 1)), partSizeBytes
+}
+
+func ceilDiv(a int64, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+// CheckPart returns ErrInvalidPart unless partNumber is one of the session's
+// zero-based part numbers.
+func (s *Session) CheckPart(partNumber int) error {
+	if partNumber < 0 || partNumber >= s.NumParts {
+		return fmt.Errorf("%w: %d is not between 0 and %d", ErrInvalidPart, partNumber, s.NumParts-1)
+	}
+	return nil
+}
+
+// CheckSize returns ErrSizeMismatch unless size is the declared size.
+func (s *Session) CheckSize(size int64) error {
+	if size != s.FileSizeBytes {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrSizeMismatch, s.FileSizeBytes, size)
+	}
+	return nil
+}
+
+// Store persists upload sessions.
+type Store interface {
+	Create(ctx context.Context, session *Session) error
+	// Get returns ErrSessionNotFound if there is no session with the id.
+	Get(ctx context.Context, id string) (*Session, error)
+	// GetCompleted returns the most recently completed session that uploaded
+	// to key, or ErrSessionNotFound if there is none.
+	GetCompleted(ctx context.Context, key string) (*Session, error)
+	// SetStatus returns ErrSessionNotFound if there is no session with the id.
+	SetStatus(ctx context.Context, id string, status string) error
+	// TransitionStatus sets the status of a session to to if it is from, and
+	// returns ErrSessionClosed otherwise, or ErrSessionNotFound if there is no
+	// session with the id.
+	TransitionStatus(ctx context.Context, id string, from string, to string) error
+	// SetMedia returns ErrSessionNotFound if there is no session with the id.
+	SetMedia(ctx context.Context, id string, info *media.Info) error
+	// ListExpired returns the sessions still uploading that expired at or
+	// before now.
+	ListExpired(ctx context.Context, now time.Time) ([]Session, error)
+	// ListUncollected returns the closed sessions whose part objects have not
+	// been marked as collected, oldest first.
+	ListUncollected(ctx context.Context) ([]Session, error)
+	// MarkPartsCollected records that the part objects of a session have been
+	// deleted. It returns ErrSessionNotFound if there is no session with the
+	// id.
+	MarkPartsCollected(ctx context.Context, id string) error
+	// SetPartChecksum records the checksum the client declared for a part,
+	// replacing any declared before.
+	SetPartChecksum(ctx context.Context, id string, partNumber int, checksum objectstore.Checksum) error
+	// ListPartChecksums returns the declared checksums by part number.
+	ListPartChecksums(ctx context.Context, id string) (map[int]objectstore.Checksum, error)
+}
+
+// IsOpen reports whether the session can still be uploaded to at now.
+func (s *Session) IsOpen(now time.Time) bool {
+	return s.Status == StatusUploading && now.Before(s.ExpiresAt)
+}
+
+// Open returns the session with the given id if owner may still upload to
+// it. Sessions of other owners are reported as not found.
+func Open(ctx context.Context, store Store, owner string, id string, now time.Time) (*Session, error) {
+	session, err := store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Owner != owner {
+		return nil, ErrSessionNotFound
+	}
+	if session.Status != StatusUploading {
+		return nil, ErrSessionClosed
+	}
+	if !now.Before(session.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+	return session, nil
+}
+
+// GetStore returns the upload session store kept in the shared database.
+var GetStore = sync.OnceValues(func() (Store, error) {
+	db, err := database.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+})
@@ -0,0 +1,313 @@
+package uploads_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/database"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/media"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/uploads"
+)
+
+func newTestStore(t *testing.T) *uploads.SQLiteStore {
+	store, err := uploads.NewSQLiteStore(database.OpenTest(t))
+	if err != nil {
+		t.Fatalf("Failed to create upload session store: %v", err)
+	}
+	return store
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	session := &uploads.Session{
+		ID:            "upload-1",
+		Owner:         "user-1",
+		Key:           "users/user-1/meeting.wav",
+		Filename:      "meeting.wav",
+		FileSizeBytes: 1000,
+		NumParts:      2,
+		Status:        uploads.StatusUploading,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(time.Hour),
+	}
+	err := store.Create(ctx, session)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	got, err := uploads.Open(ctx, store, "user-1", session.ID, now)
+	if err != nil {
+		t.Fatalf("Failed to open session: %v", err)
+	}
+	if got.Key != session.Key || got.FileSizeBytes != 1000 || got.NumParts != 2 || !got.ExpiresAt.Equal(session.ExpiresAt) {
+		t.Errorf("Expected %+v, got %+v", session, got)
+	}
+
+	_, err = uploads.Open(ctx, store, "user-2", session.ID, now)
+	if !errors.Is(err, uploads.ErrSessionNotFound) {
+		t.Errorf("Expected %v for another owner, got %v", uploads.ErrSessionNotFound, err)
+	}
+
+	_, err = uploads.Open(ctx, store, "user-1", "missing", now)
+	if !errors.Is(err, uploads.ErrSessionNotFound) {
+		t.Errorf("Expected %v for missing session, got %v", uploads.ErrSessionNotFound, err)
+	}
+
+	_, err = uploads.Open(ctx, store, "user-1", session.ID, now.Add(time.Hour))
+	if !errors.Is(err, uploads.ErrSessionExpired) {
+		t.Errorf("Expected %v after expiry, got %v", uploads.ErrSessionExpired, err)
+	}
+
+	err = store.SetStatus(ctx, session.ID, uploads.StatusComplete)
+	if err != nil {
+		t.Fatalf("Failed to set status: %v", err)
+	}
+	_, err = uploads.Open(ctx, store, "user-1", session.ID, now)
+	if !errors.Is(err, uploads.ErrSessionClosed) {
+		t.Errorf("Expected %v for completed session, got %v", uploads.ErrSessionClosed, err)
+	}
+
+	err = store.SetStatus(ctx, "missing", uploads.StatusComplete)
+	if !errors.Is(err, uploads.ErrSessionNotFound) {
+		t.Errorf("Expected %v when updating missing session, got %v", uploads.ErrSessionNotFound, err)
+	}
+}
+
+func TestTransitionStatus(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	now := time.Now()
+
+	session := &uploads.Session{ID: "upload-1", Owner: "user-1", Status: uploads.StatusUploading, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	err := store.Create(ctx, session)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	err = store.TransitionStatus(ctx, session.ID, uploads.StatusUploading, uploads.StatusCompleting)
+	if err != nil {
+		t.Fatalf("Failed to claim session: %v", err)
+	}
+	err = store.TransitionStatus(ctx, session.ID, uploads.StatusUploading, uploads.StatusCompleting)
+	if !errors.Is(err, uploads.ErrSessionClosed) {
+		t.Errorf("Expected %v when claiming session twice, got %v", uploads.ErrSessionClosed, err)
+	}
+	_, err = uploads.Open(ctx, store, "user-1", session.ID, now)
+	if !errors.Is(err, uploads.ErrSessionClosed) {
+		t.Errorf("Expected %v for session being completed, got %v", uploads.ErrSessionClosed, err)
+	}
+
+	err = store.TransitionStatus(ctx, session.ID, uploads.StatusCompleting, uploads.StatusComplete)
+	if err != nil {
+		t.Fatalf("Failed to complete session: %v", err)
+	}
+	got, err := store.Get(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if got.Status != uploads.StatusComplete {
+		t.Errorf("Expected session to be %s, got %s", uploads.StatusComplete, got.Status)
+	}
+
+	err = store.TransitionStatus(ctx, "missing", uploads.StatusUploading, uploads.StatusCompleting)
+	if !errors.Is(err, uploads.ErrSessionNotFound) {
+		t.Errorf("Expected %v for missing session, got %v", uploads.ErrSessionNotFound, err)
+	}
+}
+
+func TestGetCompleted(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	key := "users/user-1/meeting.m4a"
+
+	_, err := store.GetCompleted(ctx, key)
+	if !errors.Is(err, uploads.ErrSessionNotFound) {
+		t.Errorf("Expected %v before any upload, got %v", uploads.ErrSessionNotFound, err)
+	}
+
+	// The same file uploaded twice, and a third upload still in progress.
+	for i, status := range []string{uploads.StatusComplete, uploads.StatusComplete, uploads.StatusUploading} {
+		session := &uploads.Session{
+			ID:        fmt.Sprintf("upload-%d", i),
+			Owner:     "user-1",
+			Key:       key,
+			Status:    status,
+			CreatedAt: now.Add(time.Duration(i) * time.Minute),
+			ExpiresAt: now.Add(time.Hour),
+		}
+		err := store.Create(ctx, session)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+
+	info := &media.Info{Format: media.FormatMP4, Codec: "aac", DurationSeconds: 61.5, SampleRate: 44100, Channels: 2}
+	err = store.SetMedia(ctx, "upload-1", info)
+	if err != nil {
+		t.Fatalf("Failed to set media: %v", err)
+	}
+	err = store.SetMedia(ctx, "missing", info)
+	if !errors.Is(err, uploads.ErrSessionNotFound) {
+		t.Errorf("Expected %v when updating missing session, got %v", uploads.ErrSessionNotFound, err)
+	}
+
+	session, err := store.GetCompleted(ctx, key)
+	if err != nil {
+		t.Fatalf("Failed to get completed session: %v", err)
+	}
+	if session.ID != "upload-1" {
+		t.Errorf("Expected the latest completed upload, got %s", session.ID)
+	}
+	if session.Media == nil || *session.Media != *info {
+		t.Errorf("Expected media %+v, got %+v", info, session.Media)
+	}
+}
+
+func TestSessionChecks(t *testing.T) {
+	session := &uploads.Session{FileSizeBytes: 1000, NumParts: 2}
+
+	for _, part := range []int{0, 1} {
+		if err := session.CheckPart(part); err != nil {
+			t.Errorf("Expected part %d to be valid, got %v", part, err)
+		}
+	}
+	for _, part := range []int{-1, 2, 31} {
+		if err := session.CheckPart(part); !errors.Is(err, uploads.ErrInvalidPart) {
+			t.Errorf("Expected %v for part %d, got %v", uploads.ErrInvalidPart, part, err)
+		}
+	}
+
+	if err := session.CheckSize(1000); err != nil {
+		t.Errorf("Expected declared size to be valid, got %v", err)
+	}
+	if err := session.CheckSize(999); !errors.Is(err, uploads.ErrSizeMismatch) {
+		t.Errorf("Expected %v, got %v", uploads.ErrSizeMismatch, err)
+	}
+}
+
+func TestPlanParts(t *testing.T) {
+	const MiB = 1024 * 1024
+	testCases := []struct {
+		fileSizeBytes int64
+		numParts      int
+		partSizeBytes int64
+	}{
+		{1, 1, uploads.DefaultPartSize},
+		{uploads.DefaultPartSize, 1, uploads.DefaultPartSize},
+		{uploads.DefaultPartSize + 1, 2, uploads.DefaultPartSize},
+		{2 * 1024 * MiB, 32, uploads.DefaultPartSize},
+		{uploads.DefaultPartSize * objectstore.MaxParts, objectstore.MaxParts, uploads.DefaultPartSize},
+		// Larger files get larger parts instead of more of them.
+		{uploads.DefaultPartSize*objectstore.MaxParts + 1, 9847, 65 * MiB},
+	}
+
+	for _, tc := range testCases {
+		numParts, partSizeBytes := uploads.PlanParts(tc.fileSizeBytes)
+		if numParts != tc.numParts || partSizeBytes != tc.partSizeBytes {
+			t.Errorf("Expected %d bytes to be uploaded in %d parts of %d bytes, got %d parts of %d bytes",
+				tc.fileSizeBytes, tc.numParts, tc.partSizeBytes, numParts, partSizeBytes)
+		}
+		if int64(numParts-1)*partSizeBytes >= tc.fileSizeBytes || int64(numParts)*partSizeBytes < tc.fileSizeBytes {
+			t.Errorf("Parts of %d bytes do not cover %d bytes in %d parts", partSizeBytes, tc.fileSizeBytes, numParts)
+		}
+	}
+}
+
+func TestPartChecksums(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	first := objectstore.Checksum{MD5: "1B2M2Y8AsgTpgAmY7PhCfg==", CRC32C: "AAAAAA=="}
+	second := objectstore.Checksum{CRC32C: "4waSgw=="}
+	for partNumber, checksum := range map[int]objectstore.Checksum{0: {CRC32C: "AAAAAQ=="}, 1: second} {
+		err := store.SetPartChecksum(ctx, "upload-1", partNumber, checksum)
+		if err != nil {
+			t.Fatalf("Failed to set checksum of part %d: %v", partNumber, err)
+		}
+	}
+	// Presigning a part again replaces its checksum.
+	err := store.SetPartChecksum(ctx, "upload-1", 0, first)
+	if err != nil {
+		t.Fatalf("Failed to replace checksum of part 0: %v", err)
+	}
+
+	checksums, err := store.ListPartChecksums(ctx, "upload-1")
+	if err != nil {
+		t.Fatalf("Failed to list checksums: %v", err)
+	}
+	if len(checksums) != 2 || checksums[0] != first || checksums[1] != second {
+		t.Errorf("Expected checksums %+v and %+v, got %+v", first, second, checksums)
+	}
+
+	checksums, err = store.ListPartChecksums(ctx, "upload-2")
+	if err != nil {
+		t.Fatalf("Failed to list checksums: %v", err)
+	}
+	if len(checksums) != 0 {
+		t.Errorf("Expected no checksums for another upload, got %+v", checksums)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	contents := [][]byte{[]byte("0123456789"), []byte("0123456789"), []byte("01234")}
+	session := &uploads.Session{FileSizeBytes: 25, NumParts: 3, PartSizeBytes: 10}
+
+	declared := make(map[int]objectstore.Checksum)
+	var parts []objectstore.Part
+	for i, content := range contents {
+		checksum, size, err := objectstore.ComputeChecksum(bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("Failed to compute checksum: %v", err)
+		}
+		declared[i] = checksum
+		parts = append(parts, objectstore.Part{PartNumber: i, Size: size, Checksum: checksum})
+	}
+
+	err := session.VerifyParts(parts, declared)
+	if err != nil {
+		t.Errorf("Expected parts to be valid, got %v", err)
+	}
+	err = session.VerifyParts(parts[:2], declared)
+	if !errors.Is(err, uploads.ErrMissingPart) {
+		t.Errorf("Expected %v, got %v", uploads.ErrMissingPart, err)
+	}
+	short := slices.Clone(parts)
+	short[1].Size = 9
+	err = session.VerifyParts(short, declared)
+	if !errors.Is(err, uploads.ErrSizeMismatch) {
+		t.Errorf("Expected %v, got %v", uploads.ErrSizeMismatch, err)
+	}
+	corrupted := slices.Clone(parts)
+	corrupted[2].Checksum = declared[0]
+	err = session.VerifyParts(corrupted, declared)
+	if !errors.Is(err, objectstore.ErrChecksumMismatch) {
+		t.Errorf("Expected %v, got %v", objectstore.ErrChecksumMismatch, err)
+	}
+
+	checksum, _, err := objectstore.ComputeChecksum(bytes.NewReader(bytes.Join(contents, nil)))
+	if err != nil {
+		t.Fatalf("Failed to compute checksum: %v", err)
+	}
+	err = session.VerifyObject(&objectstore.ObjectAttrs{Size: 25, Checksum: checksum}, declared)
+	if err != nil {
+		t.Errorf("Expected object to be valid, got %v", err)
+	}
+	err = session.VerifyObject(&objectstore.ObjectAttrs{Size: 25, Checksum: declared[0]}, declared)
+	if !errors.Is(err, objectstore.ErrChecksumMismatch) {
+		t.Errorf("Expected %v, got %v", objectstore.ErrChecksumMismatch, err)
+	}
+	err = session.VerifyObject(&objectstore.ObjectAttrs{Size: 24, Checksum: checksum}, declared)
+	if !errors.Is(err, uploads.ErrSizeMismatch) {
+		t.Errorf("Expected %v, got %v", uploads.ErrSizeMismatch, err)
+	}
+}
@@ -0,0 +1,74 @@
+package uploads
+
+import (
+	"fmt"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/objectstore"
+)
+
+// PartSize returns the size partNumber must have, or -1 if the session
+// predates part sizes being recorded.
+func (s *Session) PartSize(partNumber int) int64 {
+	if s.PartSizeBytes <= 0 {
+		return -1
+	}
+	if partNumber == s.NumParts-1 {
+		return s.FileSizeBytes - int64(s.NumParts-1)*s.PartSizeBytes
+	}
+	return s.PartSizeBytes
+}
+
+// VerifyParts checks the uploaded parts of the session before they are
+// composed: every part must be present, have its planned size, and match
+// the checksum declared for it. Checksums the store does not report are not
+// compared; the store enforced them when the part was uploaded.
+func (s *Session) VerifyParts(parts []objectstore.Part, declared map[int]objectstore.Checksum) error {
+	uploaded := make(map[int]objectstore.Part)
+	for _, part := range parts {
+		uploaded[part.PartNumber] = part
+	}
+
+	for partNumber := 0; partNumber < s.NumParts; partNumber++ {
+		part, ok := uploaded[partNumber]
+		if !ok {
+			return fmt.Errorf("%w: part %d", ErrMissingPart, partNumber)
+		}
+		if size := s.PartSize(partNumber); size >= 0 && part.Size != size {
+			return fmt.Errorf("%w: expected part %d to be %d bytes, got %d", ErrSizeMismatch, partNumber, size, part.Size)
+		}
+		err := declared[partNumber].Verify(part.Checksum)
+		if err != nil {
+			return fmt.Errorf("part %d: %w", partNumber, err)
+		}
+	}
+	return nil
+}
+
+// VerifyObject checks the composed object against the session: its size, and
+// its CRC32C against the CRC32C of the declared parts. The CRC32C is only
+// compared if the store reports one and every part declared one.
+func (s *Session) VerifyObject(attrs *objectstore.ObjectAttrs, declared map[int]objectstore.Checksum) error {
+	err := s.CheckSize(attrs.Size)
+	if err != nil {
+		return err
+	}
+	if attrs.Checksum.CRC32C == "" {
+		return nil
+	}
+
+	var parts []objectstore.ChecksumPart
+	for partNumber := 0; partNumber < s.NumParts; partNumber++ {
+		crc32c := declared[partNumber].CRC32C
+		size := s.PartSize(partNumber)
+		if crc32c == "" || size < 0 {
+			return nil
+		}
+		parts = append(parts, objectstore.ChecksumPart{CRC32C: crc32c, Size: size})
+	}
+
+	expected, err := objectstore.CompositeCRC32C(parts)
+	if err != nil {
+		return err
+	}
+	return objectstore.Checksum{CRC32C: expected}.Verify(attrs.Checksum)
+}
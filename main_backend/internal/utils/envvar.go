@@ -3,6 +3,8 @@ package utils
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 func GetEnvAssert(key string) string {
@@ -12,3 +14,45 @@ func GetEnvAssert(key string) string {
 	}
 	return value
 }
+
+// GetEnvDuration parses the environment variable key as a time.Duration,
+// falling back to defaultValue if it is not set.
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Sprintf("%s environment variable is not a valid duration: %v", key, err))
+	}
+	return duration
+}
+
+// GetEnvFloat parses the environment variable key as a float64, falling back
+// to defaultValue if it is not set.
+func GetEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		panic(fmt.Sprintf("%s environment variable is not a valid number: %v", key, err))
+	}
+	return f
+}
+
+// GetEnvInt parses the environment variable key as an int, falling back to
+// defaultValue if it is not set.
+func GetEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		panic(fmt.Sprintf("%s environment variable is not a valid integer: %v", key, err))
+	}
+	return i
+}
@@ -0,0 +1,189 @@
+package whisper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+)
+
+const (
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	// DefaultOpenAIModel is the model jobs are sent to. Models must support
+	// the verbose_json response format for segments to be returned.
+	DefaultOpenAIModel = "whisper-1"
+	// DefaultOpenAIConcurrency is how many jobs are sent to the API at once.
+	DefaultOpenAIConcurrency = 4
+)
+
+var ErrMissingOpenAIAPIKey = errors.New("OpenAI API key is required")
+
+// OpenAIClient is a Transcriber for the OpenAI audio transcription API, or
+// any server that implements it. Azure OpenAI is supported by giving the
+// deployment's URL as the base URL, along with an API version. The API
+// transcribes synchronously, so jobs are queued and run in the background.
+//
+// The API accepts files of up to 25 MB, and takes the model from the
+// client rather than from WhisperInput.
+type OpenAIClient struct {
+	*jobQueue
+	apiKey      string
+	baseURL     string
+	model       string
+	apiVersion  string
+	httpClient  *http.Client
+	concurrency int
+}
+
+type OpenAIOption func(*OpenAIClient)
+
+func WithOpenAIBaseURL(baseURL string) OpenAIOption {
+	return func(c *OpenAIClient) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+func WithOpenAIModel(model string) OpenAIOption {
+	return func(c *OpenAIClient) {
+		c.model = model
+	}
+}
+
+// WithAzureAPIVersion sends requests in the form Azure OpenAI expects, with
+// the key in the api-key header and the API version in the query string.
+func WithAzureAPIVersion(apiVersion string) OpenAIOption {
+	return func(c *OpenAIClient) {
+		c.apiVersion = apiVersion
+	}
+}
+
+// WithOpenAIConcurrency sets how many jobs are sent to the API at once.
+func WithOpenAIConcurrency(n int) OpenAIOption {
+	return func(c *OpenAIClient) {
+		c.concurrency = n
+	}
+}
+
+func WithOpenAIHTTPClient(client *http.Client) OpenAIOption {
+	return func(c *OpenAIClient) {
+		c.httpClient = client
+	}
+}
+
+func NewOpenAIClient(apiKey string, options ...OpenAIOption) (*OpenAIClient, error) {
+	if apiKey == "" {
+		return nil, ErrMissingOpenAIAPIKey
+	}
+
+	c := &OpenAIClient{
+		apiKey:      apiKey,
+		baseURL:     DefaultOpenAIBaseURL,
+		model:       DefaultOpenAIModel,
+		httpClient:  http.DefaultClient,
+		concurrency: DefaultOpenAIConcurrency,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	c.jobQueue = newJobQueue(BackendOpenAI, c.concurrency, c.httpClient, c.transcribe)
+	return c, nil
+}
+
+func (c *OpenAIClient) url(path string) string {
+	if c.apiVersion == "" {
+		return c.baseURL + path
+	}
+	return c.baseURL + path + "?" + url.Values{"api-version": {c.apiVersion}}.Encode()
+}
+
+func (c *OpenAIClient) header() http.Header {
+	header := http.Header{}
+	if c.apiVersion == "" {
+		header.Set("Authorization", "Bearer "+c.apiKey)
+	} else {
+		header.Set("api-key", c.apiKey)
+	}
+	return header
+}
+
+// HealthCheck lists the API's models to check that it accepts the key, and
+// counts the jobs this client knows about. Azure deployments do not list
+// models, so only the jobs are counted for them.
+func (c *OpenAIClient) HealthCheck(ctx context.Context) (*runpod.HealthCheckResponse, error) {
+	if c.apiVersion == "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("/models"), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header = c.header()
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("OpenAI API is unreachable: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("OpenAI API is unhealthy: %w", openAIError(resp))
+		}
+	}
+	return c.health(), nil
+}
+
+// transcribe streams the audio at input.AudioURL to the API and waits for
+// the transcript.
+func (c *OpenAIClient) transcribe(ctx context.Context, input WhisperInput) (*WhisperOutput, error) {
+	resp, err := postAudio(ctx, c.httpClient, input.AudioURL, c.url("/audio/transcriptions"), c.header(), "file", c.request(input))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call OpenAI API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, openAIError(resp)
+	}
+
+	var output verboseOutput
+	err = json.NewDecoder(resp.Body).Decode(&output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode OpenAI API response: %w", err)
+	}
+	return output.normalize(), nil
+}
+
+// request returns the form fields to send with input. The API has no
+// equivalent for the decoding options beyond the temperature.
+func (c *OpenAIClient) request(input WhisperInput) url.Values {
+	fields := url.Values{}
+	fields.Set("model", c.model)
+	fields.Set("response_format", "verbose_json")
+	fields.Set("temperature", formatFloat(input.Temperature))
+	fields.Add("timestamp_granularities[]", "segment")
+	if input.WordTimestamps {
+		fields.Add("timestamp_granularities[]", "word")
+	}
+	if input.Language != "" {
+		fields.Set("language", input.Language)
+	}
+	if input.InitialPrompt != "" {
+		fields.Set("prompt", input.InitialPrompt)
+	}
+	return fields
+}
+
+// openAIError reads the error the API describes in resp.
+func openAIError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var apiError struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &apiError) == nil && apiError.Error.Message != "" {
+		return fmt.Errorf("OpenAI API returned %s: %s", resp.Status, apiError.Error.Message)
+	}
+	return fmt.Errorf("OpenAI API returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
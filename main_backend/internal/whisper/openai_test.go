@@ -0,0 +1,142 @@
+package whisper_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+func TestOpenAIRun(t *testing.T) {
+	var form map[string][]string
+	server := newTestWhisperServer(t, "POST /v1/audio/transcriptions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "unexpected key", http.StatusUnauthorized)
+			return
+		}
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		form = r.MultipartForm.Value
+		_, header, err := r.FormFile("file")
+		if err != nil || header.Filename != "recording.wav" {
+			http.Error(w, "unexpected file", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{
+			"task": "transcribe",
+			"language": "english",
+			"duration": 3,
+			"text": "Hello world. Goodbye.",
+			"segments": [
+				{"id": 0, "seek": 0, "start": 0, "end": 1.5, "text": " Hello world.", "tokens": [50364, 2425], "avg_logprob": -0.2},
+				{"id": 1, "seek": 0, "start": 1.5, "end": 3, "text": " Goodbye.", "tokens": [50439]}
+			],
+			"words": [
+				{"word": "Hello", "start": 0, "end": 0.6},
+				{"word": "world", "start": 0.6, "end": 1.4},
+				{"word": "Goodbye", "start": 1.6, "end": 2.8}
+			]
+		}`)
+	})
+
+	c, err := whisper.NewOpenAIClient("test-key", whisper.WithOpenAIBaseURL(server.URL+"/v1"))
+	if err != nil {
+		t.Fatalf("Failed to create OpenAI client: %v", err)
+	}
+
+	input := whisper.NewWhisperInput(server.URL+"/audio/recording.wav",
+		whisper.WithLanguage("en"),
+		whisper.WithTemperature(0.2),
+		whisper.WithInitialPrompt("A greeting."),
+		whisper.WithWordTimestamps(true),
+	)
+	response, err := c.Run(context.Background(), input, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to run job: %v", err)
+	}
+	status := waitForJob(t, c, response.JobId)
+	if status.Status != whisper.StatusComplete {
+		t.Fatalf("Expected %s, got %s: %s", whisper.StatusComplete, status.Status, status.Error)
+	}
+
+	expectedFields := map[string][]string{
+		"model":                     {whisper.DefaultOpenAIModel},
+		"response_format":           {"verbose_json"},
+		"language":                  {"en"},
+		"temperature":               {"0.2"},
+		"prompt":                    {"A greeting."},
+		"timestamp_granularities[]": {"segment", "word"},
+	}
+	for name, expected := range expectedFields {
+		if len(form[name]) != len(expected) || form[name][0] != expected[0] || form[name][len(expected)-1] != expected[len(expected)-1] {
+			t.Errorf("Expected %s to be %v, got %v", name, expected, form[name])
+		}
+	}
+
+	output, err := c.Result(context.Background(), response.JobId)
+	if err != nil {
+		t.Fatalf("Failed to get result: %v", err)
+	}
+	if output.Transcription != "Hello world. Goodbye." || output.DetectedLanguage != "english" {
+		t.Errorf("Unexpected output: %+v", output)
+	}
+	if len(output.Segments) != 2 || output.Segments[0].AvgLogprob != -0.2 {
+		t.Fatalf("Unexpected segments: %+v", output.Segments)
+	}
+	if len(output.Segments[0].Words) != 2 || len(output.Segments[1].Words) != 1 || output.Segments[1].Words[0].Word != "Goodbye" {
+		t.Errorf("Expected words to be assigned to their segments, got %+v", output.Segments)
+	}
+}
+
+func TestOpenAIError(t *testing.T) {
+	server := newTestWhisperServer(t, "POST /v1/audio/transcriptions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error"}}`)
+	})
+
+	c, err := whisper.NewOpenAIClient("wrong-key", whisper.WithOpenAIBaseURL(server.URL+"/v1"))
+	if err != nil {
+		t.Fatalf("Failed to create OpenAI client: %v", err)
+	}
+
+	response, err := c.Run(context.Background(), whisper.NewWhisperInput(server.URL+"/audio/recording.wav"), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to run job: %v", err)
+	}
+	status := waitForJob(t, c, response.JobId)
+	if status.Status != whisper.StatusFailed || status.Error != "OpenAI API returned 401 Unauthorized: Incorrect API key provided" {
+		t.Errorf("Expected %s with the API's error, got %+v", whisper.StatusFailed, status)
+	}
+}
+
+func TestOpenAIAzure(t *testing.T) {
+	server := newTestWhisperServer(t, "POST /openai/deployments/whisper/audio/transcriptions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("api-key") != "test-key" || r.URL.Query().Get("api-version") != "2024-06-01" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"language": "english", "text": "Hello.", "segments": [{"id": 0, "start": 0, "end": 1, "text": " Hello."}]}`)
+	})
+
+	c, err := whisper.NewOpenAIClient("test-key",
+		whisper.WithOpenAIBaseURL(server.URL+"/openai/deployments/whisper"),
+		whisper.WithAzureAPIVersion("2024-06-01"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create OpenAI client: %v", err)
+	}
+
+	response, err := c.Run(context.Background(), whisper.NewWhisperInput(server.URL+"/audio/recording.wav"), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to run job: %v", err)
+	}
+	status := waitForJob(t, c, response.JobId)
+	if status.Status != whisper.StatusComplete {
+		t.Fatalf("Expected %s, got %s: %s", whisper.StatusComplete, status.Status, status.Error)
+	}
+}
@@ -0,0 +1,346 @@
+package whisper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+	"github.com/google/uuid"
+)
+
+// jobRetention is how long finished jobs are remembered.
+const jobRetention = 24 * time.Hour
+
+var ErrUnknownJob = errors.New("unknown job")
+
+// jobQueue gives a backend that transcribes synchronously the asynchronous
+// job API of RunPod. Jobs run in the background, at most as many at once as
+// the queue has slots, and their status is kept in memory: jobs that were
+// running when the backend restarted are reported as failed.
+type jobQueue struct {
+	name       string
+	transcribe func(ctx context.Context, input WhisperInput) (*WhisperOutput, error)
+	httpClient *http.Client
+	slots      chan struct{}
+	now        func() time.Time
+
+	mu   sync.Mutex
+	jobs map[string]*queuedJob
+}
+
+type queuedJob struct {
+	status     string
+	err        string
+	output     *WhisperOutput
+	queuedAt   time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+	cancel     context.CancelFunc
+}
+
+func newJobQueue(name string, concurrency int, httpClient *http.Client, transcribe func(ctx context.Context, input WhisperInput) (*WhisperOutput, error)) *jobQueue {
+	return &jobQueue{
+		name:       name,
+		transcribe: transcribe,
+		httpClient: httpClient,
+		slots:      make(chan struct{}, max(concurrency, 1)),
+		now:        time.Now,
+		jobs:       make(map[string]*queuedJob),
+	}
+}
+
+// Run queues a job. The policy's execution timeout applies once the job is
+// sent to the backend. The webhook, if any, receives the same payload RunPod
+// would send when the job finishes. s3Config is not supported.
+func (q *jobQueue) Run(ctx context.Context, input WhisperInput, webhook *runpod.WebHook, policy *runpod.ExecutionPolicy, s3Config *runpod.S3Config) (*runpod.AsyncRunResponse, error) {
+	if input.AudioURL == "" {
+		return nil, fmt.Errorf("audio URL is required")
+	}
+	timeout := runpod.DefaultExecutionTimeout
+	if policy != nil && policy.Timeout > 0 {
+		timeout = time.Duration(policy.Timeout) * time.Millisecond
+	}
+
+	// The job outlives the call that starts it.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	id := uuid.New().String()
+	job := &queuedJob{status: StatusQueue, queuedAt: q.now(), cancel: cancel}
+
+	q.mu.Lock()
+	q.pruneLocked()
+	q.jobs[id] = job
+	q.mu.Unlock()
+
+	slog.Info("Queued transcription job", "backend", q.name, "jobId", id)
+	go q.process(ctx, id, job, input, timeout, webhook)
+	return &runpod.AsyncRunResponse{JobId: id, Status: StatusQueue}, nil
+}
+
+// pruneLocked forgets jobs that finished more than jobRetention
+// ago.
+func (q *jobQueue) pruneLocked() {
+	for id, job := range q.jobs {
+		if !job.finishedAt.IsZero() && q.now().Sub(job.finishedAt) > jobRetention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func (q *jobQueue) process(ctx context.Context, id string, job *queuedJob, input WhisperInput, timeout time.Duration, webhook *runpod.WebHook) {
+	defer job.cancel()
+
+	select {
+	case q.slots <- struct{}{}:
+		defer func() { <-q.slots }()
+	case <-ctx.Done():
+		q.finish(id, job, nil, ctx.Err(), webhook)
+		return
+	}
+
+	q.mu.Lock()
+	job.status = StatusProgress
+	job.startedAt = q.now()
+	q.mu.Unlock()
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	output, err := q.transcribe(runCtx, input)
+	if err != nil && ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		err = context.DeadlineExceeded
+	} else if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	q.finish(id, job, output, err, webhook)
+}
+
+func (q *jobQueue) finish(id string, job *queuedJob, output *WhisperOutput, err error, webhook *runpod.WebHook) {
+	q.mu.Lock()
+	switch {
+	case err == nil:
+		job.status = StatusComplete
+		job.output = output
+	case errors.Is(err, context.Canceled):
+		job.status = StatusCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		job.status = StatusTimeout
+	default:
+		job.status = StatusFailed
+		job.err = err.Error()
+	}
+	job.finishedAt = q.now()
+	status := q.statusLocked(job)
+	q.mu.Unlock()
+
+	if status.Status == StatusFailed {
+		slog.Error("Transcription job failed", "backend", q.name, "jobId", id, "error", err)
+	} else {
+		slog.Info("Transcription job finished", "backend", q.name, "jobId", id, "status", status.Status)
+	}
+	if webhook != nil {
+		q.notify(*webhook, id, status, output)
+	}
+}
+
+// notify posts the outcome of a job to its webhook, as RunPod would.
+func (q *jobQueue) notify(webhook runpod.WebHook, id string, status *WhisperJobStatus, output *WhisperOutput) {
+	payload := runpod.StatusResponse{
+		BaseStatusResponse: runpod.BaseStatusResponse{
+			JobId:         id,
+			Status:        status.Status,
+			Error:         status.Error,
+			DelayTime:     status.DelayTime,
+			ExecutionTime: status.ExecutionTime,
+		},
+	}
+	if output != nil {
+		payload.Output = output
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to marshal webhook payload", "jobId", id, "error", err)
+		return
+	}
+
+	resp, err := q.httpClient.Post(string(webhook), "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Failed to call webhook", "jobId", id, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		slog.Error("Webhook returned an error", "jobId", id, "status", resp.Status)
+	}
+}
+
+// statusLocked reports times in milliseconds, like RunPod: the delay is the
+// time spent queued, the execution time the time spent on the server.
+func (q *jobQueue) statusLocked(job *queuedJob) *WhisperJobStatus {
+	status := &WhisperJobStatus{Status: job.status, Error: job.err}
+	end := job.finishedAt
+	if end.IsZero() {
+		end = q.now()
+	}
+	if job.startedAt.IsZero() {
+		status.DelayTime = int(end.Sub(job.queuedAt).Milliseconds())
+	} else {
+		status.DelayTime = int(job.startedAt.Sub(job.queuedAt).Milliseconds())
+		status.ExecutionTime = int(end.Sub(job.startedAt).Milliseconds())
+	}
+	return status
+}
+
+// Status reports jobs this client does not know about as failed, since they
+// were lost when the backend restarted.
+func (q *jobQueue) Status(_ context.Context, jobId string) (*WhisperJobStatus, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobId]
+	if !ok {
+		return &WhisperJobStatus{Status: StatusFailed, Error: fmt.Sprintf("%s: %s", ErrUnknownJob, jobId)}, nil
+	}
+	return q.statusLocked(job), nil
+}
+
+func (q *jobQueue) Result(_ context.Context, jobId string) (*WhisperOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobId]
+	if !ok {
+		return nil, &ErrJobFailed{Status: StatusFailed}
+	}
+	switch job.status {
+	case StatusQueue, StatusProgress:
+		return nil, &ErrJobInProgress{}
+	case StatusComplete:
+		return job.output, nil
+	default:
+		return nil, &ErrJobFailed{Status: job.status}
+	}
+}
+
+func (q *jobQueue) Cancel(_ context.Context, jobId string) (*runpod.CancelResponse, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobId]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJob, jobId)
+	}
+	if job.status == StatusQueue || job.status == StatusProgress {
+		job.cancel()
+		return &runpod.CancelResponse{JobId: jobId, Status: StatusCanceled}, nil
+	}
+	return &runpod.CancelResponse{JobId: jobId, Status: job.status}, nil
+}
+
+// health counts the jobs the queue knows about, and reports its slots as
+// workers.
+func (q *jobQueue) health() *runpod.HealthCheckResponse {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	health := &runpod.HealthCheckResponse{}
+	for _, job := range q.jobs {
+		switch job.status {
+		case StatusQueue:
+			health.Jobs.InQueue++
+		case StatusProgress:
+			health.Jobs.InProgress++
+		case StatusComplete:
+			health.Jobs.Completed++
+		default:
+			health.Jobs.Failed++
+		}
+	}
+	health.Workers.Running = len(q.slots)
+	health.Workers.Idle = cap(q.slots) - len(q.slots)
+	health.Workers.Ready = cap(q.slots)
+	return health
+}
+
+// fetchesAudio marks the backends built on a jobQueue as AudioFetchers, since
+// they post the audio to their server with postAudio.
+func (q *jobQueue) fetchesAudio() {}
+
+// postAudio downloads the audio at audioURL and streams it to endpoint as a
+// multipart form, in fileField alongside fields. The caller closes the
+// response body.
+func postAudio(ctx context.Context, client *http.Client, audioURL string, endpoint string, header http.Header, fileField string, fields url.Values) (*http.Response, error) {
+	audioReq, err := http.NewRequestWithContext(ctx, http.MethodGet, audioURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	audio, err := client.Do(audioReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download audio: %w", err)
+	}
+	defer audio.Body.Close()
+	if audio.StatusCode < 200 || audio.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to download audio: %s", audio.Status)
+	}
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeForm(form, fields, fileField, audioFilename(audioURL), audio.Body))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return client.Do(req)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// audioFilename names the uploaded audio after the object it was presigned
+// for, since servers that convert audio go by its extension.
+func audioFilename(audioURL string) string {
+	u, err := url.Parse(audioURL)
+	if err != nil || path.Base(u.Path) == "/" || path.Base(u.Path) == "." {
+		return "audio"
+	}
+	return path.Base(u.Path)
+}
+
+func writeForm(form *multipart.Writer, fields url.Values, fileField string, filename string, audio io.Reader) error {
+	for name, values := range fields {
+		for _, value := range values {
+			err := form.WriteField(name, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	file, err := form.CreateFormFile(fileField, filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, audio)
+	if err != nil {
+		return err
+	}
+	return form.Close()
+}
@@ -1,6 +1,7 @@
 package whisper
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -20,8 +21,10 @@ type RunpodWhisperClient struct {
 
 var ErrMissingRunpodWhisperURL = fmt.Errorf("runpod whisper URL is required")
 
-func NewRunpodWhisperClient(runpodAPIKey string, runpodWhisperURL string) (*RunpodWhisperClient, error) {
-	rpclient, err := runpod.NewRunpodClient(runpodAPIKey)
+// NewRunpodWhisperClient creates a client for the endpoint at
+// runpodWhisperURL, which may also be an endpoint ID.
+func NewRunpodWhisperClient(runpodAPIKey string, runpodWhisperURL string, options ...runpod.RunpodClientOption) (*RunpodWhisperClient, error) {
+	rpclient, err := runpod.NewRunpodClient(runpodAPIKey, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -35,7 +38,7 @@ func NewRunpodWhisperClient(runpodAPIKey string, runpodWhisperURL string) (*Runp
 	}, nil
 }
 
-func (c *RunpodWhisperClient) Run(input WhisperInput, webhook *runpod.WebHook, policy *runpod.ExecutionPolicy, s3Config *runpod.S3Config) (*runpod.AsyncRunResponse, error) {
+func (c *RunpodWhisperClient) Run(ctx context.Context, input WhisperInput, webhook *runpod.WebHook, policy *runpod.ExecutionPolicy, s3Config *runpod.S3Config) (*runpod.AsyncRunResponse, error) {
 	runRequest := runpod.RunRequest{
 		Input: input,
 	}
@@ -54,7 +57,7 @@ func (c *RunpodWhisperClient) Run(input WhisperInput, webhook *runpod.WebHook, p
 
 	slog.Info("Running whisper", "request", runRequest)
 
-	response, err := c.rpclient.Run(c.RunpodWhisperURL, runRequest)
+	response, err := c.rpclient.RunContext(ctx, c.RunpodWhisperURL, runRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +65,7 @@ func (c *RunpodWhisperClient) Run(input WhisperInput, webhook *runpod.WebHook, p
 	return response, nil
 }
 
-func (c *RunpodWhisperClient) RunSync(input WhisperInput, webhook *runpod.WebHook, policy *runpod.ExecutionPolicy, s3Config *runpod.S3Config) (*WhisperSyncRunResponse, error) {
+func (c *RunpodWhisperClient) RunSync(ctx context.Context, input WhisperInput, webhook *runpod.WebHook, policy *runpod.ExecutionPolicy, s3Config *runpod.S3Config) (*WhisperSyncRunResponse, error) {
 	runRequest := runpod.RunRequest{
 		Input: input,
 	}
@@ -79,7 +82,7 @@ func (c *RunpodWhisperClient) RunSync(input WhisperInput, webhook *runpod.WebHoo
 		runRequest.S3Config = *s3Config
 	}
 
-	response, err := c.rpclient.RunSync(c.RunpodWhisperURL, runRequest)
+	response, err := c.rpclient.RunSyncContext(ctx, c.RunpodWhisperURL, runRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -98,8 +101,8 @@ func (c *RunpodWhisperClient) RunSync(input WhisperInput, webhook *runpod.WebHoo
 	return &whisperOutput, nil
 }
 
-func (c *RunpodWhisperClient) Status(jobId string) (*WhisperJobStatus, error) {
-	statusResponse, err := c.rpclient.Status(c.RunpodWhisperURL, jobId)
+func (c *RunpodWhisperClient) Status(ctx context.Context, jobId string) (*WhisperJobStatus, error) {
+	statusResponse, err := c.rpclient.StatusContext(ctx, c.RunpodWhisperURL, jobId)
 	if err != nil {
 		return nil, err
 	}
@@ -129,13 +132,27 @@ type ErrJobFailed struct {
 }
 
 func (e *ErrJobFailed) Error() string {
+	if e.Status == StatusCanceled {
+		return "job was cancelled"
+	}
 	return fmt.Sprintf("job failed with status: %s", e.Status)
 }
 
+// Is reports whether target is an ErrJobFailed with the same status, so that
+// errors.Is(err, ErrJobCancelled) holds for any cancelled job.
+func (e *ErrJobFailed) Is(target error) bool {
+	failed, ok := target.(*ErrJobFailed)
+	return ok && failed.Status == e.Status
+}
+
 var JobInProgress = &ErrJobInProgress{}
 
-func (c *RunpodWhisperClient) Result(jobId string) (*WhisperOutput, error) {
-	resultResponse, err := c.rpclient.Status(c.RunpodWhisperURL, jobId)
+// ErrJobCancelled is the error for jobs that were cancelled before they
+// finished.
+var ErrJobCancelled = &ErrJobFailed{Status: StatusCanceled}
+
+func (c *RunpodWhisperClient) Result(ctx context.Context, jobId string) (*WhisperOutput, error) {
+	resultResponse, err := c.rpclient.StatusContext(ctx, c.RunpodWhisperURL, jobId)
 	if err != nil {
 		return nil, err
 	}
@@ -151,7 +168,13 @@ func (c *RunpodWhisperClient) Result(jobId string) (*WhisperOutput, error) {
 		return nil, fmt.Errorf("unknown job status: %s", resultResponse.Status)
 	}
 
-	outputJSON, err := json.Marshal(resultResponse.Output)
+	return DecodeOutput(resultResponse.Output)
+}
+
+// DecodeOutput converts the untyped output of a completed RunPod job, as
+// found in status responses and webhook payloads, into a WhisperOutput.
+func DecodeOutput(output interface{}) (*WhisperOutput, error) {
+	outputJSON, err := json.Marshal(output)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling response output: %w", err)
 	}
@@ -164,24 +187,68 @@ func (c *RunpodWhisperClient) Result(jobId string) (*WhisperOutput, error) {
 	return &whisperOutput, nil
 }
 
-func (c *RunpodWhisperClient) Cancel(jobId string) (*runpod.CancelResponse, error) {
-	cancelResponse, err := c.rpclient.Cancel(c.RunpodWhisperURL, jobId)
+// Stream returns the segments the job has transcribed since it was last
+// streamed. The worker must yield its segments as it goes, each output being a
+// segment or an object with a list of segments; other workers hand out
+// nothing until the job completes.
+func (c *RunpodWhisperClient) Stream(ctx context.Context, jobId string) (*WhisperStream, error) {
+	streamResponse, err := c.rpclient.StreamContext(ctx, c.RunpodWhisperURL, jobId)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &WhisperStream{Status: streamResponse.Status, Error: streamResponse.Error}
+	for _, output := range streamResponse.Stream {
+		if len(output.Output) == 0 || string(output.Output) == "null" {
+			continue
+		}
+		segments, err := decodeStreamOutput(output.Output)
+		if err != nil {
+			return nil, err
+		}
+		stream.Segments = append(stream.Segments, segments...)
+	}
+	return stream, nil
+}
+
+func decodeStreamOutput(output json.RawMessage) ([]Segment, error) {
+	var batch struct {
+		Segments *[]Segment `json:"segments"`
+	}
+	err := json.Unmarshal(output, &batch)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling stream output: %w", err)
+	}
+	if batch.Segments != nil {
+		return *batch.Segments, nil
+	}
+
+	var segment Segment
+	err = json.Unmarshal(output, &segment)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling stream output: %w", err)
+	}
+	return []Segment{segment}, nil
+}
+
+func (c *RunpodWhisperClient) Cancel(ctx context.Context, jobId string) (*runpod.CancelResponse, error) {
+	cancelResponse, err := c.rpclient.CancelContext(ctx, c.RunpodWhisperURL, jobId)
 	if err != nil {
 		return nil, err
 	}
 	return cancelResponse, nil
 }
 
-func (c *RunpodWhisperClient) HealthCheck() (*runpod.HealthCheckResponse, error) {
-	healthCheckResponse, err := c.rpclient.HealthCheck(c.RunpodWhisperURL)
+func (c *RunpodWhisperClient) HealthCheck(ctx context.Context) (*runpod.HealthCheckResponse, error) {
+	healthCheckResponse, err := c.rpclient.HealthCheckContext(ctx, c.RunpodWhisperURL)
 	if err != nil {
 		return nil, err
 	}
 	return healthCheckResponse, nil
 }
 
-func (c *RunpodWhisperClient) PurgeQueue() (*runpod.PurgeQueueResponse, error) {
-	purgeQueueResponse, err := c.rpclient.PurgeQueue(c.RunpodWhisperURL)
+func (c *RunpodWhisperClient) PurgeQueue(ctx context.Context) (*runpod.PurgeQueueResponse, error) {
+	purgeQueueResponse, err := c.rpclient.PurgeQueueContext(ctx, c.RunpodWhisperURL)
 	if err != nil {
 		return nil, err
 	}
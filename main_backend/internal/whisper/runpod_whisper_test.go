@@ -1,10 +1,18 @@
 package whisper_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
 	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
 )
 
@@ -29,7 +37,7 @@ func TestWhisperRun(t *testing.T) {
 		return
 	}
 
-	response, err := c.Run(input, nil, nil, nil)
+	response, err := c.Run(context.Background(), input, nil, nil, nil)
 	if err != nil {
 		t.Errorf("Failed to run job: %v", err)
 	}
@@ -43,7 +51,7 @@ func TestWhisperRunSync(t *testing.T) {
 		return
 	}
 
-	response, err := c.RunSync(input, nil, nil, nil)
+	response, err := c.RunSync(context.Background(), input, nil, nil, nil)
 	if err != nil {
 		t.Errorf("Failed to run job: %v", err)
 	}
@@ -57,11 +65,11 @@ func TestWhisperStatus(t *testing.T) {
 		return
 	}
 
-	response, err := c.Run(input, nil, nil, nil)
+	response, err := c.Run(context.Background(), input, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to run job: %v", err)
 	}
-	status, err := c.Status(response.JobId)
+	status, err := c.Status(context.Background(), response.JobId)
 	if err != nil {
 		t.Fatalf("Failed to get status: %v", err)
 	}
@@ -80,12 +88,12 @@ func TestWhisperResult(t *testing.T) {
 		return
 	}
 
-	response, err := c.Run(input, nil, nil, nil)
+	response, err := c.Run(context.Background(), input, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to run job: %v", err)
 	}
 	time.Sleep(2 * time.Second)
-	result, err := c.Result(response.JobId)
+	result, err := c.Result(context.Background(), response.JobId)
 	if err != nil {
 		t.Fatalf("Failed to get result: %v", err)
 	}
@@ -99,11 +107,11 @@ func TestWhisperCancel(t *testing.T) {
 		return
 	}
 
-	response, err := c.Run(input, nil, nil, nil)
+	response, err := c.Run(context.Background(), input, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to run job: %v", err)
 	}
-	cancel, err := c.Cancel(response.JobId)
+	cancel, err := c.Cancel(context.Background(), response.JobId)
 	if err != nil {
 		t.Fatalf("Failed to cancel job: %v", err)
 	}
@@ -117,7 +125,7 @@ func TestWhisperHealthCheck(t *testing.T) {
 		return
 	}
 
-	response, err := c.HealthCheck()
+	response, err := c.HealthCheck(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to health check: %v", err)
 	}
@@ -131,9 +139,153 @@ func TestWhisperPurgeQueue(t *testing.T) {
 		return
 	}
 
-	response, err := c.PurgeQueue()
+	response, err := c.PurgeQueue(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to purge queue: %v", err)
 	}
 	t.Logf("Purge queue: %v", response)
 }
+
+func TestWhisperEndpointID(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v2/whisper-endpoint/run", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-api-key" {
+			http.Error(w, "unexpected key", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(runpod.AsyncRunResponse{JobId: "job-1", Status: whisper.StatusQueue})
+	})
+	mux.HandleFunc("GET /v2/whisper-endpoint/status/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// Hangs until the caller gives up.
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c, err := whisper.NewRunpodWhisperClient("test-api-key", "whisper-endpoint",
+		runpod.WithBaseURL(server.URL+"/v2"),
+		runpod.WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create runpod whisper client: %v", err)
+	}
+
+	response, err := c.Run(context.Background(), input, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to run job: %v", err)
+	}
+	if response.JobId != "job-1" {
+		t.Fatalf("Unexpected response: %+v", response)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.Status(ctx, response.JobId)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the status request to be cancelled, got %v", err)
+	}
+}
+
+func TestWhisperRetries(t *testing.T) {
+	var runCalls, statusCalls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /run", func(w http.ResponseWriter, r *http.Request) {
+		switch runCalls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, "<html>Service Unavailable</html>", http.StatusServiceUnavailable)
+		default:
+			json.NewEncoder(w).Encode(runpod.AsyncRunResponse{JobId: "job-1", Status: whisper.StatusQueue})
+		}
+	})
+	mux.HandleFunc("GET /status/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch statusCalls.Add(1) {
+		case 1:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		case 2:
+			json.NewEncoder(w).Encode(runpod.StatusResponse{BaseStatusResponse: runpod.BaseStatusResponse{JobId: r.PathValue("id"), Status: whisper.StatusQueue}})
+		default:
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c, err := whisper.NewRunpodWhisperClient("test-api-key", server.URL, runpod.WithBackoff(time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create runpod whisper client: %v", err)
+	}
+
+	// A rejected run is retried, but one that may have been acted on is not.
+	_, err = c.Run(context.Background(), input, nil, nil, nil)
+	var apiErr *runpod.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || !apiErr.Retryable {
+		t.Fatalf("Expected a retryable 503 APIError, got %v", err)
+	}
+	if runCalls.Load() != 2 {
+		t.Fatalf("Expected 2 run requests, got %d", runCalls.Load())
+	}
+
+	status, err := c.Status(context.Background(), "job-1")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if status.Status != whisper.StatusQueue || statusCalls.Load() != 2 {
+		t.Fatalf("Expected %s after 2 requests, got %+v after %d", whisper.StatusQueue, status, statusCalls.Load())
+	}
+
+	// RunPod asks for a longer wait than the client will make.
+	_, err = c.Status(context.Background(), "job-1")
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != time.Minute {
+		t.Fatalf("Expected a 429 APIError with Retry-After, got %v", err)
+	}
+	if statusCalls.Load() != 3 {
+		t.Fatalf("Expected no retry after a long Retry-After, got %d requests", statusCalls.Load())
+	}
+
+	server.Close()
+	_, err = c.PurgeQueue(context.Background())
+	if err == nil {
+		t.Fatalf("Expected purging the queue of a closed server to fail")
+	}
+}
+
+func TestWhisperStream(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{
+			"status": "IN_PROGRESS",
+			"stream": [
+				{"output": {"id": 0, "start": 0, "end": 2, "text": " Four score"}},
+				{"output": null},
+				{"output": {"segments": [{"id": 1, "start": 2, "end": 4, "text": " and seven"}, {"id": 2, "start": 4, "end": 5, "text": " years ago"}]}}
+			]
+		}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c, err := whisper.NewRunpodWhisperClient("test-api-key", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create runpod whisper client: %v", err)
+	}
+
+	stream, err := c.Stream(context.Background(), "job-1")
+	if err != nil {
+		t.Fatalf("Failed to stream job: %v", err)
+	}
+	if stream.Status != whisper.StatusProgress || len(stream.Segments) != 3 {
+		t.Fatalf("Unexpected stream: %+v", stream)
+	}
+	for i, segment := range stream.Segments {
+		if segment.ID != i {
+			t.Fatalf("Expected segment %d in order, got %+v", i, segment)
+		}
+	}
+	if stream.Segments[2].Text != " years ago" || stream.Segments[2].End != 5 {
+		t.Fatalf("Unexpected segment: %+v", stream.Segments[2])
+	}
+}
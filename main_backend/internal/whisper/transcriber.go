@@ -0,0 +1,107 @@
+package whisper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+)
+
+const (
+	BackendRunpod        = "runpod"
+	BackendWhisperServer = "whisper-server"
+	BackendOpenAI        = "openai"
+)
+
+// Transcriber runs transcription jobs. Job IDs are assigned by the backend,
+// and statuses follow RunPod's, whichever backend runs the job. The context
+// bounds each call, not the job it starts.
+type Transcriber interface {
+	Run(ctx context.Context, input WhisperInput, webhook *runpod.WebHook, policy *runpod.ExecutionPolicy, s3Config *runpod.S3Config) (*runpod.AsyncRunResponse, error)
+	Status(ctx context.Context, jobId string) (*WhisperJobStatus, error)
+	// Result returns ErrJobInProgress or ErrJobFailed if the job has not
+	// completed.
+	Result(ctx context.Context, jobId string) (*WhisperOutput, error)
+	Cancel(ctx context.Context, jobId string) (*runpod.CancelResponse, error)
+	HealthCheck(ctx context.Context) (*runpod.HealthCheckResponse, error)
+}
+
+// Streamer is a Transcriber that hands out segments while a job runs.
+type Streamer interface {
+	Transcriber
+	// Stream returns the segments the job has transcribed since it was last
+	// streamed.
+	Stream(ctx context.Context, jobId string) (*WhisperStream, error)
+}
+
+// AudioFetcher is a Transcriber that downloads the audio of its jobs itself,
+// from inside our network, rather than leaving it to RunPod. It must only be
+// given audio URLs we presigned, or clients could make it fetch internal
+// services.
+type AudioFetcher interface {
+	Transcriber
+	fetchesAudio()
+}
+
+var (
+	_ Streamer     = (*RunpodWhisperClient)(nil)
+	_ Transcriber  = (*RunpodWhisperClient)(nil)
+	_ AudioFetcher = (*WhisperServerClient)(nil)
+	_ AudioFetcher = (*OpenAIClient)(nil)
+)
+
+// GetTranscriber returns the transcriber selected by TRANSCRIBER_BACKEND,
+// which defaults to RunPod:
+//   - runpod: RUNPOD_API_KEY and RUNPOD_WHISPER_URL
+//   - whisper-server: WHISPER_SERVER_URL, with WHISPER_SERVER_API and
+//     WHISPER_SERVER_CONCURRENCY optional
+//   - openai: OPENAI_API_KEY, with OPENAI_BASE_URL, OPENAI_TRANSCRIPTION_MODEL,
+//     OPENAI_CONCURRENCY and, for Azure OpenAI, OPENAI_API_VERSION optional
+//
+// The transcriber is shared, since the whisper server and OpenAI backends keep
+// track of their jobs in memory.
+var GetTranscriber = sync.OnceValues(func() (Transcriber, error) {
+	switch backend := os.Getenv("TRANSCRIBER_BACKEND"); backend {
+	case "", BackendRunpod:
+		client, err := NewRunpodWhisperClient(os.Getenv("RUNPOD_API_KEY"), os.Getenv("RUNPOD_WHISPER_URL"))
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case BackendWhisperServer:
+		options := []WhisperServerOption{
+			WithConcurrency(utils.GetEnvInt("WHISPER_SERVER_CONCURRENCY", DefaultWhisperServerConcurrency)),
+		}
+		if api := os.Getenv("WHISPER_SERVER_API"); api != "" {
+			options = append(options, WithServerAPI(api))
+		}
+		client, err := NewWhisperServerClient(os.Getenv("WHISPER_SERVER_URL"), options...)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case BackendOpenAI:
+		options := []OpenAIOption{
+			WithOpenAIConcurrency(utils.GetEnvInt("OPENAI_CONCURRENCY", DefaultOpenAIConcurrency)),
+		}
+		if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
+			options = append(options, WithOpenAIBaseURL(baseURL))
+		}
+		if model := os.Getenv("OPENAI_TRANSCRIPTION_MODEL"); model != "" {
+			options = append(options, WithOpenAIModel(model))
+		}
+		if apiVersion := os.Getenv("OPENAI_API_VERSION"); apiVersion != "" {
+			options = append(options, WithAzureAPIVersion(apiVersion))
+		}
+		client, err := NewOpenAIClient(os.Getenv("OPENAI_API_KEY"), options...)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	default:
+		return nil, fmt.Errorf("unknown transcriber backend: %s", backend)
+	}
+})
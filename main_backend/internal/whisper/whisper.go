@@ -205,19 +205,34 @@ func NewWhisperInput(AudioURL string, options ...WhisperInputOption) WhisperInpu
 	return w
 }
 
+// Segment is a span of transcribed speech. Start and End are in seconds.
+type Segment struct {
+	ID               int     `json:"id"`
+	Seek             int     `json:"seek"`
+	Start            float64 `json:"start"`
+	End              float64 `json:"end"`
+	Text             string  `json:"text"`
+	Tokens           []int   `json:"tokens"`
+	Temperature      float64 `json:"temperature"`
+	AvgLogprob       float64 `json:"avg_logprob"`
+	CompressionRatio float64 `json:"compression_ratio"`
+	NoSpeechProb     float64 `json:"no_speech_prob"`
+	// Words is set if word timestamps were requested.
+	Words []Word `json:"words,omitempty"`
+	// Speaker is set if the transcript has been diarized.
+	Speaker string `json:"speaker,omitempty"`
+}
+
+// Word is a transcribed word. Start and End are in seconds.
+type Word struct {
+	Word        string  `json:"word"`
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Probability float64 `json:"probability,omitempty"`
+}
+
 type WhisperOutput struct {
-	Segments []struct {
-		ID               int     `json:"id"`
-		Seek             int     `json:"seek"`
-		Start            float64 `json:"start"`
-		End              float64 `json:"end"`
-		Text             string  `json:"text"`
-		Tokens           []int   `json:"tokens"`
-		Temperature      float64 `json:"temperature"`
-		AvgLogprob       float64 `json:"avg_logprob"`
-		CompressionRatio float64 `json:"compression_ratio"`
-		NoSpeechProb     float64 `json:"no_speech_prob"`
-	} `json:"segments"`
+	Segments         []Segment   `json:"segments"`
 	DetectedLanguage string      `json:"detected_language"`
 	Transcription    string      `json:"transcription"`
 	Translation      interface{} `json:"translation"`
@@ -226,8 +241,16 @@ type WhisperOutput struct {
 	TranslationTime  float64     `json:"translation_time"`
 }
 
+// WhisperStream is what a job has transcribed since it was last streamed.
+type WhisperStream struct {
+	Status   string    `json:"status"`
+	Segments []Segment `json:"segments"`
+	Error    string    `json:"error,omitempty"`
+}
+
 type WhisperJobStatus struct {
 	DelayTime     int    `json:"delayTime,omitempty"`
 	ExecutionTime int    `json:"executionTime,omitempty"`
 	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
 }
@@ -0,0 +1,269 @@
+package whisper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+)
+
+const (
+	// APIWhisperCpp is the /inference endpoint of the whisper.cpp server. The
+	// server should be started with --convert to accept formats other than
+	// 16 kHz WAV.
+	APIWhisperCpp = "whisper.cpp"
+	// APIASRWebservice is the /asr endpoint of whisper-asr-webservice, which
+	// can run faster-whisper.
+	APIASRWebservice = "asr-webservice"
+
+	// DefaultWhisperServerConcurrency is how many jobs are sent to the server
+	// at once. CPU servers are best given one job at a time.
+	DefaultWhisperServerConcurrency = 1
+)
+
+var (
+	ErrMissingWhisperServerURL = errors.New("whisper server URL is required")
+	ErrUnknownWhisperServerAPI = errors.New("unknown whisper server API")
+)
+
+// WhisperServerClient is a Transcriber for a self-hosted Whisper HTTP
+// server. The server transcribes synchronously, so jobs are queued and run in
+// the background.
+type WhisperServerClient struct {
+	*jobQueue
+	baseURL     string
+	api         string
+	httpClient  *http.Client
+	concurrency int
+}
+
+type WhisperServerOption func(*WhisperServerClient)
+
+// WithServerAPI selects the API the server speaks, APIWhisperCpp by default.
+func WithServerAPI(api string) WhisperServerOption {
+	return func(c *WhisperServerClient) {
+		c.api = api
+	}
+}
+
+// WithConcurrency sets how many jobs are sent to the server at once.
+func WithConcurrency(n int) WhisperServerOption {
+	return func(c *WhisperServerClient) {
+		c.concurrency = n
+	}
+}
+
+func WithServerHTTPClient(client *http.Client) WhisperServerOption {
+	return func(c *WhisperServerClient) {
+		c.httpClient = client
+	}
+}
+
+func NewWhisperServerClient(baseURL string, options ...WhisperServerOption) (*WhisperServerClient, error) {
+	if baseURL == "" {
+		return nil, ErrMissingWhisperServerURL
+	}
+
+	c := &WhisperServerClient{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		api:         APIWhisperCpp,
+		httpClient:  http.DefaultClient,
+		concurrency: DefaultWhisperServerConcurrency,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.api != APIWhisperCpp && c.api != APIASRWebservice {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownWhisperServerAPI, c.api)
+	}
+	c.jobQueue = newJobQueue(BackendWhisperServer, c.concurrency, c.httpClient, c.transcribe)
+	return c, nil
+}
+
+// HealthCheck reports the server as healthy if it answers at its base URL,
+// and counts the jobs this client knows about.
+func (c *WhisperServerClient) HealthCheck(ctx context.Context) (*runpod.HealthCheckResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("whisper server is unreachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("whisper server is unhealthy: %s", resp.Status)
+	}
+	return c.health(), nil
+}
+
+// transcribe streams the audio at input.AudioURL to the server and waits for
+// the transcript.
+func (c *WhisperServerClient) transcribe(ctx context.Context, input WhisperInput) (*WhisperOutput, error) {
+	endpoint, fileField, fields := c.request(input)
+	resp, err := postAudio(ctx, c.httpClient, input.AudioURL, endpoint, nil, fileField, fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call whisper server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("whisper server returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	var output verboseOutput
+	err = json.NewDecoder(resp.Body).Decode(&output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode whisper server response: %w", err)
+	}
+	return output.normalize(), nil
+}
+
+// request returns where to send input, the form field to send the audio in,
+// and the other fields to send, mapping WhisperInput onto the server's
+// options. Options the server has no equivalent for are dropped; the model is
+// chosen when the server is started.
+func (c *WhisperServerClient) request(input WhisperInput) (endpoint string, fileField string, fields url.Values) {
+	fields = url.Values{}
+	switch c.api {
+	case APIASRWebservice:
+		fields.Set("task", "transcribe")
+		fields.Set("output", "json")
+		fields.Set("encode", "true")
+		if input.Language != "" {
+			fields.Set("language", input.Language)
+		}
+		if input.InitialPrompt != "" {
+			fields.Set("initial_prompt", input.InitialPrompt)
+		}
+		fields.Set("vad_filter", strconv.FormatBool(input.EnableVad))
+		fields.Set("word_timestamps", strconv.FormatBool(input.WordTimestamps))
+		// whisper-asr-webservice takes its options in the query string.
+		return c.baseURL + "/asr?" + fields.Encode(), "audio_file", nil
+	default:
+		fields.Set("response_format", "verbose_json")
+		language := input.Language
+		if language == "" {
+			language = "auto"
+		}
+		fields.Set("language", language)
+		fields.Set("temperature", formatFloat(input.Temperature))
+		if input.TemperatureIncrementOnFallback > 0 {
+			fields.Set("temperature_inc", formatFloat(input.TemperatureIncrementOnFallback))
+		}
+		if input.InitialPrompt != "" {
+			fields.Set("prompt", input.InitialPrompt)
+		}
+		if input.BestOf > 0 {
+			fields.Set("best_of", strconv.Itoa(input.BestOf))
+		}
+		if input.BeamSize > 0 {
+			fields.Set("beam_size", strconv.Itoa(input.BeamSize))
+		}
+		if input.LogprobThreshold != 0 {
+			fields.Set("logprob_thold", formatFloat(input.LogprobThreshold))
+		}
+		if input.NoSpeechThreshold > 0 {
+			fields.Set("no_speech_thold", formatFloat(input.NoSpeechThreshold))
+		}
+		// whisper.cpp's entropy threshold plays the part of the compression
+		// ratio threshold, with the same default.
+		if input.CompressionRatioThreshold > 0 {
+			fields.Set("entropy_thold", formatFloat(input.CompressionRatioThreshold))
+		}
+		return c.baseURL + "/inference", "file", fields
+	}
+}
+
+// verboseOutput is the verbose_json response format, which the whisper
+// servers share with the OpenAI API.
+type verboseOutput struct {
+	Text     string           `json:"text"`
+	Language string           `json:"language"`
+	Segments []verboseSegment `json:"segments"`
+	Words    []Word           `json:"words"`
+}
+
+type verboseSegment struct {
+	ID               *int    `json:"id"`
+	Seek             int     `json:"seek"`
+	Start            float64 `json:"start"`
+	End              float64 `json:"end"`
+	Text             string  `json:"text"`
+	Tokens           []any   `json:"tokens"`
+	Temperature      float64 `json:"temperature"`
+	AvgLogprob       float64 `json:"avg_logprob"`
+	CompressionRatio float64 `json:"compression_ratio"`
+	NoSpeechProb     float64 `json:"no_speech_prob"`
+	Words            []Word  `json:"words"`
+}
+
+func (o *verboseOutput) normalize() *WhisperOutput {
+	output := &WhisperOutput{
+		Segments:         make([]Segment, 0, len(o.Segments)),
+		DetectedLanguage: strings.ToLower(o.Language),
+		Transcription:    strings.TrimSpace(o.Text),
+	}
+
+	var texts []string
+	for i, s := range o.Segments {
+		segment := Segment{
+			ID:               i,
+			Seek:             s.Seek,
+			Start:            s.Start,
+			End:              s.End,
+			Text:             s.Text,
+			Temperature:      s.Temperature,
+			AvgLogprob:       s.AvgLogprob,
+			CompressionRatio: s.CompressionRatio,
+			NoSpeechProb:     s.NoSpeechProb,
+			Words:            s.Words,
+		}
+		if s.ID != nil {
+			segment.ID = *s.ID
+		}
+		// Tokens are IDs, or objects with an id in some versions of
+		// whisper.cpp.
+		for _, token := range s.Tokens {
+			switch token := token.(type) {
+			case float64:
+				segment.Tokens = append(segment.Tokens, int(token))
+			case map[string]any:
+				if id, ok := token["id"].(float64); ok {
+					segment.Tokens = append(segment.Tokens, int(id))
+				}
+			}
+		}
+		output.Segments = append(output.Segments, segment)
+		texts = append(texts, strings.TrimSpace(s.Text))
+	}
+	if output.Transcription == "" {
+		output.Transcription = strings.Join(texts, " ")
+	}
+	assignWords(output.Segments, o.Words)
+	return output
+}
+
+// assignWords adds each word to the last segment that starts before its
+// midpoint, or to the first segment. Both are in order of time.
+func assignWords(segments []Segment, words []Word) {
+	if len(segments) == 0 {
+		return
+	}
+	i := 0
+	for _, word := range words {
+		midpoint := (word.Start + word.End) / 2
+		for i < len(segments)-1 && segments[i+1].Start <= midpoint {
+			i++
+		}
+		segments[i].Words = append(segments[i].Words, word)
+	}
+}
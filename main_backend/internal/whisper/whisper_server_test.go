@@ -0,0 +1,245 @@
+package whisper_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/runpod"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+const testAudio = "RIFF....WAVEfmt "
+
+// newTestWhisperServer serves audio at /audio/recording.wav and answers
+// transcription requests with handler.
+func newTestWhisperServer(t *testing.T, pattern string, handler http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /audio/recording.wav", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testAudio)
+	})
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc(pattern, handler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func waitForJob(t *testing.T, c whisper.Transcriber, jobId string) *whisper.WhisperJobStatus {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := c.Status(context.Background(), jobId)
+		if err != nil {
+			t.Fatalf("Failed to get status: %v", err)
+		}
+		if status.Status != whisper.StatusQueue && status.Status != whisper.StatusProgress {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", jobId)
+	return nil
+}
+
+func TestWhisperServerRun(t *testing.T) {
+	var form map[string][]string
+	server := newTestWhisperServer(t, "POST /inference", func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		form = r.MultipartForm.Value
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		audio, _ := io.ReadAll(file)
+		if string(audio) != testAudio || header.Filename != "recording.wav" {
+			http.Error(w, "unexpected audio", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{
+			"language": "English",
+			"segments": [
+				{"id": 0, "start": 0, "end": 1.5, "text": " Hello", "tokens": [50364, 2425]},
+				{"id": 1, "start": 1.5, "end": 3, "text": " world.", "tokens": [{"id": 1002, "p": 0.9}]}
+			]
+		}`)
+	})
+
+	c, err := whisper.NewWhisperServerClient(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create whisper server client: %v", err)
+	}
+
+	webhookCalls := make(chan runpod.StatusResponse, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload runpod.StatusResponse
+		json.NewDecoder(r.Body).Decode(&payload)
+		webhookCalls <- payload
+	}))
+	t.Cleanup(webhook.Close)
+	hook := runpod.WebHook(webhook.URL)
+
+	response, err := c.Run(context.Background(), whisper.NewWhisperInput(server.URL+"/audio/recording.wav"), &hook, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to run job: %v", err)
+	}
+	if response.Status != whisper.StatusQueue {
+		t.Errorf("Expected %s, got %s", whisper.StatusQueue, response.Status)
+	}
+
+	status := waitForJob(t, c, response.JobId)
+	if status.Status != whisper.StatusComplete {
+		t.Fatalf("Expected %s, got %s: %s", whisper.StatusComplete, status.Status, status.Error)
+	}
+	if form["language"][0] != "auto" || form["response_format"][0] != "verbose_json" {
+		t.Errorf("Unexpected form fields: %v", form)
+	}
+
+	output, err := c.Result(context.Background(), response.JobId)
+	if err != nil {
+		t.Fatalf("Failed to get result: %v", err)
+	}
+	if output.Transcription != "Hello world." || output.DetectedLanguage != "english" {
+		t.Errorf("Unexpected output: %+v", output)
+	}
+	if len(output.Segments) != 2 || output.Segments[1].End != 3 || len(output.Segments[1].Tokens) != 1 || output.Segments[1].Tokens[0] != 1002 {
+		t.Errorf("Unexpected segments: %+v", output.Segments)
+	}
+
+	select {
+	case payload := <-webhookCalls:
+		if payload.JobId != response.JobId || payload.Status != whisper.StatusComplete {
+			t.Errorf("Unexpected webhook payload: %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Webhook was not called")
+	}
+}
+
+func TestWhisperServerASRWebservice(t *testing.T) {
+	var query map[string][]string
+	server := newTestWhisperServer(t, "POST /asr", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		_, _, err := r.FormFile("audio_file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"text": " Bonjour.", "language": "fr", "segments": [{"start": 0, "end": 1, "text": " Bonjour."}]}`)
+	})
+
+	c, err := whisper.NewWhisperServerClient(server.URL, whisper.WithServerAPI(whisper.APIASRWebservice))
+	if err != nil {
+		t.Fatalf("Failed to create whisper server client: %v", err)
+	}
+
+	response, err := c.Run(context.Background(), whisper.NewWhisperInput(server.URL+"/audio/recording.wav", whisper.WithLanguage("fr")), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to run job: %v", err)
+	}
+	status := waitForJob(t, c, response.JobId)
+	if status.Status != whisper.StatusComplete {
+		t.Fatalf("Expected %s, got %s: %s", whisper.StatusComplete, status.Status, status.Error)
+	}
+	if query["language"][0] != "fr" || query["output"][0] != "json" {
+		t.Errorf("Unexpected query: %v", query)
+	}
+
+	output, err := c.Result(context.Background(), response.JobId)
+	if err != nil {
+		t.Fatalf("Failed to get result: %v", err)
+	}
+	if output.Transcription != "Bonjour." || output.DetectedLanguage != "fr" {
+		t.Errorf("Unexpected output: %+v", output)
+	}
+}
+
+func TestWhisperServerFailure(t *testing.T) {
+	server := newTestWhisperServer(t, "POST /inference", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "failed to read audio", http.StatusInternalServerError)
+	})
+
+	c, err := whisper.NewWhisperServerClient(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create whisper server client: %v", err)
+	}
+
+	response, err := c.Run(context.Background(), whisper.NewWhisperInput(server.URL+"/audio/recording.wav"), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to run job: %v", err)
+	}
+	status := waitForJob(t, c, response.JobId)
+	if status.Status != whisper.StatusFailed || status.Error == "" {
+		t.Errorf("Expected %s with an error, got %+v", whisper.StatusFailed, status)
+	}
+
+	_, err = c.Result(context.Background(), response.JobId)
+	var failed *whisper.ErrJobFailed
+	if !errors.As(err, &failed) {
+		t.Errorf("Expected ErrJobFailed, got %v", err)
+	}
+
+	status, err = c.Status(context.Background(), "unknown")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if status.Status != whisper.StatusFailed {
+		t.Errorf("Expected unknown job to be %s, got %s", whisper.StatusFailed, status.Status)
+	}
+}
+
+func TestWhisperServerCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := newTestWhisperServer(t, "POST /inference", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		io.WriteString(w, `{"text": ""}`)
+	})
+	t.Cleanup(func() { close(release) })
+
+	c, err := whisper.NewWhisperServerClient(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create whisper server client: %v", err)
+	}
+
+	// The first job holds the only slot, so the second stays queued.
+	first, err := c.Run(context.Background(), whisper.NewWhisperInput(server.URL+"/audio/recording.wav"), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to run job: %v", err)
+	}
+	second, err := c.Run(context.Background(), whisper.NewWhisperInput(server.URL+"/audio/recording.wav"), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to run job: %v", err)
+	}
+
+	for _, jobId := range []string{second.JobId, first.JobId} {
+		_, err = c.Cancel(context.Background(), jobId)
+		if err != nil {
+			t.Fatalf("Failed to cancel job: %v", err)
+		}
+		status := waitForJob(t, c, jobId)
+		if status.Status != whisper.StatusCanceled {
+			t.Errorf("Expected %s, got %s", whisper.StatusCanceled, status.Status)
+		}
+		_, err = c.Result(context.Background(), jobId)
+		if !errors.Is(err, whisper.ErrJobCancelled) {
+			t.Errorf("Expected ErrJobCancelled, got %v", err)
+		}
+	}
+
+	_, err = c.Cancel(context.Background(), "unknown")
+	if !errors.Is(err, whisper.ErrUnknownJob) {
+		t.Errorf("Expected ErrUnknownJob, got %v", err)
+	}
+}
@@ -1,28 +1,121 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/cmd/accounts"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/cmd/admin"
 	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/cmd/download"
 	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/cmd/transcribe"
 	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/cmd/upload"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/cmd/webhooks"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/auth"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/diarize"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/jobs"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/localstore"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/ratelimit"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/storage"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/uploads"
 	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/utils"
+	"github.com/Yongbeom-Kim/transcribemymeet.ing/main_backend/internal/whisper"
+)
+
+const SHUTDOWN_TIMEOUT = 30 * time.Second
+
+var (
+	DEFAULT_UPLOAD_URL_LIMIT   = ratelimit.Limit{Burst: 600, Period: time.Minute}
+	DEFAULT_DOWNLOAD_URL_LIMIT = ratelimit.Limit{Burst: 60, Period: time.Minute}
+	DEFAULT_TRANSCRIBE_LIMIT   = ratelimit.Limit{Burst: 10, Period: time.Minute}
+	DEFAULT_LOGIN_LIMIT        = ratelimit.Limit{Burst: 10, Period: time.Minute}
+	DEFAULT_REGISTER_LIMIT     = ratelimit.Limit{Burst: 5, Period: time.Hour}
 )
 
 func main() {
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
 
-	http.HandleFunc("POST /upload/start-multipart", upload.StartMultipartUpload)
-	http.HandleFunc("POST /upload/presigned-part-url", upload.CreateUploadURL)
-	http.HandleFunc("POST /upload/complete-multipart", upload.CompleteMultipartUpload)
-	http.HandleFunc("POST /download/presigned-url", download.CreateDownloadURL)
-	http.HandleFunc("POST /transcribe/start", transcribe.StartTranscription)
-	http.HandleFunc("GET /transcribe/status/{job_id}", transcribe.GetTranscriptionStatus)
-	http.HandleFunc("GET /transcribe/result/{job_id}", transcribe.GetTranscriptionResult)
+	// Every upload, download and transcription goes through the object
+	// store, so there is no point in serving without one. Backends missing
+	// required environment variables panic naming them.
+	store, err := storage.GetObjectStore()
+	if err != nil {
+		slog.Error("Failed to configure object storage", "backend", os.Getenv("STORAGE_BACKEND"), "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	limiter := ratelimit.NewMemoryLimiter()
+	limitUploadURLs := rateLimit(limiter, "UPLOAD_URL", DEFAULT_UPLOAD_URL_LIMIT)
+	limitDownloadURLs := rateLimit(limiter, "DOWNLOAD_URL", DEFAULT_DOWNLOAD_URL_LIMIT)
+	limitTranscriptions := rateLimit(limiter, "TRANSCRIBE", DEFAULT_TRANSCRIBE_LIMIT)
+	limitLogins := rateLimitByIP(limiter, "LOGIN", DEFAULT_LOGIN_LIMIT)
+	limitRegistrations := rateLimitByIP(limiter, "REGISTER", DEFAULT_REGISTER_LIMIT)
+
+	http.HandleFunc("POST /auth/register", limitRegistrations(accounts.Register))
+	http.HandleFunc("POST /auth/login", limitLogins(accounts.Login))
+	http.HandleFunc("POST /auth/logout", auth.RequireUser(accounts.Logout))
+	http.HandleFunc("GET /auth/me", auth.RequireUser(accounts.GetCurrentUser))
+	http.HandleFunc("POST /auth/api-keys", auth.RequireUser(accounts.CreateAPIKey))
+	http.HandleFunc("GET /auth/api-keys", auth.RequireUser(accounts.ListAPIKeys))
+	http.HandleFunc("DELETE /auth/api-keys/{key_id}", auth.RequireUser(accounts.DeleteAPIKey))
+	http.HandleFunc("GET /usage", auth.RequireUser(accounts.GetUsage))
+	http.HandleFunc("POST /upload/start-multipart", auth.RequireUser(upload.StartMultipartUpload))
+	http.HandleFunc("POST /upload/presigned-part-url", auth.RequireUser(limitUploadURLs(upload.CreateUploadURL)))
+	http.HandleFunc("GET /upload/{upload_id}/parts", auth.RequireUser(upload.ListUploadedParts))
+	http.HandleFunc("POST /upload/complete-multipart", auth.RequireUser(upload.CompleteMultipartUpload))
+	http.HandleFunc("POST /download/presigned-url", auth.RequireUser(limitDownloadURLs(download.CreateDownloadURL)))
+	http.HandleFunc("POST /transcribe/start", auth.RequireUser(limitTranscriptions(transcribe.StartTranscription)))
+	http.HandleFunc("GET /transcribe/status/{job_id}", auth.RequireUser(transcribe.GetTranscriptionStatus))
+	http.HandleFunc("GET /transcribe/result/{job_id}", auth.RequireUser(transcribe.GetTranscriptionResult))
+	http.HandleFunc("POST /transcribe/cancel/{job_id}", auth.RequireUser(transcribe.CancelTranscription))
+	http.HandleFunc("GET /transcribe/stream/{job_id}", auth.RequireUser(transcribe.StreamTranscription))
+	http.HandleFunc("GET /transcribe/events/{job_id}", auth.RequireUser(transcribe.SubscribeJobStatus))
+	http.HandleFunc("POST /transcribe/speakers/{job_id}", auth.RequireUser(transcribe.RenameSpeakers))
+	http.HandleFunc("POST /admin/uploads/collect", auth.RequireAdmin(admin.CollectUploads))
+	http.HandleFunc("POST /admin/users/plan", auth.RequireAdmin(admin.SetUserPlan))
+	// Webhooks and local storage URLs carry their own signatures.
+	http.HandleFunc("POST /webhooks/runpod/{token}", webhooks.RunpodWebhook)
+
+	if localStore, ok := store.(*localstore.LocalStore); ok {
+		http.HandleFunc("PUT "+localstore.RoutePrefix+"/{key...}", localStore.HandleUpload)
+		http.HandleFunc("GET "+localstore.RoutePrefix+"/{key...}", localStore.HandleDownload)
+	}
+
+	var background sync.WaitGroup
+	transcribe.SetBackground(ctx, &background)
+
+	poller, err := newJobPoller()
+	if err != nil {
+		slog.Error("Job poller is disabled", "error", err)
+	} else {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			poller.Run(ctx)
+		}()
+	}
+
+	janitor, err := uploads.GetJanitor()
+	if err != nil {
+		slog.Error("Upload janitor is disabled", "error", err)
+	} else {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			janitor.Run(ctx)
+		}()
+	}
 
 	port := utils.GetEnvAssert("PORT")
 	portInt, err := strconv.Atoi(port)
@@ -30,10 +123,96 @@ func main() {
 		fmt.Println(err)
 	}
 
+	server := &http.Server{Addr: fmt.Sprintf(":%d", portInt)}
+	// Event streams are not closed by Shutdown, so their subscriptions are.
+	server.RegisterOnShutdown(jobs.GetBroker().Close)
+	// Requests may start background work until Shutdown returns.
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		slog.Info("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+		defer cancel()
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}()
+
 	fmt.Printf("Server is starting on port %d...\n", portInt)
-	err = http.ListenAndServe(fmt.Sprintf(":%d", portInt), nil)
-	if err != nil {
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		fmt.Println(err)
 	}
 
+	stop()
+	<-shutdown
+	background.Wait()
+}
+
+// newJobPoller creates the background poller that tracks transcription jobs.
+// JOB_POLL_INTERVAL, JOB_TIMEOUT and DIARIZATION_TIMEOUT override the poller
+// defaults.
+func newJobPoller() (*jobs.Poller, error) {
+	jobStore, err := jobs.GetStore()
+	if err != nil {
+		return nil, err
+	}
+
+	whisperClient, err := whisper.GetTranscriber()
+	if err != nil {
+		return nil, err
+	}
+
+	options := []jobs.PollerOption{
+		jobs.WithPollInterval(utils.GetEnvDuration("JOB_POLL_INTERVAL", jobs.DefaultPollInterval)),
+		jobs.WithJobTimeout(utils.GetEnvDuration("JOB_TIMEOUT", jobs.DefaultJobTimeout)),
+		jobs.WithDiarizationTimeout(utils.GetEnvDuration("DIARIZATION_TIMEOUT", jobs.DefaultDiarizationTimeout)),
+	}
+	if diarizationURL := os.Getenv("RUNPOD_DIARIZATION_URL"); diarizationURL != "" {
+		diarizer, err := diarize.NewRunpodDiarizer(os.Getenv("RUNPOD_API_KEY"), diarizationURL)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, jobs.WithDiarizer(diarizer))
+	}
+
+	return jobs.NewPoller(jobStore, whisperClient, options...), nil
+}
+
+// rateLimit returns a wrapper that limits each client of a route by user and
+// by IP, which must go inside auth.RequireUser. RATE_LIMIT_<name> overrides
+// the limit, e.g. "60/1m". Set TRUST_PROXY=true when running behind a proxy
+// that sets X-Forwarded-For.
+func rateLimit(limiter ratelimit.Limiter, name string, defaultLimit ratelimit.Limit) func(http.HandlerFunc) http.HandlerFunc {
+	limit := routeLimit(name, defaultLimit)
+	return ratelimit.Middleware(limiter, name, limit, ratelimit.ByUser, clientIP())
+}
+
+// rateLimitByIP is like rateLimit, but only limits by IP, for routes called
+// before the client has credentials.
+func rateLimitByIP(limiter ratelimit.Limiter, name string, defaultLimit ratelimit.Limit) func(http.HandlerFunc) http.HandlerFunc {
+	limit := routeLimit(name, defaultLimit)
+	return ratelimit.Middleware(limiter, name, limit, clientIP())
+}
+
+func routeLimit(name string, defaultLimit ratelimit.Limit) ratelimit.Limit {
+	limit := defaultLimit
+	if value := os.Getenv("RATE_LIMIT_" + name); value != "" {
+		parsed, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			panic(fmt.Sprintf("RATE_LIMIT_%s environment variable is not a valid limit: %v", name, err))
+		}
+		limit = parsed
+	}
+	slog.Info("Rate limiting route", "route", name, "limit", limit)
+	return limit
+}
+
+func clientIP() ratelimit.KeyFunc {
+	if os.Getenv("TRUST_PROXY") == "true" {
+		return ratelimit.ByForwardedIP
+	}
+	return ratelimit.ByIP
 }